@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"freee-oauth-app/domain"
+	"freee-oauth-app/usecase"
+)
+
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, `Usage: freee-oauth-app [flags] [command]
+
+Commands:
+  login          Start a new OAuth2 authorization flow
+  status         Show the stored token status without network access
+  refresh        Refresh the token even if it is still valid
+  logout         Revoke and delete the stored token
+  token          Print the raw access token for scripting
+  serve          Run a local token broker for other processes
+                 (--listen addr | --socket path, --secret-file path)
+  proxy          Run a local proxy that adds the token to freee API requests
+                 (--listen addr | --socket path, --upstream url)
+  daemon         Keep refreshing the token ahead of expiry until SIGTERM
+                 (--lead 10m, --jitter 2m, --keep-alive 24h, --retry-interval 1m)
+  companies list List the companies the user can access
+  companies select [id]
+                 Choose the default company (interactively without an id)
+  companies default
+                 Print the default company ID for scripting
+  profiles list  List the configured profiles
+  config show    Show the effective configuration with secrets redacted
+
+Flags:
+  --config path         Config file (env: FREEE_CONFIG,
+                        default: $XDG_CONFIG_HOME/freee-oauth-app/config.toml)
+  --profile name        Profile to use (env: FREEE_PROFILE, default: "default")
+  --client-id id        OAuth client ID (env: FREEE_CLIENT_ID)
+  --redirect-url url    OAuth redirect URL (env: FREEE_REDIRECT_URL)
+  --scopes list         Comma separated OAuth scopes (env: FREEE_SCOPES)
+  --token-file path     Token file (env: FREEE_TOKEN_FILE)
+  --token-store name    Token store backend: file or encrypted (env: FREEE_TOKEN_STORE)
+  --callback-port port  Callback server port (env: FREEE_CALLBACK_PORT); ports in
+                        FREEE_CALLBACK_FALLBACK_PORTS are tried if it is in use
+  --timeout duration    Authorization timeout (env: FREEE_AUTH_TIMEOUT)
+  --no-browser          Do not open the authorization URL in a browser
+                        (env: FREEE_NO_BROWSER)
+  --headless            Paste the authorization response instead of waiting
+                        for the browser redirect (env: FREEE_HEADLESS)
+  --fake-server         Use an in-process fake freee authorization server that
+                        approves automatically, for offline development
+                        (env: FREEE_FAKE_SERVER)
+  --company id          Company to select as the default after login
+                        (env: FREEE_COMPANY_ID)
+
+Settings are merged in this order (later wins):
+  defaults, config file, config file profile, environment variables, flags.
+The client secret is never accepted as a flag; use FREEE_CLIENT_SECRET or
+client_secret_env / client_secret_file in the config file.
+
+Without a command, the stored token is reused or refreshed,
+and a new authorization flow is started if necessary.
+`)
+}
+
+// runStatus は保存されているトークンの状態を表示する
+func (app *App) runStatus(ctx context.Context) error {
+	token, err := app.oauthUseCase.LoadToken(ctx)
+	if errors.Is(err, usecase.ErrNoToken) {
+		fmt.Fprintln(app.stdout, "Not logged in. Run 'login' to authorize.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(app.stdout, "Profile: %s\n", app.config.ProfileName)
+	fmt.Fprintf(app.stdout, "Token file: %s\n", app.config.TokenFile)
+	fmt.Fprintf(app.stdout, "  Access Token: %s\n", token.MaskedAccessToken())
+	if token.TokenType != "" {
+		fmt.Fprintf(app.stdout, "  Token Type: %s\n", token.TokenType)
+	}
+	if !token.IssuedAt.IsZero() {
+		fmt.Fprintf(app.stdout, "  Issued: %s\n", token.IssuedAt.Format(time.RFC3339))
+	}
+	policy := app.oauthUseCase.ExpiryPolicy()
+	fmt.Fprintf(app.stdout, "  Expires: %s", token.Expiry.Format(time.RFC3339))
+	if remaining := policy.Remaining(token); remaining > 0 {
+		fmt.Fprintf(app.stdout, " (in %s)\n", remaining.Truncate(time.Second))
+	} else {
+		fmt.Fprintf(app.stdout, " (expired)\n")
+	}
+	fmt.Fprintf(app.stdout, "  Valid: %t\n", policy.IsValid(token))
+	if len(token.Scopes) > 0 {
+		fmt.Fprintf(app.stdout, "  Scopes: %s\n", strings.Join(token.Scopes, " "))
+	} else {
+		fmt.Fprintf(app.stdout, "  Scopes: (unknown)\n")
+	}
+	if token.CompanyID != 0 {
+		fmt.Fprintf(app.stdout, "  Company ID: %d\n", token.CompanyID)
+	}
+	if token.DefaultCompany != nil {
+		fmt.Fprintf(app.stdout, "  Default Company: %s (%d)\n", token.DefaultCompany.Label(), token.DefaultCompany.ID)
+	} else {
+		fmt.Fprintf(app.stdout, "  Default Company: (not selected)\n")
+	}
+	switch remaining, ok := policy.RefreshTokenRemaining(token); {
+	case !token.HasRefreshToken():
+		fmt.Fprintf(app.stdout, "  Refresh Token: (not available)\n")
+	case !ok:
+		fmt.Fprintf(app.stdout, "  Refresh Token: (available)\n")
+	case remaining > 0:
+		fmt.Fprintf(app.stdout, "  Refresh Token: (available, expires %s, in %s)\n",
+			token.RefreshTokenExpiry.Format(time.RFC3339), remaining.Truncate(time.Second))
+	default:
+		fmt.Fprintf(app.stdout, "  Refresh Token: (expired %s)\n", token.RefreshTokenExpiry.Format(time.RFC3339))
+	}
+	app.warnRefreshTokenExpiry(token)
+	return nil
+}
+
+// warnRefreshTokenExpiry はリフレッシュトークンの失効が近い場合に再認可を促す
+// 失効するとリフレッシュできなくなり、ブラウザでの認可が必要になる
+func (app *App) warnRefreshTokenExpiry(token *domain.Token) {
+	policy := app.oauthUseCase.ExpiryPolicy()
+	if !policy.RefreshTokenExpiring(token) {
+		return
+	}
+	if remaining, _ := policy.RefreshTokenRemaining(token); remaining > 0 {
+		fmt.Fprintf(app.stdout, "\nWarning: the refresh token expires in %s (%s). Run 'login' to re-authorize before it lapses.\n",
+			remaining.Truncate(time.Second), token.RefreshTokenExpiry.Format(time.RFC3339))
+		return
+	}
+	fmt.Fprintln(app.stdout, "\nWarning: the refresh token has expired. Run 'login' to re-authorize.")
+}
+
+// runRefresh はトークンを強制的にリフレッシュする
+func (app *App) runRefresh(ctx context.Context) error {
+	token, err := app.oauthUseCase.ForceRefresh(ctx)
+	if err != nil {
+		return explainAuthError(err, "refresh failed")
+	}
+
+	fmt.Fprintf(app.stdout, "Token refreshed successfully\n")
+	fmt.Fprintf(app.stdout, "  Access Token: %s\n", token.MaskedAccessToken())
+	fmt.Fprintf(app.stdout, "  Expires: %s\n", token.Expiry.Format(time.RFC3339))
+	app.warnRefreshTokenExpiry(token)
+	return nil
+}
+
+// runLogout はトークンを無効化し、保存されているトークンを削除する
+func (app *App) runLogout(ctx context.Context) error {
+	err := app.oauthUseCase.Logout(ctx)
+	if errors.Is(err, usecase.ErrNoToken) {
+		fmt.Fprintln(app.stdout, "Not logged in.")
+		return nil
+	}
+	if errors.Is(err, usecase.ErrRevokeFailed) {
+		fmt.Fprintf(app.stdout, "Token removed from %s, but revocation at freee failed.\n", app.config.TokenFile)
+		fmt.Fprintln(app.stdout, "Revoke the app's access from the freee web console if the token may have leaked.")
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("logout failed: %w", err)
+	}
+
+	fmt.Fprintf(app.stdout, "Logged out. Token revoked and removed from %s\n", app.config.TokenFile)
+	return nil
+}
+
+// runToken は有効なアクセストークンをそのまま標準出力に出力する
+func (app *App) runToken(ctx context.Context) error {
+	token, err := app.oauthUseCase.GetOrRefreshToken(ctx)
+	if err != nil {
+		return explainAuthError(err, "no valid token (run 'login' first)")
+	}
+
+	fmt.Fprintln(app.stdout, token.AccessToken)
+	return nil
+}
+
+// explainAuthError は認可サーバーのエラーを、利用者が取るべき対応が分かるメッセージでラップする
+// 再認可が必要な場合と、時間をおいて再試行すべき場合を区別する
+func explainAuthError(err error, fallback string) error {
+	switch {
+	case errors.Is(err, domain.ErrTransient):
+		return fmt.Errorf("freee is temporarily unavailable, retry later: %w", err)
+	case errors.Is(err, domain.ErrInvalidGrant):
+		return fmt.Errorf("refresh token has been revoked or expired, run 'login' again: %w", err)
+	case errors.Is(err, domain.ErrInvalidClient):
+		return fmt.Errorf("client credentials were rejected, check client_id and client_secret: %w", err)
+	default:
+		return fmt.Errorf("%s: %w", fallback, err)
+	}
+}
+
+// requiresCredentials はコマンドの実行にクライアント認証情報が必要かを判定する
+func requiresCredentials(args []string) bool {
+	if len(args) == 0 {
+		return true
+	}
+	switch args[0] {
+	case "profiles", "config", "help", "-h", "--help":
+		return false
+	}
+	return true
+}
+
+// runProfiles はプロファイル関連のサブコマンドを実行する
+func (app *App) runProfiles(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		return app.runProfilesList(ctx)
+	}
+	return fmt.Errorf("unknown profiles command: %s", args[0])
+}
+
+// runProfilesList はプロファイルの一覧とトークンの状態を表示する
+func (app *App) runProfilesList(ctx context.Context) error {
+	summaries, err := app.profileUseCase.ListProfiles(ctx)
+	if err != nil {
+		return err
+	}
+
+	// defaultプロファイルが設定ファイルにない場合は環境変数のプロファイルを表示する
+	if !hasProfile(summaries, domain.DefaultProfileName) {
+		if profile := app.config.envProfile(); profile.ClientID != "" {
+			app.config.applyProfileDefaults(profile)
+			summary, err := app.profileUseCase.Describe(ctx, profile)
+			if err != nil {
+				return err
+			}
+			summaries = append([]usecase.ProfileSummary{summary}, summaries...)
+		}
+	}
+
+	if len(summaries) == 0 {
+		fmt.Fprintf(app.stdout, "No profiles configured. Set FREEE_CLIENT_ID/FREEE_CLIENT_SECRET or add profiles to %s.\n", app.config.ConfigFile)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(app.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  NAME\tCLIENT ID\tSCOPES\tTOKEN FILE\tTOKEN")
+	for _, summary := range summaries {
+		marker := " "
+		if summary.Profile.Name == app.config.ProfileName {
+			marker = "*"
+		}
+		scopes := "(default)"
+		if len(summary.Profile.Scopes) > 0 {
+			scopes = strings.Join(summary.Profile.Scopes, ",")
+		}
+		fmt.Fprintf(w, "%s %s\t%s\t%s\t%s\t%s\n",
+			marker,
+			summary.Profile.Name,
+			summary.Profile.ClientID,
+			scopes,
+			summary.Profile.TokenFile,
+			describeToken(summary.Token, app.oauthUseCase.ExpiryPolicy()),
+		)
+	}
+	return w.Flush()
+}
+
+func hasProfile(summaries []usecase.ProfileSummary, name string) bool {
+	for _, summary := range summaries {
+		if summary.Profile.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// describeToken はプロファイル一覧用にトークンの状態を短く表現する
+func describeToken(token *domain.Token, policy domain.ExpiryPolicy) string {
+	switch {
+	case token == nil:
+		return "not logged in"
+	case policy.IsValid(token) && policy.RefreshTokenExpiring(token):
+		return "valid until " + token.Expiry.Format(time.RFC3339) + " (refresh token expires " + token.RefreshTokenExpiry.Format(time.RFC3339) + ")"
+	case policy.IsValid(token):
+		return "valid until " + token.Expiry.Format(time.RFC3339)
+	case token.HasRefreshToken():
+		return "expired (refreshable)"
+	default:
+		return "expired"
+	}
+}
+
+// runConfig は設定関連のサブコマンドを実行する
+func (app *App) runConfig(args []string) error {
+	if len(args) == 0 || args[0] == "show" {
+		return app.runConfigShow()
+	}
+	return fmt.Errorf("unknown config command: %s", args[0])
+}
+
+// runConfigShow は有効な設定と各値の取得元をシークレットを伏せて表示する
+func (app *App) runConfigShow() error {
+	c := app.config
+	scopes := "(provider default)"
+	if len(c.Scopes) > 0 {
+		scopes = strings.Join(c.Scopes, ",")
+	}
+	tokenStore := c.TokenStore
+	if tokenStore == "" {
+		tokenStore = "(auto)"
+	}
+
+	w := tabwriter.NewWriter(app.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "config_file\t%s\t(%s)\n", c.ConfigFile, c.source("config_file"))
+	fmt.Fprintf(w, "profile\t%s\t(%s)\n", c.ProfileName, c.source("profile"))
+	fmt.Fprintf(w, "client_id\t%s\t(%s)\n", c.ClientID, c.source("client_id"))
+	fmt.Fprintf(w, "client_secret\t%s\t(%s)\n", redact(c.ClientSecret), c.source("client_secret"))
+	fmt.Fprintf(w, "redirect_url\t%s\t(%s)\n", c.RedirectURL, c.source("redirect_url"))
+	fmt.Fprintf(w, "scopes\t%s\t(%s)\n", scopes, c.source("scopes"))
+	fmt.Fprintf(w, "callback_port\t%d\t(%s)\n", c.CallbackPort, c.source("callback_port"))
+	fmt.Fprintf(w, "callback_fallback_ports\t%s\t(%s)\n", formatPorts(c.CallbackFallbackPorts), c.source("callback_fallback_ports"))
+	fmt.Fprintf(w, "callback_path\t%s\t(%s)\n", c.CallbackPath, c.source("callback_path"))
+	fmt.Fprintf(w, "headless\t%t\t(%s)\n", c.Headless, c.source("headless"))
+	fmt.Fprintf(w, "no_browser\t%t\t(%s)\n", c.NoBrowser, c.source("no_browser"))
+	fmt.Fprintf(w, "fake_server\t%t\t(%s)\n", c.FakeServer, c.source("fake_server"))
+	fmt.Fprintf(w, "company_id\t%d\t(%s)\n", c.CompanyID, c.source("company_id"))
+	fmt.Fprintf(w, "auth_timeout\t%s\t(%s)\n", c.AuthTimeout, c.source("auth_timeout"))
+	fmt.Fprintf(w, "http_timeout\t%s\t(%s)\n", c.HTTPTimeout, c.source("http_timeout"))
+	fmt.Fprintf(w, "expiry_buffer\t%s\t(%s)\n", c.ExpiryBuffer, c.source("expiry_buffer"))
+	fmt.Fprintf(w, "retry_max_attempts\t%d\t(%s)\n", c.RetryMaxAttempts, c.source("retry_max_attempts"))
+	fmt.Fprintf(w, "retry_max_elapsed\t%s\t(%s)\n", c.RetryMaxElapsed, c.source("retry_max_elapsed"))
+	fmt.Fprintf(w, "token_store\t%s\t(%s)\n", tokenStore, c.source("token_store"))
+	fmt.Fprintf(w, "token_file\t%s\t(%s)\n", c.TokenFile, c.source("token_file"))
+	fmt.Fprintf(w, "token_key_file\t%s\t(%s)\n", c.TokenKeyFile, c.source("token_key_file"))
+	fmt.Fprintf(w, "token_passphrase\t%s\t(%s)\n", redact(c.TokenPassphrase), c.source("token_passphrase"))
+	fmt.Fprintf(w, "state_file\t%s\t(%s)\n", c.StateFile, c.source("state_file"))
+	fmt.Fprintf(w, "hook_exec\t%s\t(%s)\n", c.HookExec, c.source("hook_exec"))
+	fmt.Fprintf(w, "hook_webhook\t%s\t(%s)\n", redact(c.HookWebhook), c.source("hook_webhook"))
+	return w.Flush()
+}
+
+// formatPorts はポート番号のリストをカンマ区切りで表す
+func formatPorts(ports []int) string {
+	if len(ports) == 0 {
+		return "(none)"
+	}
+	s := make([]string, len(ports))
+	for i, port := range ports {
+		s[i] = strconv.Itoa(port)
+	}
+	return strings.Join(s, ",")
+}
+
+// redact はシークレットの有無だけを表す文字列を返す
+func redact(secret string) string {
+	if secret == "" {
+		return "(not set)"
+	}
+	return "********"
+}
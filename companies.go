@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"freee-oauth-app/domain"
+	"freee-oauth-app/usecase"
+)
+
+// runCompanies は事業所関連のサブコマンドを実行する
+func (app *App) runCompanies(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		return app.runCompaniesList(ctx)
+	}
+	switch args[0] {
+	case "select":
+		return app.runCompaniesSelect(ctx, args[1:])
+	case "default":
+		return app.runCompaniesDefault(ctx)
+	default:
+		return fmt.Errorf("unknown companies command: %s", args[0])
+	}
+}
+
+// runCompaniesList はユーザーがアクセスできる事業所の一覧を表示する（既定の事業所に * を付ける）
+func (app *App) runCompaniesList(ctx context.Context) error {
+	companies, err := app.listCompanies(ctx)
+	if err != nil {
+		return err
+	}
+	if len(companies) == 0 {
+		fmt.Fprintln(app.stdout, "No companies are available to this user.")
+		return nil
+	}
+
+	var defaultID int64
+	if company, err := app.companyUseCase.DefaultCompany(ctx); err == nil {
+		defaultID = company.ID
+	}
+	w := tabwriter.NewWriter(app.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  ID\tNAME\tROLE")
+	for _, company := range companies {
+		marker := " "
+		if company.ID == defaultID {
+			marker = "*"
+		}
+		fmt.Fprintf(w, "%s %d\t%s\t%s\n", marker, company.ID, company.Label(), company.Role)
+	}
+	return w.Flush()
+}
+
+// runCompaniesSelect は既定の事業所を選択する
+// 事業所のIDを指定しない場合は一覧から選択する
+func (app *App) runCompaniesSelect(ctx context.Context, args []string) error {
+	var id int64
+	if len(args) > 0 {
+		var err error
+		if id, err = strconv.ParseInt(args[0], 10, 64); err != nil {
+			return fmt.Errorf("invalid company ID %q: %w", args[0], err)
+		}
+	}
+
+	companies, err := app.listCompanies(ctx)
+	if err != nil {
+		return err
+	}
+	if len(companies) == 0 {
+		return errors.New("no companies are available to this user")
+	}
+	if id == 0 {
+		if id, err = app.promptCompany(companies); err != nil {
+			return err
+		}
+	}
+	return app.selectDefaultCompany(ctx, companies, id)
+}
+
+// runCompaniesDefault は既定の事業所のIDを出力する（スクリプト用、ネットワークアクセスなし）
+func (app *App) runCompaniesDefault(ctx context.Context) error {
+	company, err := app.companyUseCase.DefaultCompany(ctx)
+	if errors.Is(err, usecase.ErrNoDefaultCompany) {
+		return fmt.Errorf("%w (run 'companies select' first)", err)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(app.stdout, company.ID)
+	return nil
+}
+
+// chooseDefaultCompany は認可の完了後に既定の事業所を選択する
+//
+// --company で指定された事業所、保存済みまたは認可画面で選択された事業所、
+// アクセスできる唯一の事業所の順に選び、決まらない場合は一覧から選択させる。
+// 認可は完了しているため、事業所を取得できない場合や選択されなかった場合は案内を表示して続行する。
+func (app *App) chooseDefaultCompany(ctx context.Context, token *domain.Token) error {
+	companies, err := app.companyUseCase.ListCompanies(ctx)
+	if err != nil {
+		fmt.Fprintf(app.stdout, "\nCould not list companies: %v\nRun 'companies select' to choose a default company later.\n", err)
+		return nil
+	}
+	if len(companies) == 0 {
+		fmt.Fprintln(app.stdout, "\nNo companies are available to this user.")
+		return nil
+	}
+
+	id := app.config.CompanyID
+	if id == 0 {
+		if company := usecase.PreferredCompany(companies, token); company != nil {
+			id = company.ID
+		}
+	}
+	if id == 0 {
+		fmt.Fprintln(app.stdout)
+		if id, err = app.promptCompany(companies); err != nil {
+			fmt.Fprintf(app.stdout, "\nNo default company selected (%v). Run 'companies select' to choose one.\n", err)
+			// 引き継いだ既定の事業所にアクセスできなくなっている場合は解除する
+			if token.DefaultCompany != nil {
+				if _, err := app.oauthUseCase.SetDefaultCompany(ctx, nil); err != nil {
+					return fmt.Errorf("failed to clear the default company: %w", err)
+				}
+			}
+			return nil
+		}
+	}
+	fmt.Fprintln(app.stdout)
+	return app.selectDefaultCompany(ctx, companies, id)
+}
+
+// selectDefaultCompany は companies のうち id の事業所を既定の事業所として保存する
+func (app *App) selectDefaultCompany(ctx context.Context, companies []domain.Company, id int64) error {
+	company, err := app.companyUseCase.SelectDefault(ctx, companies, id)
+	if errors.Is(err, domain.ErrCompanyNotFound) {
+		return fmt.Errorf("company %d is not available to this user: %w", id, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save the default company: %w", err)
+	}
+	fmt.Fprintf(app.stdout, "Default company: %s (%d)\n", company.Label(), company.ID)
+	return nil
+}
+
+// listCompanies はユーザーがアクセスできる事業所を取得する
+func (app *App) listCompanies(ctx context.Context) ([]domain.Company, error) {
+	companies, err := app.companyUseCase.ListCompanies(ctx)
+	if errors.Is(err, usecase.ErrNoToken) {
+		return nil, fmt.Errorf("not logged in (run 'login' first): %w", err)
+	}
+	if err != nil {
+		return nil, explainAuthError(err, "failed to list companies")
+	}
+	return companies, nil
+}
+
+// promptCompany は事業所の一覧を表示し、標準入力から選択された事業所のIDを返す
+func (app *App) promptCompany(companies []domain.Company) (int64, error) {
+	fmt.Fprintln(app.stdout, "Select the default company:")
+	for i, company := range companies {
+		fmt.Fprintf(app.stdout, "  %d) %s (ID: %d, role: %s)\n", i+1, company.Label(), company.ID, company.Role)
+	}
+	fmt.Fprintf(app.stdout, "Enter a number [1-%d]: ", len(companies))
+
+	line, err := app.readLine()
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || n < 1 || n > len(companies) {
+		return 0, fmt.Errorf("invalid selection %q", strings.TrimSpace(line))
+	}
+	return companies[n-1].ID, nil
+}
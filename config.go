@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"freee-oauth-app/domain"
+	configfile "freee-oauth-app/infrastructure/config"
+	"freee-oauth-app/infrastructure/freee/freeetest"
+	"freee-oauth-app/infrastructure/retry"
+)
+
+// 設定のデフォルト値
+const (
+	defaultCallbackPort = 8080
+	defaultCallbackPath = "/callback"
+	defaultTokenFile    = "token.json"
+	defaultAuthTimeout  = 5 * time.Minute
+	defaultHTTPTimeout  = 30 * time.Second
+	defaultHookTimeout  = 10 * time.Second
+)
+
+// トークンストアのバックエンド
+const (
+	tokenStoreFile      = "file"
+	tokenStoreEncrypted = "encrypted"
+)
+
+// 設定値の取得元（config show で表示する）
+const (
+	sourceDefault = "default"
+	sourceFile    = "config file"
+	sourceFlag    = "flag"
+	// sourceFakeServer は --fake-server による既定値
+	sourceFakeServer = "fake server"
+)
+
+// Config はアプリケーション設定
+//
+// 各項目は以下の優先順位で決定される（上が優先）:
+//
+//  1. コマンドラインフラグ
+//  2. 環境変数
+//  3. 設定ファイルのプロファイル（[profiles.<name>]）
+//  4. 設定ファイルの共通設定
+//  5. デフォルト値
+type Config struct {
+	ConfigFile  string
+	ProfileName string
+
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	TokenFile    string
+	CallbackPort int
+	CallbackPath string
+	// CallbackPort が使用中の場合に順に試すポート
+	CallbackFallbackPorts []int
+	// ブラウザのリダイレクトを待たず、認可レスポンスを標準入力から読み込む
+	Headless bool
+	// 認可URLをブラウザで自動的に開かない
+	NoBrowser bool
+	// freeeの代わりにプロセス内で起動する偽の認可サーバーに接続する
+	FakeServer bool
+	// 認可後に既定の事業所として選択する事業所のID（0の場合は利用者に尋ねる）
+	CompanyID int64
+
+	AuthTimeout time.Duration
+	HTTPTimeout time.Duration
+	// 有効期限のこの時間前からトークンを無効とみなしてリフレッシュする
+	ExpiryBuffer time.Duration
+	// トークンエンドポイントへのリクエストの最大試行回数と、再試行を打ち切るまでの時間
+	RetryMaxAttempts int
+	RetryMaxElapsed  time.Duration
+
+	// トークンの保存方式（"file" / "encrypted"、空の場合は鍵の有無で自動選択）
+	TokenStore string
+	// トークンファイルの暗号化設定
+	TokenPassphrase string
+	TokenKeyFile    string
+	// 鍵のローテーション時に復号に使用する以前の鍵
+	PreviousTokenPassphrase string
+	PreviousTokenKeyFile    string
+
+	// 開始済みの認可リクエストを保存するファイル（空の場合はメモリに保持する）
+	StateFile string
+
+	// トークンのライフサイクルイベントごとに実行するコマンドと、POSTするURL
+	HookExec    string
+	HookWebhook string
+
+	// 各項目の取得元
+	sources map[string]string
+	// 読み込んだ設定ファイル
+	file *configfile.File
+	// getenv は設定とサブコマンドのフラグの既定値に使う環境変数を返す
+	getenv func(string) string
+}
+
+// globalFlags はサブコマンドの前に指定するフラグ
+type globalFlags struct {
+	configFile   string
+	profile      string
+	clientID     string
+	redirectURL  string
+	scopes       string
+	tokenFile    string
+	tokenStore   string
+	callbackPort int
+	authTimeout  time.Duration
+	headless     bool
+	noBrowser    bool
+	fakeServer   bool
+	companyID    int64
+}
+
+// parseGlobalFlags はグローバルフラグを解析し、残りの引数を返す
+func parseGlobalFlags(args []string) (*globalFlags, []string) {
+	flags := &globalFlags{}
+	fs := flag.NewFlagSet("freee-oauth-app", flag.ExitOnError)
+	fs.StringVar(&flags.configFile, "config", "", "config file path (env: FREEE_CONFIG)")
+	fs.StringVar(&flags.profile, "profile", "", "profile name (env: FREEE_PROFILE)")
+	fs.StringVar(&flags.clientID, "client-id", "", "OAuth client ID (env: FREEE_CLIENT_ID)")
+	fs.StringVar(&flags.redirectURL, "redirect-url", "", "OAuth redirect URL (env: FREEE_REDIRECT_URL)")
+	fs.StringVar(&flags.scopes, "scopes", "", "comma separated OAuth scopes (env: FREEE_SCOPES)")
+	fs.StringVar(&flags.tokenFile, "token-file", "", "token file path (env: FREEE_TOKEN_FILE)")
+	fs.StringVar(&flags.tokenStore, "token-store", "", "token store backend: file or encrypted (env: FREEE_TOKEN_STORE)")
+	fs.IntVar(&flags.callbackPort, "callback-port", 0, "callback server port (env: FREEE_CALLBACK_PORT)")
+	fs.DurationVar(&flags.authTimeout, "timeout", 0, "authorization timeout (env: FREEE_AUTH_TIMEOUT)")
+	fs.BoolVar(&flags.noBrowser, "no-browser", false, "do not open the authorization URL in a browser (env: FREEE_NO_BROWSER)")
+	fs.BoolVar(&flags.headless, "headless", false, "paste the authorization response instead of running a callback server (env: FREEE_HEADLESS)")
+	fs.BoolVar(&flags.fakeServer, "fake-server", false, "use an in-process fake freee authorization server (env: FREEE_FAKE_SERVER)")
+	fs.Int64Var(&flags.companyID, "company", 0, "company ID to select as the default after login (env: FREEE_COMPANY_ID)")
+	fs.Usage = func() { printUsage(fs.Output()) }
+	fs.Parse(args)
+	return flags, fs.Args()
+}
+
+// loadConfig は設定ファイル・環境変数・フラグを優先順位に従って統合する
+// 環境変数は getenv から取得する（通常は os.Getenv）
+func loadConfig(flags *globalFlags, getenv func(string) string) (*Config, error) {
+	config := &Config{sources: map[string]string{}, getenv: getenv}
+
+	// 設定ファイルの読み込み
+	config.ConfigFile = configfile.DefaultPath()
+	config.setString("config_file", &config.ConfigFile, "FREEE_CONFIG", flags.configFile)
+	file, err := configfile.Load(config.ConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config file: %w", err)
+	}
+	config.file = file
+
+	// プロファイルの解決
+	config.ProfileName = domain.DefaultProfileName
+	if file.Profile != "" {
+		config.ProfileName = file.Profile
+		config.sources["profile"] = sourceFile
+	}
+	config.setString("profile", &config.ProfileName, "FREEE_PROFILE", flags.profile)
+
+	profile, err := configfile.NewProfileRepository(file).Get(context.Background(), config.ProfileName)
+	if errors.Is(err, domain.ErrProfileNotFound) && config.ProfileName == domain.DefaultProfileName {
+		// defaultプロファイルは設定ファイルになくても環境変数・フラグだけで構成できる
+		profile, err = &domain.Profile{Name: domain.DefaultProfileName}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load profile: %w", err)
+	}
+
+	// 設定ファイルの値（共通設定 → プロファイル）
+	config.CallbackPort = defaultCallbackPort
+	config.CallbackPath = defaultCallbackPath
+	config.AuthTimeout = defaultAuthTimeout
+	config.HTTPTimeout = defaultHTTPTimeout
+	config.ExpiryBuffer = domain.DefaultExpiryBuffer
+	config.RetryMaxAttempts = retry.DefaultPolicy.MaxAttempts
+	config.RetryMaxElapsed = retry.DefaultPolicy.MaxElapsed
+	config.fromFile("callback_port", file.CallbackPort != 0, func() { config.CallbackPort = file.CallbackPort })
+	config.fromFile("callback_path", file.CallbackPath != "", func() { config.CallbackPath = file.CallbackPath })
+	config.fromFile("callback_fallback_ports", len(file.CallbackFallbackPorts) > 0, func() { config.CallbackFallbackPorts = file.CallbackFallbackPorts })
+	config.fromFile("headless", file.Headless, func() { config.Headless = true })
+	config.fromFile("no_browser", file.NoBrowser, func() { config.NoBrowser = true })
+	config.fromFile("auth_timeout", file.Timeouts.Authorization != 0, func() { config.AuthTimeout = file.Timeouts.Authorization })
+	config.fromFile("http_timeout", file.Timeouts.HTTP != 0, func() { config.HTTPTimeout = file.Timeouts.HTTP })
+	config.fromFile("expiry_buffer", file.ExpiryBuffer != 0, func() { config.ExpiryBuffer = file.ExpiryBuffer })
+	config.fromFile("retry_max_attempts", file.Retry.MaxAttempts != 0, func() { config.RetryMaxAttempts = file.Retry.MaxAttempts })
+	config.fromFile("retry_max_elapsed", file.Retry.MaxElapsed != 0, func() { config.RetryMaxElapsed = file.Retry.MaxElapsed })
+	config.fromFile("token_store", file.TokenStore.Backend != "", func() { config.TokenStore = file.TokenStore.Backend })
+	config.fromFile("token_key_file", file.TokenStore.KeyFile != "", func() { config.TokenKeyFile = file.TokenStore.KeyFile })
+	config.fromFile("state_file", file.StateFile != "", func() { config.StateFile = file.StateFile })
+	config.fromFile("hook_exec", file.Hooks.Exec != "", func() { config.HookExec = file.Hooks.Exec })
+	config.fromFile("hook_webhook", file.Hooks.Webhook != "", func() { config.HookWebhook = file.Hooks.Webhook })
+	if file.TokenStore.PassphraseEnv != "" {
+		config.TokenPassphrase = config.getenv(file.TokenStore.PassphraseEnv)
+		config.sources["token_passphrase"] = "env " + file.TokenStore.PassphraseEnv
+	}
+	config.PreviousTokenKeyFile = file.TokenStore.PreviousKeyFile
+	if file.TokenStore.PreviousPassphraseEnv != "" {
+		config.PreviousTokenPassphrase = config.getenv(file.TokenStore.PreviousPassphraseEnv)
+	}
+	config.fromFile("client_id", profile.ClientID != "", func() { config.ClientID = profile.ClientID })
+	config.fromFile("client_secret", profile.ClientSecret != "", func() { config.ClientSecret = profile.ClientSecret })
+	config.fromFile("redirect_url", profile.RedirectURL != "", func() { config.RedirectURL = profile.RedirectURL })
+	config.fromFile("scopes", len(profile.Scopes) > 0, func() { config.Scopes = profile.Scopes })
+	config.fromFile("token_file", profile.TokenFile != "", func() { config.TokenFile = profile.TokenFile })
+
+	// 環境変数とフラグ
+	// FREEE_CLIENT_ID/FREEE_CLIENT_SECRET はdefaultプロファイルの資格情報であり、名前付きプロファイルには適用しない
+	clientIDEnv, clientSecretEnv := "FREEE_CLIENT_ID", "FREEE_CLIENT_SECRET"
+	if config.ProfileName != domain.DefaultProfileName {
+		clientIDEnv, clientSecretEnv = "", ""
+	}
+	config.setString("client_id", &config.ClientID, clientIDEnv, flags.clientID)
+	config.setString("client_secret", &config.ClientSecret, clientSecretEnv, "")
+	config.setString("redirect_url", &config.RedirectURL, "FREEE_REDIRECT_URL", flags.redirectURL)
+	config.setString("token_file", &config.TokenFile, "FREEE_TOKEN_FILE", flags.tokenFile)
+	config.setString("token_store", &config.TokenStore, "FREEE_TOKEN_STORE", flags.tokenStore)
+	config.setString("token_key_file", &config.TokenKeyFile, "FREEE_TOKEN_KEY_FILE", "")
+	config.setString("token_passphrase", &config.TokenPassphrase, "FREEE_TOKEN_PASSPHRASE", "")
+	config.setString("", &config.PreviousTokenKeyFile, "FREEE_TOKEN_PREVIOUS_KEY_FILE", "")
+	config.setString("", &config.PreviousTokenPassphrase, "FREEE_TOKEN_PREVIOUS_PASSPHRASE", "")
+	config.setString("callback_path", &config.CallbackPath, "FREEE_CALLBACK_PATH", "")
+	config.setString("state_file", &config.StateFile, "FREEE_STATE_FILE", "")
+	config.setString("hook_exec", &config.HookExec, "FREEE_HOOK_EXEC", "")
+	config.setString("hook_webhook", &config.HookWebhook, "FREEE_HOOK_WEBHOOK", "")
+
+	var scopes string
+	config.setString("scopes", &scopes, "FREEE_SCOPES", flags.scopes)
+	if scopes != "" {
+		config.Scopes = splitScopes(scopes)
+	}
+
+	var port, fallbackPorts, authTimeout, httpTimeout, expiryBuffer, retryMaxAttempts, retryMaxElapsed, headless, noBrowser, fakeServer, companyID string
+	if flags.headless {
+		headless = "true"
+	}
+	if flags.noBrowser {
+		noBrowser = "true"
+	}
+	if flags.fakeServer {
+		fakeServer = "true"
+	}
+	if flags.callbackPort != 0 {
+		port = strconv.Itoa(flags.callbackPort)
+	}
+	if flags.authTimeout != 0 {
+		authTimeout = flags.authTimeout.String()
+	}
+	if flags.companyID != 0 {
+		companyID = strconv.FormatInt(flags.companyID, 10)
+	}
+	config.setString("callback_port", &port, "FREEE_CALLBACK_PORT", port)
+	config.setString("callback_fallback_ports", &fallbackPorts, "FREEE_CALLBACK_FALLBACK_PORTS", "")
+	config.setString("auth_timeout", &authTimeout, "FREEE_AUTH_TIMEOUT", authTimeout)
+	config.setString("http_timeout", &httpTimeout, "FREEE_HTTP_TIMEOUT", "")
+	config.setString("expiry_buffer", &expiryBuffer, "FREEE_EXPIRY_BUFFER", "")
+	config.setString("retry_max_attempts", &retryMaxAttempts, "FREEE_RETRY_MAX_ATTEMPTS", "")
+	config.setString("retry_max_elapsed", &retryMaxElapsed, "FREEE_RETRY_MAX_ELAPSED", "")
+	config.setString("headless", &headless, "FREEE_HEADLESS", headless)
+	config.setString("no_browser", &noBrowser, "FREEE_NO_BROWSER", noBrowser)
+	config.setString("fake_server", &fakeServer, "FREEE_FAKE_SERVER", fakeServer)
+	config.setString("company_id", &companyID, "FREEE_COMPANY_ID", companyID)
+	if port != "" {
+		if config.CallbackPort, err = strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("invalid callback port %q: %w", port, err)
+		}
+	}
+	if fallbackPorts != "" {
+		if config.CallbackFallbackPorts, err = parsePorts(fallbackPorts); err != nil {
+			return nil, fmt.Errorf("invalid callback fallback ports %q: %w", fallbackPorts, err)
+		}
+	}
+	if authTimeout != "" {
+		if config.AuthTimeout, err = time.ParseDuration(authTimeout); err != nil {
+			return nil, fmt.Errorf("invalid authorization timeout %q: %w", authTimeout, err)
+		}
+	}
+	if httpTimeout != "" {
+		if config.HTTPTimeout, err = time.ParseDuration(httpTimeout); err != nil {
+			return nil, fmt.Errorf("invalid HTTP timeout %q: %w", httpTimeout, err)
+		}
+	}
+	if expiryBuffer != "" {
+		if config.ExpiryBuffer, err = time.ParseDuration(expiryBuffer); err != nil {
+			return nil, fmt.Errorf("invalid expiry buffer %q: %w", expiryBuffer, err)
+		}
+	}
+	if retryMaxAttempts != "" {
+		if config.RetryMaxAttempts, err = strconv.Atoi(retryMaxAttempts); err != nil {
+			return nil, fmt.Errorf("invalid retry max attempts %q: %w", retryMaxAttempts, err)
+		}
+	}
+	if retryMaxElapsed != "" {
+		if config.RetryMaxElapsed, err = time.ParseDuration(retryMaxElapsed); err != nil {
+			return nil, fmt.Errorf("invalid retry max elapsed %q: %w", retryMaxElapsed, err)
+		}
+	}
+	if headless != "" {
+		if config.Headless, err = strconv.ParseBool(headless); err != nil {
+			return nil, fmt.Errorf("invalid headless setting %q: %w", headless, err)
+		}
+	}
+	if noBrowser != "" {
+		if config.NoBrowser, err = strconv.ParseBool(noBrowser); err != nil {
+			return nil, fmt.Errorf("invalid no-browser setting %q: %w", noBrowser, err)
+		}
+	}
+	if fakeServer != "" {
+		if config.FakeServer, err = strconv.ParseBool(fakeServer); err != nil {
+			return nil, fmt.Errorf("invalid fake-server setting %q: %w", fakeServer, err)
+		}
+	}
+
+	if companyID != "" {
+		if config.CompanyID, err = strconv.ParseInt(companyID, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid company ID %q: %w", companyID, err)
+		}
+	}
+
+	// 未設定の項目を補完
+	if config.RedirectURL == "" {
+		config.RedirectURL = fmt.Sprintf("http://localhost:%d%s", config.CallbackPort, config.CallbackPath)
+		config.sources["redirect_url"] = config.source("callback_port")
+	}
+	if config.TokenFile == "" {
+		config.TokenFile = profileTokenFile(config.ProfileName)
+	}
+	if config.FakeServer {
+		config.applyFakeServerDefaults()
+	}
+
+	return config, nil
+}
+
+// applyFakeServerDefaults は偽の認可サーバーに接続する場合の設定を補完する
+// クライアント認証情報が未設定なら偽のサーバーの既定値を使い、
+// 本物のトークンを上書きしないよう既定のトークンファイルは別の名前にする
+func (c *Config) applyFakeServerDefaults() {
+	if c.ClientID == "" {
+		c.ClientID = freeetest.DefaultClientID
+		c.sources["client_id"] = sourceFakeServer
+	}
+	if c.ClientSecret == "" {
+		c.ClientSecret = freeetest.DefaultClientSecret
+		c.sources["client_secret"] = sourceFakeServer
+	}
+	if c.source("token_file") == sourceDefault {
+		c.TokenFile = strings.TrimSuffix(c.TokenFile, ".json") + ".fake.json"
+		c.sources["token_file"] = sourceFakeServer
+	}
+}
+
+// fromFile は設定ファイルに値がある場合にその値を採用する
+func (c *Config) fromFile(key string, ok bool, apply func()) {
+	if !ok {
+		return
+	}
+	apply()
+	c.sources[key] = sourceFile
+}
+
+// setString は環境変数、フラグの順に値を上書きし、取得元を記録する
+func (c *Config) setString(key string, dst *string, envName, flagValue string) {
+	if v := c.getenv(envName); v != "" {
+		*dst = v
+		if key != "" {
+			c.sources[key] = "env " + envName
+		}
+	}
+	if flagValue != "" {
+		*dst = flagValue
+		if key != "" {
+			c.sources[key] = sourceFlag
+		}
+	}
+}
+
+// source は設定項目の取得元を返す
+func (c *Config) source(key string) string {
+	if s, ok := c.sources[key]; ok {
+		return s
+	}
+	return sourceDefault
+}
+
+// retryPolicy はトークンエンドポイントへのリクエストの再試行の方針を返す
+func (c *Config) retryPolicy() retry.Policy {
+	policy := retry.DefaultPolicy
+	policy.MaxAttempts = c.RetryMaxAttempts
+	policy.MaxElapsed = c.RetryMaxElapsed
+	return policy
+}
+
+// validate はOAuthフローに必要な設定が揃っているかを確認する
+func (c *Config) validate() error {
+	if c.ClientID == "" || c.ClientSecret == "" {
+		if c.ProfileName == domain.DefaultProfileName {
+			return errors.New("FREEE_CLIENT_ID and FREEE_CLIENT_SECRET must be set")
+		}
+		return fmt.Errorf("profile %q must have client_id and client_secret", c.ProfileName)
+	}
+	if c.ExpiryBuffer < 0 {
+		return fmt.Errorf("expiry buffer must not be negative: %s", c.ExpiryBuffer)
+	}
+	switch c.TokenStore {
+	case "", tokenStoreFile, tokenStoreEncrypted:
+	default:
+		return fmt.Errorf("unknown token store backend: %s", c.TokenStore)
+	}
+	return nil
+}
+
+// applyProfileDefaults はプロファイルの未設定項目にデフォルト値を設定する
+func (c *Config) applyProfileDefaults(profile *domain.Profile) {
+	if profile.RedirectURL == "" {
+		profile.RedirectURL = fmt.Sprintf("http://localhost:%d%s", c.CallbackPort, c.CallbackPath)
+	}
+	if profile.TokenFile == "" {
+		profile.TokenFile = profileTokenFile(profile.Name)
+	}
+}
+
+// profileTokenFile はプロファイルのトークンファイルのデフォルトパスを返す
+// default以外のプロファイルのトークンは token.<name>.json に保存する
+func profileTokenFile(name string) string {
+	if name == domain.DefaultProfileName {
+		return defaultTokenFile
+	}
+	return fmt.Sprintf("token.%s.json", name)
+}
+
+// callbackPorts はコールバックサーバーが試すポートを優先順に返す
+// リダイレクトURLにポートが指定されている場合はそのポートを最初に試す
+func (c *Config) callbackPorts() []int {
+	primary := c.CallbackPort
+	if u, err := url.Parse(c.RedirectURL); err == nil && u.Port() != "" {
+		if port, err := strconv.Atoi(u.Port()); err == nil {
+			primary = port
+		}
+	}
+	return append([]int{primary}, c.CallbackFallbackPorts...)
+}
+
+// parsePorts はカンマまたは空白区切りのポート番号のリストを解析する
+func parsePorts(s string) ([]int, error) {
+	var ports []int
+	for _, field := range splitScopes(s) {
+		port, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// splitScopes はカンマまたは空白区切りのスコープ文字列を分割する
+func splitScopes(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// envProfile は環境変数からdefaultプロファイルを構成する
+func (c *Config) envProfile() *domain.Profile {
+	return &domain.Profile{
+		Name:         domain.DefaultProfileName,
+		ClientID:     c.getenv("FREEE_CLIENT_ID"),
+		ClientSecret: c.getenv("FREEE_CLIENT_SECRET"),
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"freee-oauth-app/domain"
+)
+
+const testConfigTOML = `
+[profiles.other]
+client_id = "other-id"
+client_secret = "other-secret"
+`
+
+// setupConfigEnv は設定ファイルを用意し、資格情報だけを設定した環境変数を返す
+func setupConfigEnv(t *testing.T) func(string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(testConfigTOML), 0600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	environ := map[string]string{
+		"FREEE_CONFIG":        path,
+		"FREEE_CLIENT_ID":     "prod-id",
+		"FREEE_CLIENT_SECRET": "prod-secret",
+	}
+	return func(name string) string { return environ[name] }
+}
+
+func TestLoadConfig_ClientEnvAppliesToDefaultProfile(t *testing.T) {
+	getenv := setupConfigEnv(t)
+
+	config, err := loadConfig(&globalFlags{}, getenv)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if config.ProfileName != domain.DefaultProfileName {
+		t.Errorf("expected default profile, got %s", config.ProfileName)
+	}
+	if config.ClientID != "prod-id" || config.ClientSecret != "prod-secret" {
+		t.Errorf("expected credentials from env, got %s/%s", config.ClientID, config.ClientSecret)
+	}
+	if got := config.source("client_id"); got != "env FREEE_CLIENT_ID" {
+		t.Errorf("expected client_id from env, got %s", got)
+	}
+}
+
+func TestLoadConfig_ClientEnvDoesNotOverrideNamedProfile(t *testing.T) {
+	getenv := setupConfigEnv(t)
+
+	config, err := loadConfig(&globalFlags{profile: "other"}, getenv)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if config.ClientID != "other-id" || config.ClientSecret != "other-secret" {
+		t.Errorf("expected credentials from profile, got %s/%s", config.ClientID, config.ClientSecret)
+	}
+	if got := config.source("client_id"); got != sourceFile {
+		t.Errorf("expected client_id from config file, got %s", got)
+	}
+	if got := config.source("client_secret"); got != sourceFile {
+		t.Errorf("expected client_secret from config file, got %s", got)
+	}
+}
+
+func TestLoadConfig_ClientIDFlagOverridesNamedProfile(t *testing.T) {
+	getenv := setupConfigEnv(t)
+
+	config, err := loadConfig(&globalFlags{profile: "other", clientID: "flag-id"}, getenv)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if config.ClientID != "flag-id" {
+		t.Errorf("expected client ID from flag, got %s", config.ClientID)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"freee-oauth-app/domain"
+	"freee-oauth-app/usecase"
+)
+
+// リフレッシュデーモンのデフォルト値
+const (
+	defaultDaemonLead          = 10 * time.Minute
+	defaultDaemonJitter        = 2 * time.Minute
+	defaultDaemonKeepAlive     = 24 * time.Hour
+	defaultDaemonRetryInterval = time.Minute
+)
+
+// parseDaemonFlags は daemon コマンドのフラグを解析する
+// 各フラグのデフォルトは環境変数から取得する
+func parseDaemonFlags(args []string, getenv func(string) string) (*usecase.SchedulerOptions, error) {
+	opts := &usecase.SchedulerOptions{}
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	fs.DurationVar(&opts.Lead, "lead", defaultDaemonLead, "refresh this long before the token expires (env: FREEE_DAEMON_LEAD)")
+	fs.DurationVar(&opts.Jitter, "jitter", defaultDaemonJitter, "refresh up to this much earlier at random (env: FREEE_DAEMON_JITTER)")
+	fs.DurationVar(&opts.KeepAlive, "keep-alive", defaultDaemonKeepAlive, "refresh at least this often to keep the refresh token alive; 0 disables (env: FREEE_DAEMON_KEEP_ALIVE)")
+	fs.DurationVar(&opts.RetryInterval, "retry-interval", defaultDaemonRetryInterval, "wait between attempts after a transient failure (env: FREEE_DAEMON_RETRY_INTERVAL)")
+	for name, env := range map[string]string{
+		"lead":           "FREEE_DAEMON_LEAD",
+		"jitter":         "FREEE_DAEMON_JITTER",
+		"keep-alive":     "FREEE_DAEMON_KEEP_ALIVE",
+		"retry-interval": "FREEE_DAEMON_RETRY_INTERVAL",
+	} {
+		if v := getenv(env); v != "" {
+			if err := fs.Set(name, v); err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %w", env, v, err)
+			}
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	return opts, nil
+}
+
+// runDaemon はトークンを有効期限の前にリフレッシュし続ける
+//
+// トークンを使うツールが長期間起動されなくてもリフレッシュトークンが失効しないよう、
+// 有効期限の --lead 前と --keep-alive ごとにリフレッシュする。
+// SIGINT/SIGTERMで終了し、再認可が必要になった場合はエラーで終了する。
+func (app *App) runDaemon(ctx context.Context, args []string) error {
+	opts, err := parseDaemonFlags(args, app.config.getenv)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts.OnRefresh = func(token *domain.Token) {
+		log.Printf("Token refreshed (expires %s)", token.Expiry.Format(time.RFC3339))
+		if app.oauthUseCase.ExpiryPolicy().RefreshTokenExpiring(token) {
+			log.Printf("Warning: the refresh token expires %s. Run 'login' to re-authorize before it lapses.",
+				token.RefreshTokenExpiry.Format(time.RFC3339))
+		}
+	}
+	opts.OnError = func(err error, retryAt time.Time) {
+		if retryAt.IsZero() {
+			log.Printf("Token refresh failed: %v", err)
+			return
+		}
+		log.Printf("Token refresh failed, retrying at %s: %v", retryAt.Format(time.RFC3339), err)
+	}
+
+	log.Printf("Refreshing %s %s before expiry (keep-alive %s)", app.config.TokenFile, opts.Lead, opts.KeepAlive)
+	err = usecase.NewRefreshScheduler(app.oauthUseCase, *opts).Run(ctx)
+	if errors.Is(err, usecase.ErrNoToken) {
+		return fmt.Errorf("no token (run 'login' first): %w", err)
+	}
+	if err != nil {
+		return explainAuthError(err, "refresh daemon stopped")
+	}
+	log.Println("Refresh daemon stopped")
+	return nil
+}
@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrAuthorizationNotFound は指定されたstateの認可リクエストが存在しない（使用済みを含む）ことを表す
+	ErrAuthorizationNotFound = errors.New("pending authorization not found")
+	// ErrAuthorizationExpired は認可リクエストの有効期限が切れていることを表す
+	ErrAuthorizationExpired = errors.New("pending authorization expired")
+)
+
+// PendingAuthorization は開始済みで完了していない認可リクエストを表す
+// 認可コードの交換に必要なPKCEのコードベリファイアとリダイレクトURLを保持する
+type PendingAuthorization struct {
+	State        string
+	CodeVerifier string
+	RedirectURL  string
+	// Profile は認可を開始したプロファイル名
+	Profile   string
+	CreatedAt time.Time
+}
+
+// IsExpired は認可リクエストが作成から ttl を過ぎているかを判定する
+func (a *PendingAuthorization) IsExpired(now time.Time, ttl time.Duration) bool {
+	return now.Sub(a.CreatedAt) > ttl
+}
@@ -0,0 +1,18 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPendingAuthorization_IsExpired(t *testing.T) {
+	now := time.Now()
+	auth := &PendingAuthorization{State: "state", CreatedAt: now.Add(-10 * time.Minute)}
+
+	if !auth.IsExpired(now, 5*time.Minute) {
+		t.Error("expected authorization older than TTL to be expired")
+	}
+	if auth.IsExpired(now, 15*time.Minute) {
+		t.Error("expected authorization within TTL to be valid")
+	}
+}
@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"sync"
+	"time"
+)
+
+// minObservableSkew はDateヘッダから補正するずれの最小値
+// Dateヘッダは秒単位のため、これより小さいずれは誤差とみなして補正しない
+const minObservableSkew = 2 * time.Second
+
+// Clock は現在時刻を返す
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc は関数をClockとして扱う
+type ClockFunc func() time.Time
+
+// Now は f() を返す
+func (f ClockFunc) Now() time.Time { return f() }
+
+// SystemClock はシステムの時計
+var SystemClock Clock = ClockFunc(time.Now)
+
+// ClockSkew は認可サーバーとローカルの時計のずれを記録する
+//
+// freeeはトークンの発行時刻（created_at）を認可サーバーの時刻で返すため、ローカルの時計がずれていると
+// 有効期限もずれる。トークンエンドポイントのレスポンスの Date ヘッダを Observe に渡し、
+// 認可サーバーの時刻は Local でローカルの時計の時刻に変換してから保存する。
+type ClockSkew struct {
+	clock Clock
+
+	mu   sync.Mutex
+	skew time.Duration
+}
+
+// NewClockSkew はローカルの時計 clock に対するずれを記録する新しいClockSkewを生成する
+func NewClockSkew(clock Clock) *ClockSkew {
+	return &ClockSkew{clock: clock}
+}
+
+// Now はローカルの時計の現在時刻を返す
+func (s *ClockSkew) Now() time.Time {
+	return s.clock.Now()
+}
+
+// Skew は観測した認可サーバーの時刻とローカルの時刻の差を返す（認可サーバーが進んでいる場合は正）
+func (s *ClockSkew) Skew() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.skew
+}
+
+// Observe は認可サーバーがレスポンスを返した時刻から、ローカルの時計とのずれを記録する
+func (s *ClockSkew) Observe(serverTime time.Time) {
+	skew := serverTime.Sub(s.clock.Now())
+	if skew.Abs() < minObservableSkew {
+		skew = 0
+	}
+	s.mu.Lock()
+	s.skew = skew
+	s.mu.Unlock()
+}
+
+// Local は認可サーバーの時刻をローカルの時計の時刻に変換する
+func (s *ClockSkew) Local(serverTime time.Time) time.Time {
+	return serverTime.Add(-s.Skew())
+}
+
+// ExpiryPolicy はトークンの有効期限の判定方法
+type ExpiryPolicy struct {
+	Clock Clock
+	// Buffer は有効期限のこの時間前からトークンを無効とみなす
+	Buffer time.Duration
+}
+
+// DefaultExpiryPolicy はシステムの時計で、有効期限の5分前から無効とみなす
+var DefaultExpiryPolicy = ExpiryPolicy{Clock: SystemClock, Buffer: DefaultExpiryBuffer}
+
+// IsValid はトークンが有効かどうかを判定する
+func (p ExpiryPolicy) IsValid(t *Token) bool {
+	return t.IsValidAt(p.Clock.Now(), p.Buffer)
+}
+
+// NeedsRefresh はトークンのリフレッシュが必要かつ可能かを判定する
+func (p ExpiryPolicy) NeedsRefresh(t *Token) bool {
+	return !p.IsValid(t) && t.HasRefreshToken()
+}
+
+// Remaining はトークンの有効期限までの残り時間を返す（期限切れの場合は負）
+func (p ExpiryPolicy) Remaining(t *Token) time.Duration {
+	return t.Expiry.Sub(p.Clock.Now())
+}
+
+// RefreshTokenRemaining はリフレッシュトークンの有効期限までの残り時間を返す
+// 有効期限が不明な場合は ok が false になる
+func (p ExpiryPolicy) RefreshTokenRemaining(t *Token) (remaining time.Duration, ok bool) {
+	if !t.HasRefreshToken() || t.RefreshTokenExpiry.IsZero() {
+		return 0, false
+	}
+	return t.RefreshTokenExpiry.Sub(p.Clock.Now()), true
+}
+
+// RefreshTokenExpiring はリフレッシュトークンが RefreshTokenWarningPeriod 以内に失効するかを判定する
+func (p ExpiryPolicy) RefreshTokenExpiring(t *Token) bool {
+	return t.RefreshTokenExpiresWithin(p.Clock.Now(), RefreshTokenWarningPeriod)
+}
@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func fixedClock(now time.Time) Clock {
+	return ClockFunc(func() time.Time { return now })
+}
+
+func TestExpiryPolicy_UsesClockAndBuffer(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	token := NewToken("access", "refresh", now.Add(10*time.Minute))
+
+	tests := []struct {
+		name   string
+		policy ExpiryPolicy
+		valid  bool
+	}{
+		{"default buffer", ExpiryPolicy{Clock: fixedClock(now), Buffer: DefaultExpiryBuffer}, true},
+		{"larger buffer", ExpiryPolicy{Clock: fixedClock(now), Buffer: 15 * time.Minute}, false},
+		{"later clock", ExpiryPolicy{Clock: fixedClock(now.Add(6 * time.Minute)), Buffer: DefaultExpiryBuffer}, false},
+		{"no buffer", ExpiryPolicy{Clock: fixedClock(now.Add(9 * time.Minute)), Buffer: 0}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.IsValid(token); got != tt.valid {
+				t.Errorf("expected valid=%t, got %t", tt.valid, got)
+			}
+			if got := tt.policy.NeedsRefresh(token); got == tt.valid {
+				t.Errorf("expected needsRefresh=%t, got %t", !tt.valid, got)
+			}
+		})
+	}
+}
+
+func TestExpiryPolicy_Remaining(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	policy := ExpiryPolicy{Clock: fixedClock(now)}
+
+	if got := policy.Remaining(NewToken("access", "", now.Add(time.Hour))); got != time.Hour {
+		t.Errorf("expected 1h remaining, got %s", got)
+	}
+}
+
+func TestExpiryPolicy_RefreshTokenRemaining(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	policy := ExpiryPolicy{Clock: fixedClock(now)}
+	token := &Token{RefreshToken: "refresh", RefreshTokenExpiry: now.Add(48 * time.Hour)}
+
+	remaining, ok := policy.RefreshTokenRemaining(token)
+	if !ok || remaining != 48*time.Hour {
+		t.Errorf("expected 48h remaining, got %s (ok=%t)", remaining, ok)
+	}
+	if !policy.RefreshTokenExpiring(token) {
+		t.Error("expected the refresh token to be reported as expiring")
+	}
+	if _, ok := policy.RefreshTokenRemaining(&Token{RefreshToken: "refresh"}); ok {
+		t.Error("expected unknown remaining time without an expiry")
+	}
+}
+
+func TestClockSkew_ConvertsServerTime(t *testing.T) {
+	local := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	skew := NewClockSkew(ClockFunc(func() time.Time { return local }))
+
+	if got := skew.Local(local); !got.Equal(local) {
+		t.Errorf("expected no conversion before observation, got %v", got)
+	}
+
+	// 認可サーバーの時計が3分進んでいる
+	skew.Observe(local.Add(3 * time.Minute))
+
+	if got := skew.Skew(); got != 3*time.Minute {
+		t.Errorf("expected 3m skew, got %s", got)
+	}
+	issuedAt := local.Add(3*time.Minute - 30*time.Second)
+	if want := local.Add(-30 * time.Second); !skew.Local(issuedAt).Equal(want) {
+		t.Errorf("expected %v, got %v", want, skew.Local(issuedAt))
+	}
+}
+
+func TestClockSkew_IgnoresSubSecondPrecision(t *testing.T) {
+	local := time.Date(2025, 1, 1, 12, 0, 0, 900_000_000, time.UTC)
+	skew := NewClockSkew(fixedClock(local))
+	skew.Observe(local.Add(3 * time.Minute))
+
+	// Dateヘッダは秒単位に切り捨てられるため、1秒程度のずれは補正しない
+	skew.Observe(local.Truncate(time.Second))
+
+	if got := skew.Skew(); got != 0 {
+		t.Errorf("expected skew to be reset, got %s", got)
+	}
+}
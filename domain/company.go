@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrCompanyNotFound は指定された事業所にユーザーがアクセスできないことを表す
+var ErrCompanyNotFound = errors.New("company not found")
+
+// Company はユーザーがアクセスできるfreeeの事業所を表す
+// freee APIの呼び出しには事業所のIDが必要になる
+type Company struct {
+	ID          int64
+	Name        string
+	DisplayName string
+	// Role は事業所でのユーザーの権限（admin, simple_accounting など）
+	Role string
+}
+
+// Label は一覧表示用の事業所名を返す（表示名がなければ名前、どちらもなければID）
+func (c *Company) Label() string {
+	switch {
+	case c.DisplayName != "":
+		return c.DisplayName
+	case c.Name != "":
+		return c.Name
+	default:
+		return strconv.FormatInt(c.ID, 10)
+	}
+}
+
+// FindCompany は companies から id の事業所を探す
+func FindCompany(companies []Company, id int64) (*Company, error) {
+	for i := range companies {
+		if companies[i].ID == id {
+			return &companies[i], nil
+		}
+	}
+	return nil, ErrCompanyNotFound
+}
@@ -0,0 +1,30 @@
+package domain
+
+import "time"
+
+// EventType はトークンのライフサイクルイベントの種類
+type EventType string
+
+const (
+	// EventTokenObtained は認可フローで新しいトークンを取得したことを表す
+	EventTokenObtained EventType = "token.obtained"
+	// EventTokenRefreshed はトークンをリフレッシュして保存したことを表す
+	EventTokenRefreshed EventType = "token.refreshed"
+	// EventRefreshFailed はリフレッシュに失敗したことを表す
+	// 認可サーバーがリフレッシュを拒否・失敗した場合と、リフレッシュしたトークンの保存に失敗した場合に発行する
+	EventRefreshFailed EventType = "token.refresh_failed"
+	// EventTokenDeleted は保存されているトークンを削除したことを表す
+	EventTokenDeleted EventType = "token.deleted"
+)
+
+// Event はトークンのライフサイクルイベント
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Token は取得・リフレッシュしたトークン（それ以外のイベントではnil）
+	Token *Token
+	// RefreshTokenRotated はリフレッシュでリフレッシュトークンが更新されたかを表す
+	RefreshTokenRotated bool
+	// Err はリフレッシュまたはリフレッシュしたトークンの保存に失敗した原因（EventRefreshFailed のみ）
+	Err error
+}
@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// OAuthのエラーコード（RFC 6749 5.2, 4.1.2.1）
+const (
+	ErrorCodeInvalidRequest         = "invalid_request"
+	ErrorCodeInvalidClient          = "invalid_client"
+	ErrorCodeInvalidGrant           = "invalid_grant"
+	ErrorCodeUnauthorizedClient     = "unauthorized_client"
+	ErrorCodeInvalidScope           = "invalid_scope"
+	ErrorCodeServerError            = "server_error"
+	ErrorCodeTemporarilyUnavailable = "temporarily_unavailable"
+)
+
+// OAuthErrorを分類するためのエラー（errors.Is で判定する）
+var (
+	// ErrInvalidGrant は認可コードまたはリフレッシュトークンが無効・期限切れ・失効済みであることを表す
+	ErrInvalidGrant = errors.New("invalid grant")
+	// ErrInvalidClient はクライアント認証情報が誤っていることを表す
+	ErrInvalidClient = errors.New("invalid client")
+	// ErrTransient は時間をおいて再試行すれば成功する可能性がある一時的な障害を表す
+	ErrTransient = errors.New("transient failure")
+)
+
+// OAuthError は認可サーバーとの通信で発生したエラー
+//
+// エラーレスポンスのエラーコード・説明・HTTPステータスを保持し、元のエラー
+// （*oauth2.RetrieveError やネットワークエラー）を errors.As で取り出せる。
+// StatusCode が0の場合は、レスポンスを受け取る前に失敗したことを表す。
+type OAuthError struct {
+	// Op は失敗した操作（"exchange" / "refresh" / "revoke"）
+	Op          string
+	Code        string
+	Description string
+	StatusCode  int
+	// Unsent はリクエストを送信する前に失敗したこと（接続エラーなど）を表す
+	// falseかつ StatusCode が0の場合は、認可サーバーがリクエストを処理した可能性がある
+	Unsent bool
+	Err    error
+}
+
+func (e *OAuthError) Error() string {
+	msg := e.Op
+	switch {
+	case e.Code != "" && e.Description != "":
+		msg += fmt.Sprintf(": %s: %s", e.Code, e.Description)
+	case e.Code != "":
+		msg += ": " + e.Code
+	case e.StatusCode != 0:
+		msg += ": " + http.StatusText(e.StatusCode)
+	}
+	if e.Err != nil && e.Code == "" {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *OAuthError) Unwrap() error {
+	return e.Err
+}
+
+// Is はエラーコードとHTTPステータスから ErrInvalidGrant・ErrInvalidClient・ErrTransient に分類する
+func (e *OAuthError) Is(target error) bool {
+	switch target {
+	case ErrInvalidGrant:
+		return e.Code == ErrorCodeInvalidGrant
+	case ErrInvalidClient:
+		return e.Code == ErrorCodeInvalidClient || e.Code == ErrorCodeUnauthorizedClient
+	case ErrTransient:
+		return e.IsTransient()
+	}
+	return false
+}
+
+// IsTransient は再試行で回復する可能性のあるエラーかを判定する
+// ネットワークエラー、5xx、429、temporarily_unavailable・server_error が該当する
+func (e *OAuthError) IsTransient() bool {
+	switch e.Code {
+	case ErrorCodeTemporarilyUnavailable, ErrorCodeServerError:
+		return true
+	case "":
+	default:
+		return false
+	}
+	return e.StatusCode == 0 || e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// IsRetryableGrant は認可コード・リフレッシュトークンを使うリクエストを再試行してよいかを判定する
+//
+// 一時的な障害のうち、リクエストを送信する前の失敗と、認可サーバーがエラーで応答した場合が該当する。
+// 送信した後に応答を受け取れなかった場合（タイムアウトや接続の切断）は、認可サーバーが
+// グラントを消費済みの可能性があり、再試行すると invalid_grant で失敗するため該当しない。
+func (e *OAuthError) IsRetryableGrant() bool {
+	return e.IsTransient() && (e.StatusCode != 0 || e.Unsent)
+}
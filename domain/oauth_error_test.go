@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestOAuthError_Classification(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       *OAuthError
+		grant     bool
+		client    bool
+		transient bool
+	}{
+		{"invalid_grant", &OAuthError{Op: "refresh", Code: ErrorCodeInvalidGrant, StatusCode: http.StatusBadRequest}, true, false, false},
+		{"invalid_client", &OAuthError{Op: "refresh", Code: ErrorCodeInvalidClient, StatusCode: http.StatusUnauthorized}, false, true, false},
+		{"temporarily_unavailable", &OAuthError{Op: "refresh", Code: ErrorCodeTemporarilyUnavailable, StatusCode: http.StatusBadRequest}, false, false, true},
+		{"503 without code", &OAuthError{Op: "refresh", StatusCode: http.StatusServiceUnavailable}, false, false, true},
+		{"429", &OAuthError{Op: "refresh", StatusCode: http.StatusTooManyRequests}, false, false, true},
+		{"network error", &OAuthError{Op: "refresh", Err: errors.New("connection refused")}, false, false, true},
+		{"400 without code", &OAuthError{Op: "refresh", StatusCode: http.StatusBadRequest}, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// ラップされていても分類できる
+			err := fmt.Errorf("wrapped: %w", tt.err)
+			if got := errors.Is(err, ErrInvalidGrant); got != tt.grant {
+				t.Errorf("errors.Is(ErrInvalidGrant) = %t, want %t", got, tt.grant)
+			}
+			if got := errors.Is(err, ErrInvalidClient); got != tt.client {
+				t.Errorf("errors.Is(ErrInvalidClient) = %t, want %t", got, tt.client)
+			}
+			if got := errors.Is(err, ErrTransient); got != tt.transient {
+				t.Errorf("errors.Is(ErrTransient) = %t, want %t", got, tt.transient)
+			}
+		})
+	}
+}
+
+func TestOAuthError_IsRetryableGrant(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *OAuthError
+		want bool
+	}{
+		{"connect error", &OAuthError{Op: "refresh", Unsent: true, Err: errors.New("connection refused")}, true},
+		{"no response after sending", &OAuthError{Op: "refresh", Err: errors.New("timeout awaiting response headers")}, false},
+		{"503", &OAuthError{Op: "refresh", StatusCode: http.StatusServiceUnavailable}, true},
+		{"temporarily_unavailable", &OAuthError{Op: "refresh", Code: ErrorCodeTemporarilyUnavailable, StatusCode: http.StatusBadRequest}, true},
+		{"invalid_grant", &OAuthError{Op: "refresh", Code: ErrorCodeInvalidGrant, StatusCode: http.StatusBadRequest}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.IsRetryableGrant(); got != tt.want {
+				t.Errorf("IsRetryableGrant() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOAuthError_UnwrapsCause(t *testing.T) {
+	cause := errors.New("dial tcp: connection refused")
+	err := fmt.Errorf("wrapped: %w", &OAuthError{Op: "exchange", Err: cause})
+
+	if !errors.Is(err, cause) {
+		t.Error("expected cause to be reachable with errors.Is")
+	}
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) || oauthErr.Op != "exchange" {
+		t.Errorf("expected OAuthError to be reachable with errors.As, got %v", oauthErr)
+	}
+}
+
+func TestOAuthError_Error(t *testing.T) {
+	err := &OAuthError{Op: "refresh", Code: ErrorCodeInvalidGrant, Description: "refresh token revoked", StatusCode: 400}
+	if got := err.Error(); got != "refresh: invalid_grant: refresh token revoked" {
+		t.Errorf("unexpected message: %s", got)
+	}
+}
@@ -0,0 +1,20 @@
+package domain
+
+import "errors"
+
+// DefaultProfileName はプロファイル未指定時に使用されるプロファイル名
+const DefaultProfileName = "default"
+
+// ErrProfileNotFound は指定されたプロファイルが存在しないことを表す
+var ErrProfileNotFound = errors.New("profile not found")
+
+// Profile はfreeeアプリごとの接続設定を表す
+// クライアント認証情報・スコープ・リダイレクトURL・トークンの保存先をまとめて管理する
+type Profile struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	TokenFile    string
+}
@@ -7,14 +7,49 @@ type TokenRepository interface {
 	Save(ctx context.Context, token *Token) error
 	Load(ctx context.Context) (*Token, error)
 	Exists(ctx context.Context) bool
+	Delete(ctx context.Context) error
+}
+
+// TokenLocker はトークンの読み込み・リフレッシュ・保存を複数プロセス間で排他制御する
+// TokenRepository の実装が任意で実装する
+type TokenLocker interface {
+	// Lock はロックを取得し、解放する関数を返す
+	Lock(ctx context.Context) (unlock func(), err error)
+}
+
+// StateStore は開始済みの認可リクエストをstateをキーに保持するストアのインターフェース
+// 複数の認可リクエストを同時に保持でき、各リクエストは有効期限内に1回だけ取り出せる
+type StateStore interface {
+	Save(ctx context.Context, auth *PendingAuthorization) error
+	// Consume は認可リクエストを取り出して削除する
+	// 存在しない場合は ErrAuthorizationNotFound、期限切れの場合は ErrAuthorizationExpired を返す
+	Consume(ctx context.Context, state string) (*PendingAuthorization, error)
+}
+
+// ProfileRepository はプロファイル設定の取得を担当するリポジトリのインターフェース
+type ProfileRepository interface {
+	List(ctx context.Context) ([]*Profile, error)
+	Get(ctx context.Context, name string) (*Profile, error)
 }
 
 // OAuthProvider はOAuth認可フローを担当するプロバイダーのインターフェース
 type OAuthProvider interface {
-	// AuthorizationURL は認可URLを生成する
-	AuthorizationURL(state string) string
-	// Exchange は認可コードをトークンに交換する
-	Exchange(ctx context.Context, code string) (*Token, error)
+	// Scopes は認可時に要求するスコープを返す
+	Scopes() []string
+	// AuthorizationURL はPKCE(S256)のコードチャレンジ付きの認可URLを生成する
+	// redirectURL が空の場合は設定済みのリダイレクトURLを使用する
+	AuthorizationURL(state, codeVerifier, redirectURL string) string
+	// Exchange は認可コードをコードベリファイアと共にトークンに交換する
+	// redirectURL には認可URLの生成時と同じ値を指定する
+	Exchange(ctx context.Context, code, codeVerifier, redirectURL string) (*Token, error)
 	// Refresh はリフレッシュトークンを使用してトークンを更新する
 	Refresh(ctx context.Context, token *Token) (*Token, error)
+	// Revoke はトークンを認可サーバー上で無効化する
+	Revoke(ctx context.Context, token *Token) error
+}
+
+// CompanyDirectory はユーザーがアクセスできる事業所の取得を担当するインターフェース
+type CompanyDirectory interface {
+	// Companies はアクセストークンのユーザーがアクセスできる事業所を返す
+	Companies(ctx context.Context, token *Token) ([]Company, error)
 }
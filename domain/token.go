@@ -1,14 +1,17 @@
 package domain
 
 import (
+	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
 )
 
 const (
-	// トークンが無効とみなされる残り時間のしきい値
-	tokenExpiryBuffer = 5 * time.Minute
+	// DefaultExpiryBuffer はトークンが無効とみなされる残り時間のしきい値の既定値
+	DefaultExpiryBuffer = 5 * time.Minute
+	// RefreshTokenWarningPeriod はリフレッシュトークンの失効が近いと警告する残り時間
+	RefreshTokenWarningPeriod = 7 * 24 * time.Hour
 	// マスク表示時の文字数
 	maskedTokenLength = 20
 )
@@ -18,6 +21,21 @@ type Token struct {
 	AccessToken  string
 	RefreshToken string
 	Expiry       time.Time
+	// Scopes は付与されたスコープ（不明な場合は空）
+	Scopes []string
+	// TokenType はトークンの種類（不明な場合は空）
+	TokenType string
+	// IssuedAt はトークンの発行時刻（不明な場合はゼロ値）
+	IssuedAt time.Time
+	// RefreshTokenExpiry はリフレッシュトークンの有効期限（不明または無期限の場合はゼロ値）
+	RefreshTokenExpiry time.Time
+	// CompanyID は認可時に選択された事業所のID（不明な場合は0）
+	CompanyID int64
+	// Extra はトークンレスポンスのうちRFC 6749で定義されていないフィールド（created_at など）
+	Extra map[string]any
+	// DefaultCompany はAPIの呼び出しに使う既定の事業所（未選択の場合はnil）
+	// トークンと共に保存し、トークンを使うツールが読み込めるようにする
+	DefaultCompany *Company
 }
 
 // NewToken は新しいTokenを生成する
@@ -29,15 +47,21 @@ func NewToken(accessToken, refreshToken string, expiry time.Time) *Token {
 	}
 }
 
-// IsValid はトークンが有効かどうかを判定する
-// 有効期限の5分前から無効とみなす
+// IsValid はシステムの時計でトークンが有効かどうかを判定する
+// 有効期限の5分前から無効とみなす（時計・しきい値を指定する場合は ExpiryPolicy を使う）
 func (t *Token) IsValid() bool {
-	return time.Now().Add(tokenExpiryBuffer).Before(t.Expiry)
+	return DefaultExpiryPolicy.IsValid(t)
 }
 
-// NeedsRefresh はトークンのリフレッシュが必要かつ可能かを判定する
+// IsValidAt は now の時点でトークンが有効かどうかを判定する
+// 有効期限の buffer 前から無効とみなす
+func (t *Token) IsValidAt(now time.Time, buffer time.Duration) bool {
+	return now.Add(buffer).Before(t.Expiry)
+}
+
+// NeedsRefresh はトークンのリフレッシュが必要かつ可能かをシステムの時計で判定する
 func (t *Token) NeedsRefresh() bool {
-	return !t.IsValid() && t.HasRefreshToken()
+	return DefaultExpiryPolicy.NeedsRefresh(t)
 }
 
 // HasRefreshToken はリフレッシュトークンを持っているかを判定する
@@ -45,6 +69,33 @@ func (t *Token) HasRefreshToken() bool {
 	return t.RefreshToken != ""
 }
 
+// HasScopes は要求されたスコープがすべて付与されているかを判定する
+// 付与されたスコープが不明なトークン（スコープ記録前に保存されたもの）は判定できないため true を返す
+func (t *Token) HasScopes(required []string) bool {
+	if len(t.Scopes) == 0 {
+		return true
+	}
+	granted := make(map[string]bool, len(t.Scopes))
+	for _, s := range t.Scopes {
+		granted[s] = true
+	}
+	for _, s := range required {
+		if !granted[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// RefreshTokenExpiresWithin は now から d 以内にリフレッシュトークンが失効するかを判定する
+// 有効期限が不明なリフレッシュトークンは false を返す
+func (t *Token) RefreshTokenExpiresWithin(now time.Time, d time.Duration) bool {
+	if !t.HasRefreshToken() || t.RefreshTokenExpiry.IsZero() {
+		return false
+	}
+	return !now.Add(d).Before(t.RefreshTokenExpiry)
+}
+
 // MaskedAccessToken はマスクされたアクセストークンを返す
 func (t *Token) MaskedAccessToken() string {
 	if len(t.AccessToken) <= maskedTokenLength {
@@ -58,15 +109,22 @@ func (t *Token) ToOAuth2Token() *oauth2.Token {
 	return &oauth2.Token{
 		AccessToken:  t.AccessToken,
 		RefreshToken: t.RefreshToken,
+		TokenType:    t.TokenType,
 		Expiry:       t.Expiry,
 	}
 }
 
 // FromOAuth2Token はoauth2.Tokenからdomain.Tokenを生成する
+// トークンレスポンスの scope（スペース区切り）を付与されたスコープとして記録する
 func FromOAuth2Token(t *oauth2.Token) *Token {
-	return &Token{
+	token := &Token{
 		AccessToken:  t.AccessToken,
 		RefreshToken: t.RefreshToken,
+		TokenType:    t.TokenType,
 		Expiry:       t.Expiry,
 	}
+	if scope, ok := t.Extra("scope").(string); ok {
+		token.Scopes = strings.Fields(scope)
+	}
+	return token
 }
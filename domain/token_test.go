@@ -3,6 +3,8 @@ package domain
 import (
 	"testing"
 	"time"
+
+	"golang.org/x/oauth2"
 )
 
 func TestNewToken(t *testing.T) {
@@ -95,3 +97,72 @@ func TestToken_MaskedAccessToken_ShortToken(t *testing.T) {
 		t.Errorf("expected 'short', got '%s'", masked)
 	}
 }
+
+func TestToken_HasScopes(t *testing.T) {
+	token := NewToken("access", "refresh", time.Now())
+	token.Scopes = []string{"read", "write"}
+
+	if !token.HasScopes([]string{"read"}) {
+		t.Error("token should have read scope")
+	}
+	if !token.HasScopes([]string{"read", "write"}) {
+		t.Error("token should have read and write scopes")
+	}
+	if token.HasScopes([]string{"read", "admin"}) {
+		t.Error("token should not have admin scope")
+	}
+}
+
+func TestToken_HasScopes_WhenUnknown(t *testing.T) {
+	token := NewToken("access", "refresh", time.Now())
+
+	if !token.HasScopes([]string{"read", "write"}) {
+		t.Error("token with unknown scopes should be treated as sufficient")
+	}
+}
+
+func TestFromOAuth2Token_Scopes(t *testing.T) {
+	oauth2Token := (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]interface{}{
+		"scope": "read write",
+	})
+
+	token := FromOAuth2Token(oauth2Token)
+
+	if len(token.Scopes) != 2 || token.Scopes[0] != "read" || token.Scopes[1] != "write" {
+		t.Errorf("expected scopes [read write], got %v", token.Scopes)
+	}
+}
+
+func TestFromOAuth2Token_TokenType(t *testing.T) {
+	token := FromOAuth2Token(&oauth2.Token{AccessToken: "access", TokenType: "bearer"})
+
+	if token.TokenType != "bearer" {
+		t.Errorf("expected token type 'bearer', got %q", token.TokenType)
+	}
+	if got := token.ToOAuth2Token().Type(); got != "Bearer" {
+		t.Errorf("expected Authorization type 'Bearer', got %q", got)
+	}
+}
+
+func TestToken_RefreshTokenExpiresWithin(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		token    *Token
+		expiring bool
+	}{
+		{"unknown expiry", &Token{RefreshToken: "refresh"}, false},
+		{"no refresh token", &Token{RefreshTokenExpiry: now.Add(time.Hour)}, false},
+		{"far from expiry", &Token{RefreshToken: "refresh", RefreshTokenExpiry: now.Add(30 * 24 * time.Hour)}, false},
+		{"within period", &Token{RefreshToken: "refresh", RefreshTokenExpiry: now.Add(3 * 24 * time.Hour)}, true},
+		{"expired", &Token{RefreshToken: "refresh", RefreshTokenExpiry: now.Add(-time.Hour)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.token.RefreshTokenExpiresWithin(now, RefreshTokenWarningPeriod); got != tt.expiring {
+				t.Errorf("expected %t, got %t", tt.expiring, got)
+			}
+		})
+	}
+}
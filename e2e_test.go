@@ -0,0 +1,601 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"freee-oauth-app/domain"
+	"freee-oauth-app/infrastructure/freee/freeetest"
+	httphandler "freee-oauth-app/interface/http"
+	"freee-oauth-app/usecase"
+)
+
+// e2eHarness は偽の認可サーバーに対してコマンドを実行する
+type e2eHarness struct {
+	t      *testing.T
+	server *freeetest.Server
+	config *Config
+	// env は各コマンドの実行に使う外部環境（テストごとに差し替える）
+	env environment
+	// serverNow は偽の認可サーバーの現在時刻
+	serverNow time.Time
+}
+
+// newE2EHarness は偽の認可サーバーを起動し、テスト用の環境変数から設定を読み込む
+func newE2EHarness(t *testing.T, opts freeetest.Options) *e2eHarness {
+	t.Helper()
+	h := &e2eHarness{t: t, serverNow: time.Now()}
+	opts.Now = func() time.Time { return h.serverNow }
+	server, err := freeetest.NewServer(opts)
+	if err != nil {
+		t.Fatalf("failed to start fake server: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	h.server = server
+
+	// 実行環境の設定の影響を受けないよう、空の環境変数に必要な項目だけを設定する
+	dir := t.TempDir()
+	environ := map[string]string{
+		"FREEE_CONFIG":        filepath.Join(dir, "config.toml"),
+		"FREEE_CLIENT_ID":     freeetest.DefaultClientID,
+		"FREEE_CLIENT_SECRET": freeetest.DefaultClientSecret,
+		"FREEE_REDIRECT_URL":  "http://127.0.0.1:0/callback",
+		"FREEE_TOKEN_FILE":    filepath.Join(dir, "token.json"),
+	}
+	config, err := loadConfig(&globalFlags{}, func(name string) string { return environ[name] })
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if err := config.validate(); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	h.config = config
+
+	h.env = environment{
+		stderr:   io.Discard,
+		stdin:    strings.NewReader(""),
+		now:      time.Now,
+		after:    time.After,
+		listen:   httphandler.ListenLoopback,
+		endpoint: fakeServerEndpoint(server),
+		browser:  server,
+	}
+	return h
+}
+
+// run はコマンドを実行し、標準出力への出力を返す
+func (h *e2eHarness) run(args ...string) (string, error) {
+	h.t.Helper()
+	var stdout bytes.Buffer
+	env := h.env
+	env.stdout = &stdout
+	if h.env.stdout != nil {
+		env.stdout = io.MultiWriter(&stdout, h.env.stdout)
+	}
+	app, err := newApp(h.config, env)
+	if err != nil {
+		h.t.Fatalf("failed to initialize app: %v", err)
+	}
+	defer app.Close()
+	err = app.Run(args)
+	return stdout.String(), err
+}
+
+// mustRun はコマンドを実行し、失敗した場合はテストを中断する
+func (h *e2eHarness) mustRun(args ...string) string {
+	h.t.Helper()
+	out, err := h.run(args...)
+	if err != nil {
+		h.t.Fatalf("%v failed: %v\n%s", args, err, out)
+	}
+	return out
+}
+
+// accessToken は保存されているアクセストークンを返す
+func (h *e2eHarness) accessToken() string {
+	h.t.Helper()
+	out := h.mustRun("token")
+	return strings.TrimSpace(out)
+}
+
+// readToken は保存されているトークンを読み込む
+func (h *e2eHarness) readToken() (*domain.Token, error) {
+	repo, err := newTokenRepository(h.config)
+	if err != nil {
+		return nil, err
+	}
+	return repo.Load(context.Background())
+}
+
+// pasteInput は利用者の代わりに、表示された認可URLにアクセスしてリダイレクト先のURLを標準入力に貼り付ける
+// 標準出力と標準入力の両方として使い、リダイレクト先のURLと rest を1回の Read でまとめて返す
+type pasteInput struct {
+	server *freeetest.Server
+	rest   string
+
+	mu     sync.Mutex
+	output bytes.Buffer
+	input  *strings.Reader
+}
+
+func (p *pasteInput) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.output.Write(b)
+}
+
+func (p *pasteInput) Read(b []byte) (int, error) {
+	if p.input == nil {
+		redirect, err := p.authorize()
+		if err != nil {
+			return 0, err
+		}
+		p.input = strings.NewReader(redirect + "\n" + p.rest)
+	}
+	return p.input.Read(b)
+}
+
+// authorize は表示された認可URLにアクセスし、リダイレクト先のURLを返す
+func (p *pasteInput) authorize() (string, error) {
+	p.mu.Lock()
+	output := p.output.String()
+	p.mu.Unlock()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.HasPrefix(line, p.server.AuthURL()) {
+			continue
+		}
+		resp, err := client.Get(line)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		return resp.Header.Get("Location"), nil
+	}
+	return "", errors.New("authorization URL was not shown")
+}
+
+// openerFunc は関数をbrowser.Openerとして扱う
+type openerFunc func(url string) error
+
+func (f openerFunc) Open(url string) error { return f(url) }
+
+func TestE2E_Login(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{})
+
+	out := h.mustRun("login")
+
+	if !strings.Contains(out, "Authorization successful!") {
+		t.Errorf("expected successful authorization, got:\n%s", out)
+	}
+	if !strings.Contains(out, "Token saved to "+h.config.TokenFile) {
+		t.Errorf("expected token file in output, got:\n%s", out)
+	}
+	if _, err := os.Stat(h.config.TokenFile); err != nil {
+		t.Errorf("expected token file to be written: %v", err)
+	}
+	if got := h.server.Requests(freeetest.EndpointToken); got != 1 {
+		t.Errorf("expected 1 token request, got %d", got)
+	}
+}
+
+func TestE2E_IgnoresProcessEnvironment(t *testing.T) {
+	// 開発者の環境変数が設定されていても、テストの設定には影響しない
+	t.Setenv("FREEE_CALLBACK_PORT", "1")
+	t.Setenv("FREEE_HTTP_TIMEOUT", "invalid")
+	t.Setenv("FREEE_RETRY_MAX_ATTEMPTS", "invalid")
+	t.Setenv("FREEE_TOKEN_STORE", "invalid")
+	h := newE2EHarness(t, freeetest.Options{})
+
+	out := h.mustRun("login")
+
+	if !strings.Contains(out, "Authorization successful!") {
+		t.Errorf("expected successful authorization, got:\n%s", out)
+	}
+	if got := h.config.source("http_timeout"); got != sourceDefault {
+		t.Errorf("expected http_timeout from default, got %s", got)
+	}
+}
+
+func TestE2E_UnknownCommandPrintsUsageToStderr(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{})
+	var stderr bytes.Buffer
+	h.env.stderr = &stderr
+
+	out, err := h.run("unknown")
+
+	if err == nil || !strings.Contains(err.Error(), "unknown command: unknown") {
+		t.Errorf("expected unknown command error, got %v", err)
+	}
+	if !strings.Contains(stderr.String(), "Usage:") {
+		t.Errorf("expected usage on stderr, got:\n%s", stderr.String())
+	}
+	if out != "" {
+		t.Errorf("expected no output on stdout, got:\n%s", out)
+	}
+}
+
+func TestE2E_DefaultStartsFlowWithoutToken(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{})
+
+	out := h.mustRun()
+
+	if !strings.Contains(out, "No existing token. Starting OAuth2 flow...") || !strings.Contains(out, "Authorization successful!") {
+		t.Errorf("expected a new authorization flow, got:\n%s", out)
+	}
+}
+
+func TestE2E_ReusesValidToken(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{})
+	h.mustRun("login")
+	token := h.accessToken()
+
+	out := h.mustRun()
+
+	if !strings.Contains(out, "Loaded existing valid token") {
+		t.Errorf("expected the stored token to be reused, got:\n%s", out)
+	}
+	if got := h.accessToken(); got != token {
+		t.Errorf("expected access token %q to be reused, got %q", token, got)
+	}
+	if got := h.server.Requests(freeetest.EndpointAuthorize); got != 1 {
+		t.Errorf("expected a single authorization, got %d", got)
+	}
+	if got := h.server.Requests(freeetest.EndpointToken); got != 1 {
+		t.Errorf("expected no further token requests, got %d", got)
+	}
+}
+
+func TestE2E_RefreshesExpiringToken(t *testing.T) {
+	// 有効期限がバッファより短いため、保存したトークンはすぐにリフレッシュが必要になる
+	h := newE2EHarness(t, freeetest.Options{AccessTokenLifetime: time.Minute})
+	h.mustRun("login")
+	token, err := h.readToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := h.mustRun()
+
+	if !strings.Contains(out, "Loaded existing valid token") {
+		t.Errorf("expected the refreshed token to be used, got:\n%s", out)
+	}
+	refreshed, err := h.readToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.AccessToken == token.AccessToken || refreshed.RefreshToken == token.RefreshToken {
+		t.Error("expected rotated access and refresh tokens to be saved")
+	}
+	if got := h.server.Requests(freeetest.EndpointAuthorize); got != 1 {
+		t.Errorf("expected no new authorization, got %d", got)
+	}
+}
+
+func TestE2E_RefreshCommand(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{})
+	h.mustRun("login")
+	token := h.accessToken()
+
+	out := h.mustRun("refresh")
+
+	if !strings.Contains(out, "Token refreshed successfully") {
+		t.Errorf("expected refresh to succeed, got:\n%s", out)
+	}
+	if got := h.accessToken(); got == token {
+		t.Error("expected a new access token after refresh")
+	}
+}
+
+func TestE2E_ExpiredRefreshTokenStartsNewFlow(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{AccessTokenLifetime: time.Minute, RefreshTokenLifetime: 24 * time.Hour})
+	h.mustRun("login")
+
+	h.serverNow = h.serverNow.Add(25 * time.Hour)
+
+	if _, err := h.run("refresh"); !errors.Is(err, domain.ErrInvalidGrant) {
+		t.Fatalf("expected invalid_grant from refresh, got %v", err)
+	}
+
+	out := h.mustRun()
+
+	if !strings.Contains(out, "Refresh token has been revoked or expired. Starting new OAuth2 flow...") {
+		t.Errorf("expected re-authorization after an expired refresh token, got:\n%s", out)
+	}
+	if !strings.Contains(out, "Authorization successful!") {
+		t.Errorf("expected the new authorization to succeed, got:\n%s", out)
+	}
+	if got := h.server.Requests(freeetest.EndpointAuthorize); got != 2 {
+		t.Errorf("expected 2 authorizations, got %d", got)
+	}
+}
+
+func TestE2E_TransientFailureDoesNotStartFlow(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{AccessTokenLifetime: time.Minute})
+	h.mustRun("login")
+	h.config.RetryMaxAttempts = 1
+	// oauth2はクライアント認証の方式を判定するため、最初の失敗時に別の方式で再送する
+	unavailable := freeetest.Failure{Status: 503, Code: domain.ErrorCodeTemporarilyUnavailable}
+	h.server.FailNext(freeetest.EndpointToken, unavailable, unavailable)
+
+	out, err := h.run()
+
+	if !errors.Is(err, domain.ErrTransient) {
+		t.Errorf("expected a transient error, got %v\n%s", err, out)
+	}
+	if got := h.server.Requests(freeetest.EndpointAuthorize); got != 1 {
+		t.Errorf("expected no new authorization, got %d", got)
+	}
+}
+
+func TestE2E_Timeout(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{})
+	opened := make(chan string, 1)
+	h.env.browser = openerFunc(func(url string) error {
+		opened <- url
+		return nil
+	})
+	// 認可URLを開いた後、利用者が認可しないまま待ち時間が過ぎる
+	h.env.after = func(d time.Duration) <-chan time.Time {
+		if d != h.config.AuthTimeout {
+			t.Errorf("expected to wait %s, got %s", h.config.AuthTimeout, d)
+		}
+		timeout := make(chan time.Time, 1)
+		go func() {
+			<-opened
+			timeout <- time.Now()
+		}()
+		return timeout
+	}
+
+	out, err := h.run("login")
+
+	if err == nil || !strings.Contains(err.Error(), "authorization timeout (5m0s)") {
+		t.Fatalf("expected authorization timeout, got %v", err)
+	}
+	if !strings.Contains(out, h.server.AuthURL()) {
+		t.Errorf("expected the authorization URL to be shown, got:\n%s", out)
+	}
+	if _, err := os.Stat(h.config.TokenFile); !os.IsNotExist(err) {
+		t.Errorf("expected no token file after a timeout, got %v", err)
+	}
+	if got := h.server.Requests(freeetest.EndpointToken); got != 0 {
+		t.Errorf("expected no token requests, got %d", got)
+	}
+}
+
+func TestE2E_StatusUsesClock(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{AccessTokenLifetime: time.Hour})
+	h.mustRun("login")
+
+	h.env.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	out := h.mustRun("status")
+
+	if !strings.Contains(out, "(expired)") {
+		t.Errorf("expected the token to be reported as expired, got:\n%s", out)
+	}
+}
+
+func TestE2E_StatusShowsTokenMetadata(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{CompanyID: 12345, RefreshTokenLifetime: 30 * 24 * time.Hour})
+	h.mustRun("login")
+
+	out := h.mustRun("status")
+
+	for _, want := range []string{"Token Type: bearer", "Issued: ", "Company ID: 12345", "Refresh Token: (available, expires "} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in status, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Warning:") {
+		t.Errorf("expected no warning for a fresh refresh token, got:\n%s", out)
+	}
+}
+
+func TestE2E_WarnsBeforeRefreshTokenExpires(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{RefreshTokenLifetime: 30 * 24 * time.Hour})
+	h.mustRun("login")
+
+	h.env.now = func() time.Time { return time.Now().Add(25 * 24 * time.Hour) }
+	h.serverNow = h.serverNow.Add(25 * 24 * time.Hour)
+	if out := h.mustRun("status"); !strings.Contains(out, "Warning: the refresh token expires in ") {
+		t.Errorf("expected a warning about the refresh token, got:\n%s", out)
+	}
+
+	// アクセストークンのリフレッシュでリフレッシュトークンもローテーションされ、有効期限が延びる
+	h.mustRun()
+
+	if out := h.mustRun("status"); strings.Contains(out, "Warning:") {
+		t.Errorf("expected no warning after the refresh token was rotated, got:\n%s", out)
+	}
+}
+
+func TestE2E_CorrectsServerClockSkew(t *testing.T) {
+	// 認可サーバーの時計が2時間遅れているため、発行時刻（created_at）そのままでは期限切れになる
+	h := newE2EHarness(t, freeetest.Options{AccessTokenLifetime: time.Hour})
+	h.serverNow = h.serverNow.Add(-2 * time.Hour)
+	h.mustRun("login")
+
+	out := h.mustRun()
+
+	if !strings.Contains(out, "Loaded existing valid token") {
+		t.Errorf("expected the stored token to be valid on the local clock, got:\n%s", out)
+	}
+	if got := h.server.Requests(freeetest.EndpointToken); got != 1 {
+		t.Errorf("expected no refresh, got %d token requests", got)
+	}
+}
+
+func TestE2E_Logout(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{})
+	h.mustRun("login")
+
+	out := h.mustRun("logout")
+
+	if !strings.Contains(out, "Logged out.") {
+		t.Errorf("expected logout to succeed, got:\n%s", out)
+	}
+	if got := h.server.Requests(freeetest.EndpointRevoke); got == 0 {
+		t.Error("expected the token to be revoked")
+	}
+	if out := h.mustRun("status"); !strings.Contains(out, "Not logged in.") {
+		t.Errorf("expected no token after logout, got:\n%s", out)
+	}
+}
+
+// e2eCompanies は複数の事業所にアクセスできるユーザーの事業所
+var e2eCompanies = []freeetest.Company{
+	{ID: 10, Name: "freee-office", DisplayName: "freee事務所", Role: "admin"},
+	{ID: 20, Name: "freee-shop", DisplayName: "freee商店", Role: "read_only"},
+}
+
+func TestE2E_LoginSelectsOnlyCompany(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{})
+
+	out := h.mustRun("login")
+
+	if !strings.Contains(out, "Default company: Fake Company (1)") {
+		t.Errorf("expected the only company to be selected, got:\n%s", out)
+	}
+	if got := strings.TrimSpace(h.mustRun("companies", "default")); got != "1" {
+		t.Errorf("expected default company 1, got %q", got)
+	}
+}
+
+func TestE2E_LoginPromptsForCompany(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{Companies: e2eCompanies})
+	h.env.stdin = strings.NewReader("2\n")
+
+	out := h.mustRun("login")
+
+	if !strings.Contains(out, "1) freee事務所 (ID: 10, role: admin)") || !strings.Contains(out, "Default company: freee商店 (20)") {
+		t.Errorf("expected the second company to be selected from the list, got:\n%s", out)
+	}
+	token, err := h.readToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.DefaultCompany == nil || token.DefaultCompany.ID != 20 {
+		t.Errorf("expected the default company to be saved with the token, got %+v", token.DefaultCompany)
+	}
+}
+
+func TestE2E_HeadlessLoginReadsCompanyFromSameInput(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{Companies: e2eCompanies})
+	h.config.Headless = true
+	// リダイレクト先のURLと事業所の番号がまとめて貼り付けられる
+	paste := &pasteInput{server: h.server, rest: "2\n"}
+	h.env.stdin = paste
+	h.env.stdout = paste
+
+	out := h.mustRun("login")
+
+	if !strings.Contains(out, "Default company: freee商店 (20)") {
+		t.Errorf("expected the company number following the pasted URL to be read, got:\n%s", out)
+	}
+}
+
+func TestE2E_LoginWithoutCompanySelection(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{Companies: e2eCompanies})
+
+	out := h.mustRun("login")
+
+	if !strings.Contains(out, "No default company selected") {
+		t.Errorf("expected login to finish without a default company, got:\n%s", out)
+	}
+	if _, err := h.run("companies", "default"); !errors.Is(err, usecase.ErrNoDefaultCompany) {
+		t.Errorf("expected no default company, got %v", err)
+	}
+
+	h.mustRun("companies", "select", "10")
+
+	out = h.mustRun("companies", "list")
+	if !strings.Contains(out, "* 10") || !strings.Contains(out, "  20") {
+		t.Errorf("expected company 10 to be marked as the default, got:\n%s", out)
+	}
+}
+
+func TestE2E_LoginCompanyFlag(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{Companies: e2eCompanies})
+	h.config.CompanyID = 20
+
+	out := h.mustRun("login")
+
+	if strings.Contains(out, "Select the default company") || !strings.Contains(out, "Default company: freee商店 (20)") {
+		t.Errorf("expected the company from the flag to be selected without a prompt, got:\n%s", out)
+	}
+
+	h.config.CompanyID = 30
+	if _, err := h.run("login"); !errors.Is(err, domain.ErrCompanyNotFound) {
+		t.Errorf("expected an inaccessible company to be rejected, got %v", err)
+	}
+}
+
+func TestE2E_LoginSelectsCompanyChosenOnConsent(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{Companies: e2eCompanies, CompanyID: 20})
+
+	out := h.mustRun("login")
+
+	if !strings.Contains(out, "Default company: freee商店 (20)") {
+		t.Errorf("expected the company chosen on the consent screen to be selected, got:\n%s", out)
+	}
+}
+
+func TestE2E_DefaultCompanySurvivesRefresh(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{Companies: e2eCompanies})
+	h.config.CompanyID = 10
+	h.mustRun("login")
+
+	h.mustRun("refresh")
+
+	if got := strings.TrimSpace(h.mustRun("companies", "default")); got != "10" {
+		t.Errorf("expected default company 10 after refresh, got %q", got)
+	}
+	if out := h.mustRun("status"); !strings.Contains(out, "Default Company: freee事務所 (10)") {
+		t.Errorf("expected the default company in status, got:\n%s", out)
+	}
+}
+
+func TestE2E_ReloginKeepsAccessibleDefaultCompany(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{Companies: e2eCompanies})
+	h.env.stdin = strings.NewReader("2\n")
+	h.mustRun("login")
+
+	h.env.stdin = strings.NewReader("")
+	out := h.mustRun("login")
+
+	if strings.Contains(out, "Select the default company") || !strings.Contains(out, "Default company: freee商店 (20)") {
+		t.Errorf("expected the previous default company to be kept without a prompt, got:\n%s", out)
+	}
+}
+
+func TestE2E_ReloginClearsInaccessibleDefaultCompany(t *testing.T) {
+	h := newE2EHarness(t, freeetest.Options{Companies: e2eCompanies})
+	h.config.CompanyID = 20
+	h.mustRun("login")
+
+	// 事業所20へのアクセス権を失ったユーザーが、同じトークンファイルで再認可する
+	other := newE2EHarness(t, freeetest.Options{Companies: []freeetest.Company{e2eCompanies[0], {ID: 30, DisplayName: "freee工房"}}})
+	other.config = h.config
+	other.config.CompanyID = 0
+	out := other.mustRun("login")
+
+	if !strings.Contains(out, "No default company selected") {
+		t.Errorf("expected to be asked for a new default company, got:\n%s", out)
+	}
+	if _, err := other.run("companies", "default"); !errors.Is(err, usecase.ErrNoDefaultCompany) {
+		t.Errorf("expected the inaccessible default company to be cleared, got %v", err)
+	}
+}
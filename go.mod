@@ -3,6 +3,8 @@ module freee-oauth-app
 go 1.25.5
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/u-masato/freee-api-go v0.1.1
+	golang.org/x/crypto v0.53.0
 	golang.org/x/oauth2 v0.34.0
 )
@@ -0,0 +1,123 @@
+// Package browser は認可URLを既定のブラウザで開く機能を提供する
+package browser
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// ブラウザの起動直後に失敗を検出するために待つ時間
+// これを過ぎても終了しないコマンドは起動に成功したとみなす
+const startupWait = 2 * time.Second
+
+var (
+	ErrNoDisplay = errors.New("no display available")
+	ErrNoBrowser = errors.New("no browser command found")
+)
+
+// Opener はURLをブラウザで開く
+type Opener interface {
+	Open(url string) error
+}
+
+// SystemOpener は環境変数 $BROWSER またはOS標準のコマンドでURLを開く
+//
+// Linuxなどでディスプレイがない場合（SSH接続など）は ErrNoDisplay を返す。
+type SystemOpener struct {
+	goos     string
+	getenv   func(string) string
+	lookPath func(string) (string, error)
+	run      func(name string, args ...string) error
+}
+
+// NewSystemOpener は新しいSystemOpenerを生成する
+func NewSystemOpener() *SystemOpener {
+	return &SystemOpener{
+		goos:     runtime.GOOS,
+		getenv:   os.Getenv,
+		lookPath: exec.LookPath,
+		run:      runCommand,
+	}
+}
+
+// Open はURLをブラウザで開く
+func (o *SystemOpener) Open(url string) error {
+	name, args, err := o.command(url)
+	if err != nil {
+		return err
+	}
+	return o.run(name, args...)
+}
+
+// command はURLを開くコマンドを決定する
+// $BROWSER はコロン区切りの候補リストで、"%s" を含む場合はURLに置き換える
+func (o *SystemOpener) command(url string) (string, []string, error) {
+	if env := o.getenv("BROWSER"); env != "" {
+		for _, candidate := range strings.Split(env, ":") {
+			fields := strings.Fields(candidate)
+			if len(fields) == 0 {
+				continue
+			}
+			if _, err := o.lookPath(fields[0]); err != nil {
+				continue
+			}
+			return fields[0], substituteURL(fields[1:], url), nil
+		}
+	}
+
+	switch o.goos {
+	case "darwin":
+		return "open", []string{url}, nil
+	case "windows":
+		return "rundll32", []string{"url.dll,FileProtocolHandler", url}, nil
+	}
+
+	if o.getenv("DISPLAY") == "" && o.getenv("WAYLAND_DISPLAY") == "" {
+		return "", nil, ErrNoDisplay
+	}
+	for _, name := range []string{"xdg-open", "x-www-browser", "www-browser"} {
+		if _, err := o.lookPath(name); err == nil {
+			return name, []string{url}, nil
+		}
+	}
+	return "", nil, ErrNoBrowser
+}
+
+// substituteURL は引数の "%s" をURLに置き換える。"%s" がない場合は末尾にURLを追加する
+func substituteURL(args []string, url string) []string {
+	out := make([]string, 0, len(args)+1)
+	substituted := false
+	for _, arg := range args {
+		if strings.Contains(arg, "%s") {
+			arg = strings.ReplaceAll(arg, "%s", url)
+			substituted = true
+		}
+		out = append(out, arg)
+	}
+	if !substituted {
+		out = append(out, url)
+	}
+	return out
+}
+
+// runCommand はコマンドを起動し、startupWait 以内に失敗した場合はエラーを返す
+func runCommand(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(startupWait):
+		return nil
+	}
+}
@@ -0,0 +1,93 @@
+package browser
+
+import (
+	"errors"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func newTestOpener(goos string, env map[string]string, available ...string) (*SystemOpener, *[]string) {
+	var ran []string
+	return &SystemOpener{
+		goos:   goos,
+		getenv: func(key string) string { return env[key] },
+		lookPath: func(name string) (string, error) {
+			for _, a := range available {
+				if a == name {
+					return "/usr/bin/" + name, nil
+				}
+			}
+			return "", exec.ErrNotFound
+		},
+		run: func(name string, args ...string) error {
+			ran = append([]string{name}, args...)
+			return nil
+		},
+	}, &ran
+}
+
+func TestSystemOpener_UsesBrowserEnv(t *testing.T) {
+	opener, ran := newTestOpener("linux", map[string]string{"BROWSER": "missing:firefox --new-tab %s"}, "firefox")
+
+	if err := opener.Open("https://example.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"firefox", "--new-tab", "https://example.com"}
+	if !reflect.DeepEqual(*ran, want) {
+		t.Errorf("expected %v, got %v", want, *ran)
+	}
+}
+
+func TestSystemOpener_UsesXdgOpen(t *testing.T) {
+	opener, ran := newTestOpener("linux", map[string]string{"DISPLAY": ":0"}, "xdg-open")
+
+	if err := opener.Open("https://example.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"xdg-open", "https://example.com"}
+	if !reflect.DeepEqual(*ran, want) {
+		t.Errorf("expected %v, got %v", want, *ran)
+	}
+}
+
+func TestSystemOpener_NoDisplay(t *testing.T) {
+	opener, ran := newTestOpener("linux", map[string]string{}, "xdg-open")
+
+	if err := opener.Open("https://example.com"); !errors.Is(err, ErrNoDisplay) {
+		t.Errorf("expected ErrNoDisplay, got %v", err)
+	}
+	if *ran != nil {
+		t.Errorf("expected no command to run, got %v", *ran)
+	}
+}
+
+func TestSystemOpener_NoBrowser(t *testing.T) {
+	opener, _ := newTestOpener("linux", map[string]string{"WAYLAND_DISPLAY": "wayland-0"})
+
+	if err := opener.Open("https://example.com"); !errors.Is(err, ErrNoBrowser) {
+		t.Errorf("expected ErrNoBrowser, got %v", err)
+	}
+}
+
+func TestSystemOpener_Darwin(t *testing.T) {
+	opener, ran := newTestOpener("darwin", map[string]string{})
+
+	if err := opener.Open("https://example.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"open", "https://example.com"}
+	if !reflect.DeepEqual(*ran, want) {
+		t.Errorf("expected %v, got %v", want, *ran)
+	}
+}
+
+func TestSystemOpener_PropagatesCommandFailure(t *testing.T) {
+	opener, _ := newTestOpener("linux", map[string]string{"DISPLAY": ":0"}, "xdg-open")
+	wantErr := errors.New("exit status 3")
+	opener.run = func(name string, args ...string) error { return wantErr }
+
+	if err := opener.Open("https://example.com"); !errors.Is(err, wantErr) {
+		t.Errorf("expected %v, got %v", wantErr, err)
+	}
+}
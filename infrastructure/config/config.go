@@ -0,0 +1,156 @@
+// Package config はTOML形式の設定ファイルの読み込みを提供する
+//
+// 設定ファイルは既定で $XDG_CONFIG_HOME/freee-oauth-app/config.toml
+// （未設定の場合は ~/.config/freee-oauth-app/config.toml）に配置する。
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	appName        = "freee-oauth-app"
+	configFileName = "config.toml"
+)
+
+// File は設定ファイルの内容
+//
+// Profile はプロファイル未指定時に使用するプロファイル名。
+// CallbackFallbackPorts は callback_port が使用中の場合に順に試すポート
+// （freeeアプリにそれぞれのコールバックURLを登録しておく）。
+// Headless はブラウザのリダイレクトを待たずに認可レスポンスを手動で入力し、
+// NoBrowser は認可URLをブラウザで自動的に開かない。
+// StateFile は開始済みの認可リクエストを複数のプロセスで共有するためのファイル。
+// ExpiryBuffer は有効期限のどれだけ前からトークンを無効とみなしてリフレッシュするか。
+type File struct {
+	Profile               string                  `toml:"profile"`
+	CallbackPort          int                     `toml:"callback_port"`
+	CallbackPath          string                  `toml:"callback_path"`
+	CallbackFallbackPorts []int                   `toml:"callback_fallback_ports"`
+	Headless              bool                    `toml:"headless"`
+	NoBrowser             bool                    `toml:"no_browser"`
+	StateFile             string                  `toml:"state_file"`
+	ExpiryBuffer          time.Duration           `toml:"expiry_buffer"`
+	Timeouts              Timeouts                `toml:"timeouts"`
+	Retry                 Retry                   `toml:"retry"`
+	Hooks                 Hooks                   `toml:"hooks"`
+	TokenStore            TokenStore              `toml:"token_store"`
+	Profiles              map[string]ProfileEntry `toml:"profiles"`
+}
+
+// Timeouts はタイムアウト設定
+type Timeouts struct {
+	// Authorization はブラウザでの認可を待つ時間
+	Authorization time.Duration `toml:"authorization"`
+	// HTTP はトークンエンドポイントへのリクエストのタイムアウト
+	HTTP time.Duration `toml:"http"`
+}
+
+// Retry はトークンエンドポイントへのリクエストの再試行の設定
+type Retry struct {
+	// MaxAttempts は最初の試行を含む最大試行回数（1で再試行しない）
+	MaxAttempts int `toml:"max_attempts"`
+	// MaxElapsed は再試行を打ち切るまでの時間
+	MaxElapsed time.Duration `toml:"max_elapsed"`
+}
+
+// Hooks はトークンのライフサイクルイベントの通知先の設定
+type Hooks struct {
+	// Exec はイベントごとに実行するシェルコマンド
+	Exec string `toml:"exec"`
+	// Webhook はイベントをJSONでPOSTするURL
+	Webhook string `toml:"webhook"`
+}
+
+// TokenStore はトークンの保存先の設定
+type TokenStore struct {
+	// Backend は "file"（平文）または "encrypted"（AES-GCM暗号化）
+	Backend               string `toml:"backend"`
+	KeyFile               string `toml:"key_file"`
+	PassphraseEnv         string `toml:"passphrase_env"`
+	PreviousKeyFile       string `toml:"previous_key_file"`
+	PreviousPassphraseEnv string `toml:"previous_passphrase_env"`
+}
+
+// ProfileEntry は1プロファイル分の設定
+//
+// クライアントシークレットは client_secret に直接書く代わりに、
+// client_secret_env（環境変数名）または client_secret_file（ファイルパス）で参照できる。
+type ProfileEntry struct {
+	ClientID         string   `toml:"client_id"`
+	ClientSecret     string   `toml:"client_secret"`
+	ClientSecretEnv  string   `toml:"client_secret_env"`
+	ClientSecretFile string   `toml:"client_secret_file"`
+	RedirectURL      string   `toml:"redirect_url"`
+	Scopes           []string `toml:"scopes"`
+	TokenFile        string   `toml:"token_file"`
+}
+
+// ResolveClientSecret はシークレットの参照先からクライアントシークレットを解決する
+// 優先順位は client_secret_file > client_secret_env > client_secret
+func (e ProfileEntry) ResolveClientSecret() (string, error) {
+	switch {
+	case e.ClientSecretFile != "":
+		data, err := os.ReadFile(expandHome(e.ClientSecretFile))
+		if err != nil {
+			return "", fmt.Errorf("client_secret_file: %w", err)
+		}
+		return string(trimNewline(data)), nil
+	case e.ClientSecretEnv != "":
+		return os.Getenv(e.ClientSecretEnv), nil
+	default:
+		return e.ClientSecret, nil
+	}
+}
+
+// DefaultPath はXDG Base Directory仕様に従った設定ファイルのパスを返す
+func DefaultPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return configFileName
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, appName, configFileName)
+}
+
+// Load は設定ファイルを読み込む
+// ファイルが存在しない場合は空の設定を返す
+func Load(path string) (*File, error) {
+	var file File
+	meta, err := toml.DecodeFile(path, &file)
+	if errors.Is(err, os.ErrNotExist) {
+		return &File{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("%s: unknown key %q", path, undecoded[0].String())
+	}
+	return &file, nil
+}
+
+func expandHome(path string) string {
+	if len(path) >= 2 && path[:2] == "~/" {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
+
+func trimNewline(b []byte) []byte {
+	for len(b) > 0 && (b[len(b)-1] == '\n' || b[len(b)-1] == '\r') {
+		b = b[:len(b)-1]
+	}
+	return b
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfigTOML = `
+profile = "sandbox"
+callback_port = 9090
+callback_path = "/oauth/callback"
+expiry_buffer = "10m"
+
+[timeouts]
+authorization = "2m"
+http = "30s"
+
+[retry]
+max_attempts = 2
+max_elapsed = "10s"
+
+[hooks]
+exec = "systemctl --user restart freee-sync"
+
+[token_store]
+backend = "encrypted"
+key_file = "~/.freee-token.key"
+
+[profiles.sandbox]
+client_id = "sandbox_id"
+client_secret = "sandbox_secret"
+scopes = ["read"]
+
+[profiles.production]
+client_id = "prod_id"
+client_secret_env = "TEST_PROD_CLIENT_SECRET"
+redirect_url = "http://127.0.0.1:9191/callback"
+token_file = "prod-token.json"
+`
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	file, err := Load(writeConfigFile(t, testConfigTOML))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if file.Profile != "sandbox" {
+		t.Errorf("expected profile sandbox, got %s", file.Profile)
+	}
+	if file.CallbackPort != 9090 {
+		t.Errorf("expected callback port 9090, got %d", file.CallbackPort)
+	}
+	if file.Timeouts.Authorization != 2*time.Minute {
+		t.Errorf("expected authorization timeout 2m, got %v", file.Timeouts.Authorization)
+	}
+	if file.Timeouts.HTTP != 30*time.Second {
+		t.Errorf("expected http timeout 30s, got %v", file.Timeouts.HTTP)
+	}
+	if file.ExpiryBuffer != 10*time.Minute {
+		t.Errorf("expected expiry buffer 10m, got %s", file.ExpiryBuffer)
+	}
+	if file.Retry.MaxAttempts != 2 || file.Retry.MaxElapsed != 10*time.Second {
+		t.Errorf("expected retry 2 attempts within 10s, got %+v", file.Retry)
+	}
+	if file.Hooks.Exec != "systemctl --user restart freee-sync" {
+		t.Errorf("expected exec hook, got %q", file.Hooks.Exec)
+	}
+	if file.TokenStore.Backend != "encrypted" {
+		t.Errorf("expected encrypted backend, got %s", file.TokenStore.Backend)
+	}
+	if len(file.Profiles) != 2 {
+		t.Errorf("expected 2 profiles, got %d", len(file.Profiles))
+	}
+}
+
+func TestLoad_WhenFileNotExists(t *testing.T) {
+	file, err := Load(filepath.Join(t.TempDir(), "nonexistent.toml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(file.Profiles) != 0 {
+		t.Error("expected empty config")
+	}
+}
+
+func TestLoad_UnknownKey(t *testing.T) {
+	_, err := Load(writeConfigFile(t, "callback_prot = 9090\n"))
+
+	if err == nil || !strings.Contains(err.Error(), "callback_prot") {
+		t.Errorf("expected unknown key error, got %v", err)
+	}
+}
+
+func TestProfileEntry_ResolveClientSecret(t *testing.T) {
+	t.Setenv("TEST_CLIENT_SECRET", "from_env")
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	os.WriteFile(secretFile, []byte("from_file\n"), 0600)
+
+	tests := []struct {
+		name  string
+		entry ProfileEntry
+		want  string
+	}{
+		{"inline", ProfileEntry{ClientSecret: "inline"}, "inline"},
+		{"env", ProfileEntry{ClientSecret: "inline", ClientSecretEnv: "TEST_CLIENT_SECRET"}, "from_env"},
+		{"file", ProfileEntry{ClientSecretEnv: "TEST_CLIENT_SECRET", ClientSecretFile: secretFile}, "from_file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.entry.ResolveClientSecret()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDefaultPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/tmp/xdg")
+
+	if got := DefaultPath(); got != "/tmp/xdg/freee-oauth-app/config.toml" {
+		t.Errorf("unexpected default path: %s", got)
+	}
+}
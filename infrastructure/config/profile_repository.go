@@ -0,0 +1,61 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"freee-oauth-app/domain"
+)
+
+// ProfileRepository は設定ファイルの [profiles.<name>] からプロファイルを返すリポジトリ
+type ProfileRepository struct {
+	file *File
+}
+
+// NewProfileRepository は新しいProfileRepositoryを生成する
+func NewProfileRepository(file *File) *ProfileRepository {
+	return &ProfileRepository{
+		file: file,
+	}
+}
+
+// List はすべてのプロファイルを名前順で返す
+func (r *ProfileRepository) List(ctx context.Context) ([]*domain.Profile, error) {
+	profiles := make([]*domain.Profile, 0, len(r.file.Profiles))
+	for name, entry := range r.file.Profiles {
+		profile, err := entry.toProfile(name)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles, nil
+}
+
+// Get は指定された名前のプロファイルを返す
+func (r *ProfileRepository) Get(ctx context.Context, name string) (*domain.Profile, error) {
+	entry, ok := r.file.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", domain.ErrProfileNotFound, name)
+	}
+	return entry.toProfile(name)
+}
+
+func (e ProfileEntry) toProfile(name string) (*domain.Profile, error) {
+	secret, err := e.ResolveClientSecret()
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %w", name, err)
+	}
+	return &domain.Profile{
+		Name:         name,
+		ClientID:     e.ClientID,
+		ClientSecret: secret,
+		RedirectURL:  e.RedirectURL,
+		Scopes:       e.Scopes,
+		TokenFile:    e.TokenFile,
+	}, nil
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"freee-oauth-app/domain"
+)
+
+func TestProfileRepository_List(t *testing.T) {
+	file, _ := Load(writeConfigFile(t, testConfigTOML))
+	repo := NewProfileRepository(file)
+
+	profiles, err := repo.List(context.Background())
+	if err != nil {
+		t.Fatalf("failed to list profiles: %v", err)
+	}
+
+	if len(profiles) != 2 {
+		t.Fatalf("expected 2 profiles, got %d", len(profiles))
+	}
+	if profiles[0].Name != "production" || profiles[1].Name != "sandbox" {
+		t.Errorf("expected profiles sorted by name, got %s, %s", profiles[0].Name, profiles[1].Name)
+	}
+}
+
+func TestProfileRepository_Get(t *testing.T) {
+	t.Setenv("TEST_PROD_CLIENT_SECRET", "prod_secret_from_env")
+	file, _ := Load(writeConfigFile(t, testConfigTOML))
+	repo := NewProfileRepository(file)
+
+	profile, err := repo.Get(context.Background(), "production")
+	if err != nil {
+		t.Fatalf("failed to get profile: %v", err)
+	}
+
+	if profile.ClientID != "prod_id" {
+		t.Errorf("expected prod_id, got %s", profile.ClientID)
+	}
+	if profile.ClientSecret != "prod_secret_from_env" {
+		t.Errorf("expected client secret from env, got %s", profile.ClientSecret)
+	}
+	if profile.RedirectURL != "http://127.0.0.1:9191/callback" {
+		t.Errorf("unexpected redirect URL: %s", profile.RedirectURL)
+	}
+	if profile.TokenFile != "prod-token.json" {
+		t.Errorf("unexpected token file: %s", profile.TokenFile)
+	}
+}
+
+func TestProfileRepository_Get_NotFound(t *testing.T) {
+	repo := NewProfileRepository(&File{})
+
+	_, err := repo.Get(context.Background(), "unknown")
+
+	if !errors.Is(err, domain.ErrProfileNotFound) {
+		t.Errorf("expected ErrProfileNotFound, got %v", err)
+	}
+}
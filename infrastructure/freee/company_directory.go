@@ -0,0 +1,80 @@
+package freee
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"freee-oauth-app/domain"
+
+	"github.com/u-masato/freee-api-go/client"
+	"golang.org/x/oauth2"
+)
+
+// usersMePath はログインユーザーの情報を取得するエンドポイント
+const usersMePath = "/api/1/users/me"
+
+// CompanyDirectory は freee APIの /api/1/users/me からユーザーがアクセスできる事業所を取得する
+type CompanyDirectory struct {
+	baseURL string
+}
+
+// NewCompanyDirectory は新しいCompanyDirectoryを生成する
+// baseURL が空の場合は APIBaseURL を使用する
+func NewCompanyDirectory(baseURL string) *CompanyDirectory {
+	if baseURL == "" {
+		baseURL = APIBaseURL
+	}
+	return &CompanyDirectory{baseURL: baseURL}
+}
+
+// usersMeResponse は /api/1/users/me?companies=true のレスポンスのうち事業所の一覧
+// freee-api-go の生成されたモデルは companies を含まないため、必要なフィールドだけを定義する
+type usersMeResponse struct {
+	User struct {
+		Companies []struct {
+			ID          int64  `json:"id"`
+			Name        string `json:"name"`
+			DisplayName string `json:"display_name"`
+			Role        string `json:"role"`
+		} `json:"companies"`
+	} `json:"user"`
+}
+
+// Companies はアクセストークンのユーザーがアクセスできる事業所を返す
+// ctx に設定されたHTTPクライアントのタイムアウトなどの設定を使う
+func (d *CompanyDirectory) Companies(ctx context.Context, token *domain.Token) ([]domain.Company, error) {
+	api := client.NewClient(
+		client.WithBaseURL(d.baseURL),
+		client.WithHTTPClient(oauth2.NewClient(ctx, oauth2.StaticTokenSource(token.ToOAuth2Token()))),
+	)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, api.BaseURL()+usersMePath+"?companies=true", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := api.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list companies: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list companies: %w", client.ParseErrorResponse(resp))
+	}
+	defer resp.Body.Close()
+
+	var body usersMeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode companies: %w", err)
+	}
+	companies := make([]domain.Company, 0, len(body.User.Companies))
+	for _, c := range body.User.Companies {
+		companies = append(companies, domain.Company{
+			ID:          c.ID,
+			Name:        c.Name,
+			DisplayName: c.DisplayName,
+			Role:        c.Role,
+		})
+	}
+	return companies, nil
+}
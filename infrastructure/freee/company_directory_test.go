@@ -0,0 +1,72 @@
+package freee
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"freee-oauth-app/domain"
+
+	"github.com/u-masato/freee-api-go/client"
+)
+
+func TestCompanyDirectory_Companies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/1/users/me" || r.URL.Query().Get("companies") != "true" {
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer access_token" {
+			t.Errorf("expected bearer token, got %q", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"user": map[string]interface{}{
+				"id":    1,
+				"email": "user@example.com",
+				"companies": []map[string]interface{}{
+					{"id": 10, "name": "freee-office", "display_name": "freee事務所", "role": "admin", "use_custom_role": false},
+					{"id": 20, "name": "freee-shop", "display_name": "freee商店", "role": "read_only", "use_custom_role": false},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+
+	companies, err := NewCompanyDirectory(server.URL).Companies(context.Background(),
+		domain.NewToken("access_token", "refresh_token", time.Now().Add(time.Hour)))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []domain.Company{
+		{ID: 10, Name: "freee-office", DisplayName: "freee事務所", Role: "admin"},
+		{ID: 20, Name: "freee-shop", DisplayName: "freee商店", Role: "read_only"},
+	}
+	if len(companies) != len(want) {
+		t.Fatalf("expected %d companies, got %d", len(want), len(companies))
+	}
+	for i := range want {
+		if companies[i] != want[i] {
+			t.Errorf("expected %+v, got %+v", want[i], companies[i])
+		}
+	}
+}
+
+func TestCompanyDirectory_Companies_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "access token is invalid"})
+	}))
+	defer server.Close()
+
+	_, err := NewCompanyDirectory(server.URL).Companies(context.Background(),
+		domain.NewToken("expired", "", time.Now().Add(time.Hour)))
+
+	if !client.IsUnauthorizedError(err) {
+		t.Errorf("expected an unauthorized error, got %v", err)
+	}
+}
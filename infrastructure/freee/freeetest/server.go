@@ -0,0 +1,578 @@
+// Package freeetest はテストとローカル開発のためのfreee認可サーバーの偽物を提供する
+//
+// 認可エンドポイントは利用者の操作なしに認可してリダイレクトし、トークンエンドポイントは
+// 認可コード（PKCE）とリフレッシュトークンのグラント、リフレッシュトークンのローテーション、
+// 無効化エンドポイントはRFC 7009の動作を再現する。状態はメモリ上に保持し、
+// Options.StateFile を指定した場合は発行済みのトークンをファイルにも保存する。
+//
+//	server, err := freeetest.NewServer(freeetest.Options{})
+//	defer server.Close()
+//	provider := freee.NewFreeeOAuthProviderWithEndpoint(
+//		freeetest.DefaultClientID, freeetest.DefaultClientSecret, redirectURL, nil,
+//		server.AuthURL(), server.TokenURL(), server.RevokeURL())
+package freeetest
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// 各エンドポイントのパス（freeeと同じ）
+const (
+	AuthorizePath = "/public_api/authorize"
+	TokenPath     = "/public_api/token"
+	RevokePath    = "/public_api/revoke"
+	UsersMePath   = "/api/1/users/me"
+)
+
+// Options を省略した場合のデフォルト値
+const (
+	DefaultClientID            = "fake-client-id"
+	DefaultClientSecret        = "fake-client-secret"
+	DefaultAccessTokenLifetime = 6 * time.Hour
+	defaultAddr                = "127.0.0.1:0"
+	// codeLifetime は認可コードの有効期間
+	codeLifetime = 10 * time.Minute
+	// oobRedirectURL はリダイレクトせずに認可コードを表示するリダイレクトURL
+	oobRedirectURL = "urn:ietf:wg:oauth:2.0:oob"
+)
+
+// Endpoint はエラーを注入するエンドポイント
+type Endpoint string
+
+const (
+	EndpointAuthorize Endpoint = "authorize"
+	EndpointToken     Endpoint = "token"
+	EndpointRevoke    Endpoint = "revoke"
+	EndpointAPI       Endpoint = "api"
+)
+
+// Failure は注入するエラーレスポンス
+//
+// 認可エンドポイントでは Code をエラーとしてリダイレクトし、それ以外では
+// Status と RFC 6749 5.2 形式のJSONを返す。Code が空の場合は本文を返さない。
+type Failure struct {
+	Status      int
+	Code        string
+	Description string
+}
+
+// Company は /api/1/users/me?companies=true が返す事業所
+type Company struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Role        string `json:"role"`
+}
+
+// DefaultCompanies は Options.Companies を省略した場合にユーザーがアクセスできる事業所
+var DefaultCompanies = []Company{{ID: 1, Name: "fake-company", DisplayName: "Fake Company", Role: "admin"}}
+
+// Options は偽の認可サーバーの設定
+type Options struct {
+	ClientID     string
+	ClientSecret string
+	// AccessTokenLifetime はアクセストークンの有効期間（既定: 6時間）
+	AccessTokenLifetime time.Duration
+	// RefreshTokenLifetime はリフレッシュトークンの有効期間（0の場合は無期限）
+	RefreshTokenLifetime time.Duration
+	// CompanyID はトークンレスポンスの company_id（0の場合は返さない）
+	CompanyID int64
+	// Companies はユーザーがアクセスできる事業所（既定: DefaultCompanies）
+	Companies []Company
+	// Now は現在時刻を返す（既定: time.Now）
+	Now func() time.Time
+	// Addr は待ち受けるアドレス（既定: 127.0.0.1 の空いているポート）
+	Addr string
+	// StateFile は発行済みのトークンを保存するファイル（空の場合はメモリにのみ保持する）
+	// 複数のプロセスで同じファイルを指定すると、別のプロセスが発行したトークンをリフレッシュできる
+	StateFile string
+}
+
+// Server は偽のfreee認可サーバー
+type Server struct {
+	// URL は待ち受けているベースURL（例: http://127.0.0.1:12345）
+	URL string
+
+	opts   Options
+	server *http.Server
+
+	mu            sync.Mutex
+	codes         map[string]*authCode
+	accessTokens  map[string]*grant
+	refreshTokens map[string]*grant
+	failures      map[Endpoint][]Failure
+	requests      map[Endpoint]int
+}
+
+// authCode は発行済みの認可コード
+type authCode struct {
+	redirectURI   string
+	codeChallenge string
+	scope         string
+	expiry        time.Time
+}
+
+// grant は発行済みのトークン
+type grant struct {
+	Scope  string    `json:"scope"`
+	Expiry time.Time `json:"expiry"` // ゼロ値の場合は無期限
+}
+
+// state は StateFile に保存する発行済みのトークン
+type state struct {
+	AccessTokens  map[string]*grant `json:"access_tokens"`
+	RefreshTokens map[string]*grant `json:"refresh_tokens"`
+}
+
+func (g *grant) expired(now time.Time) bool {
+	return !g.Expiry.IsZero() && !now.Before(g.Expiry)
+}
+
+// NewServer は偽の認可サーバーを起動する
+func NewServer(opts Options) (*Server, error) {
+	if opts.ClientID == "" {
+		opts.ClientID = DefaultClientID
+	}
+	if opts.ClientSecret == "" {
+		opts.ClientSecret = DefaultClientSecret
+	}
+	if opts.AccessTokenLifetime == 0 {
+		opts.AccessTokenLifetime = DefaultAccessTokenLifetime
+	}
+	if opts.Companies == nil {
+		opts.Companies = DefaultCompanies
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	if opts.Addr == "" {
+		opts.Addr = defaultAddr
+	}
+
+	listener, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		URL:           "http://" + listener.Addr().String(),
+		opts:          opts,
+		codes:         map[string]*authCode{},
+		accessTokens:  map[string]*grant{},
+		refreshTokens: map[string]*grant{},
+		failures:      map[Endpoint][]Failure{},
+		requests:      map[Endpoint]int{},
+	}
+	if err := s.load(); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	s.server = &http.Server{Handler: s.Handler()}
+	go s.server.Serve(listener)
+	return s, nil
+}
+
+// load は StateFile から発行済みのトークンを読み込む
+func (s *Server) load() error {
+	if s.opts.StateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.opts.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return fmt.Errorf("%s: %w", s.opts.StateFile, err)
+	}
+	maps.Copy(s.accessTokens, st.AccessTokens)
+	maps.Copy(s.refreshTokens, st.RefreshTokens)
+	return nil
+}
+
+// save は発行済みのトークンを StateFile に保存する（s.mu を保持して呼ぶ）
+// 複数のプロセスが同時にトークンを発行する用途は想定せず、後から保存した内容で上書きする
+func (s *Server) save() {
+	if s.opts.StateFile == "" {
+		return
+	}
+	data, err := json.Marshal(state{AccessTokens: s.accessTokens, RefreshTokens: s.refreshTokens})
+	if err != nil {
+		return
+	}
+	os.WriteFile(s.opts.StateFile, data, 0600)
+}
+
+// Close はサーバーを停止する
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+// Handler は各エンドポイントを処理するハンドラを返す
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(AuthorizePath, s.handleAuthorize)
+	mux.HandleFunc(TokenPath, s.handleToken)
+	mux.HandleFunc(RevokePath, s.handleRevoke)
+	mux.HandleFunc(UsersMePath, s.handleUsersMe)
+	// Dateヘッダも Options.Now の時刻で返し、クライアントとの時刻のずれを再現できるようにする
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", s.opts.Now().UTC().Format(http.TimeFormat))
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// AuthURL は認可エンドポイントのURLを返す
+func (s *Server) AuthURL() string { return s.URL + AuthorizePath }
+
+// TokenURL はトークンエンドポイントのURLを返す
+func (s *Server) TokenURL() string { return s.URL + TokenPath }
+
+// RevokeURL は無効化エンドポイントのURLを返す
+func (s *Server) RevokeURL() string { return s.URL + RevokePath }
+
+// FailNext はエンドポイントへの次のリクエストから順に failures を返すようにする
+func (s *Server) FailNext(endpoint Endpoint, failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[endpoint] = append(s.failures[endpoint], failures...)
+}
+
+// Requests はエンドポイントが受け付けたリクエストの数を返す
+func (s *Server) Requests(endpoint Endpoint) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[endpoint]
+}
+
+// RevokeAll は発行済みのすべてのトークンを無効にする
+// 利用者がfreee上でアプリの連携を解除した状態を再現する
+func (s *Server) RevokeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.accessTokens)
+	clear(s.refreshTokens)
+	s.save()
+}
+
+// ExpireAccessTokens は発行済みのすべてのアクセストークンを期限切れにする
+func (s *Server) ExpireAccessTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.opts.Now()
+	for _, g := range s.accessTokens {
+		g.Expiry = now
+	}
+	s.save()
+}
+
+// Open はブラウザの代わりに認可URLにアクセスし、リダイレクト先のコールバックまで辿る
+// browser.Opener として使うことで、認可フローを利用者の操作なしに完了できる
+func (s *Server) Open(authURL string) error {
+	resp, err := http.Get(authURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("authorization redirect: %s", resp.Status)
+	}
+	return nil
+}
+
+// begin はリクエストを数え、注入されたエラーがあれば取り出す
+func (s *Server) begin(endpoint Endpoint) (Failure, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[endpoint]++
+	queue := s.failures[endpoint]
+	if len(queue) == 0 {
+		return Failure{}, false
+	}
+	s.failures[endpoint] = queue[1:]
+	return queue[0], true
+}
+
+// handleAuthorize は利用者の同意なしに認可コードを発行してリダイレクトする
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	failure, failed := s.begin(EndpointAuthorize)
+	q := r.URL.Query()
+
+	// クライアントやリダイレクトURLが不正な場合はリダイレクトしない（RFC 6749 4.1.2.1）
+	if q.Get("client_id") != s.opts.ClientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	redirectURI := q.Get("redirect_uri")
+	if redirectURI == "" {
+		http.Error(w, "missing redirect_uri", http.StatusBadRequest)
+		return
+	}
+	state := q.Get("state")
+
+	switch {
+	case failed:
+		s.redirectError(w, r, redirectURI, state, failure.Code, failure.Description)
+		return
+	case q.Get("response_type") != "code":
+		s.redirectError(w, r, redirectURI, state, "unsupported_response_type", "")
+		return
+	case q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256":
+		s.redirectError(w, r, redirectURI, state, "invalid_request", "PKCE with S256 is required")
+		return
+	}
+
+	code := randomString()
+	s.mu.Lock()
+	s.codes[code] = &authCode{
+		redirectURI:   redirectURI,
+		codeChallenge: q.Get("code_challenge"),
+		scope:         q.Get("scope"),
+		expiry:        s.opts.Now().Add(codeLifetime),
+	}
+	s.mu.Unlock()
+
+	if redirectURI == oobRedirectURL {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		oobPage.Execute(w, code)
+		return
+	}
+	s.redirect(w, r, redirectURI, url.Values{"code": {code}, "state": {state}})
+}
+
+var oobPage = template.Must(template.New("oob").Parse(
+	`<!DOCTYPE html><html><body><p>Authorization code:</p><pre id="code">{{.}}</pre></body></html>`))
+
+func (s *Server) redirectError(w http.ResponseWriter, r *http.Request, redirectURI, state, code, description string) {
+	params := url.Values{"error": {code}, "state": {state}}
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	s.redirect(w, r, redirectURI, params)
+}
+
+func (s *Server) redirect(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// tokenResponse はトークンエンドポイントのレスポンス
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope,omitempty"`
+	CreatedAt    int64  `json:"created_at"`
+	// RefreshTokenExpiresIn はリフレッシュトークンの有効期間（秒、無期限の場合は返さない）
+	RefreshTokenExpiresIn int64 `json:"refresh_token_expires_in,omitempty"`
+	CompanyID             int64 `json:"company_id,omitempty"`
+}
+
+// handleToken は認可コードまたはリフレッシュトークンをトークンに交換する
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	failure, failed := s.begin(EndpointToken)
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request", "POST is required")
+		return
+	}
+	if !s.authenticateClient(r) {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+	if failed {
+		writeFailure(w, failure)
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		s.exchangeCode(w, r)
+	case "refresh_token":
+		s.refresh(w, r)
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+}
+
+func (s *Server) exchangeCode(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 認可コードは1回だけ使用できる
+	code, ok := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	switch {
+	case !ok || !s.opts.Now().Before(code.expiry):
+		writeError(w, http.StatusBadRequest, "invalid_grant", "invalid or expired authorization code")
+	case r.PostForm.Get("redirect_uri") != code.redirectURI:
+		writeError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match")
+	case oauth2.S256ChallengeFromVerifier(r.PostForm.Get("code_verifier")) != code.codeChallenge:
+		writeError(w, http.StatusBadRequest, "invalid_grant", "code_verifier does not match")
+	default:
+		s.issue(w, code.scope)
+	}
+}
+
+func (s *Server) refresh(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// freeeと同様にリフレッシュトークンをローテーションし、使用済みのものは無効にする
+	refreshToken := r.PostForm.Get("refresh_token")
+	g, ok := s.refreshTokens[refreshToken]
+	delete(s.refreshTokens, refreshToken)
+	if !ok || g.expired(s.opts.Now()) {
+		s.save()
+		writeError(w, http.StatusBadRequest, "invalid_grant", "invalid or expired refresh token")
+		return
+	}
+	s.issue(w, g.Scope)
+}
+
+// issue はアクセストークンとリフレッシュトークンを発行する（s.mu を保持して呼ぶ）
+func (s *Server) issue(w http.ResponseWriter, scope string) {
+	now := s.opts.Now()
+	resp := tokenResponse{
+		AccessToken:  randomString(),
+		TokenType:    "bearer",
+		ExpiresIn:    int64(s.opts.AccessTokenLifetime / time.Second),
+		RefreshToken: randomString(),
+		Scope:        scope,
+		CreatedAt:    now.Unix(),
+		CompanyID:    s.opts.CompanyID,
+	}
+	s.accessTokens[resp.AccessToken] = &grant{Scope: scope, Expiry: now.Add(s.opts.AccessTokenLifetime)}
+	refresh := &grant{Scope: scope}
+	if s.opts.RefreshTokenLifetime > 0 {
+		refresh.Expiry = now.Add(s.opts.RefreshTokenLifetime)
+		resp.RefreshTokenExpiresIn = int64(s.opts.RefreshTokenLifetime / time.Second)
+	}
+	s.refreshTokens[resp.RefreshToken] = refresh
+	s.save()
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleRevoke はトークンを無効にする
+// RFC 7009 2.2: 不明なトークンに対しても200を返す
+func (s *Server) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	failure, failed := s.begin(EndpointRevoke)
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request", "POST is required")
+		return
+	}
+	if !s.authenticateClient(r) {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+	if failed {
+		writeFailure(w, failure)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	s.mu.Lock()
+	delete(s.accessTokens, token)
+	delete(s.refreshTokens, token)
+	s.save()
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleUsersMe は有効なアクセストークンに対してログインユーザーの情報を返す
+func (s *Server) handleUsersMe(w http.ResponseWriter, r *http.Request) {
+	failure, failed := s.begin(EndpointAPI)
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	g, known := s.accessTokens[accessToken]
+	valid := ok && known && !g.expired(s.opts.Now())
+	s.mu.Unlock()
+
+	switch {
+	case !valid:
+		writeError(w, http.StatusUnauthorized, "invalid_token", "the access token is invalid or expired")
+	case failed:
+		writeFailure(w, failure)
+	default:
+		user := map[string]any{
+			"id":           1,
+			"email":        "fake@example.com",
+			"display_name": "Fake User",
+		}
+		if r.URL.Query().Get("companies") == "true" {
+			user["companies"] = s.opts.Companies
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"user": user})
+	}
+}
+
+// authenticateClient はBasic認証またはフォームのクライアント認証情報を検証する
+// oauth2パッケージはBasic認証が拒否されるとフォームで再送するため、両方を受け付ける
+func (s *Server) authenticateClient(r *http.Request) bool {
+	if err := r.ParseForm(); err != nil {
+		return false
+	}
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	return subtle.ConstantTimeCompare([]byte(id), []byte(s.opts.ClientID)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(secret), []byte(s.opts.ClientSecret)) == 1
+}
+
+func writeFailure(w http.ResponseWriter, failure Failure) {
+	if failure.Code == "" {
+		w.WriteHeader(failure.Status)
+		return
+	}
+	writeError(w, failure.Status, failure.Code, failure.Description)
+}
+
+func writeError(w http.ResponseWriter, status int, code, description string) {
+	body := map[string]string{"error": code}
+	if description != "" {
+		body["error_description"] = description
+	}
+	writeJSON(w, status, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
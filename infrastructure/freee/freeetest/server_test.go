@@ -0,0 +1,264 @@
+package freeetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"freee-oauth-app/domain"
+	"freee-oauth-app/infrastructure/freee"
+)
+
+const testVerifier = "test-code-verifier-0123456789-abcdefghijklmnop"
+
+func newTestServer(t *testing.T, opts Options) *Server {
+	t.Helper()
+	server, err := NewServer(opts)
+	if err != nil {
+		t.Fatalf("failed to start fake server: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+// callbackServer は認可レスポンスのクエリを受け取るコールバックサーバーを起動する
+func callbackServer(t *testing.T) (redirectURL string, received chan map[string]string) {
+	t.Helper()
+	received = make(chan map[string]string, 1)
+	cb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		received <- map[string]string{"code": q.Get("code"), "state": q.Get("state"), "error": q.Get("error")}
+	}))
+	t.Cleanup(cb.Close)
+	return cb.URL + "/callback", received
+}
+
+func newProvider(server *Server, redirectURL string) *freee.FreeeOAuthProvider {
+	return freee.NewFreeeOAuthProviderWithEndpoint(DefaultClientID, DefaultClientSecret, redirectURL, []string{"read"},
+		server.AuthURL(), server.TokenURL(), server.RevokeURL())
+}
+
+// login は認可フローを完了してトークンを取得する
+func login(t *testing.T, server *Server) (*freee.FreeeOAuthProvider, *domain.Token) {
+	t.Helper()
+	redirectURL, received := callbackServer(t)
+	provider := newProvider(server, redirectURL)
+
+	if err := server.Open(provider.AuthorizationURL("test-state", testVerifier, "")); err != nil {
+		t.Fatalf("authorization failed: %v", err)
+	}
+	resp := <-received
+	if resp["state"] != "test-state" || resp["code"] == "" {
+		t.Fatalf("unexpected authorization response: %v", resp)
+	}
+
+	token, err := provider.Exchange(context.Background(), resp["code"], testVerifier, "")
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	return provider, token
+}
+
+func TestServer_AuthorizationCodeFlow(t *testing.T) {
+	server := newTestServer(t, Options{AccessTokenLifetime: time.Hour})
+
+	_, token := login(t, server)
+
+	if token.AccessToken == "" || token.RefreshToken == "" {
+		t.Fatalf("expected access and refresh tokens, got %+v", token)
+	}
+	if remaining := time.Until(token.Expiry); remaining < 59*time.Minute || remaining > time.Hour {
+		t.Errorf("expected token to expire in about 1h, got %s", remaining)
+	}
+	if strings.Join(token.Scopes, " ") != "read" {
+		t.Errorf("expected granted scope read, got %v", token.Scopes)
+	}
+}
+
+func TestServer_CodeIsSingleUseAndRequiresVerifier(t *testing.T) {
+	server := newTestServer(t, Options{})
+	redirectURL, received := callbackServer(t)
+	provider := newProvider(server, redirectURL)
+
+	server.Open(provider.AuthorizationURL("state", testVerifier, ""))
+	code := (<-received)["code"]
+
+	if _, err := provider.Exchange(context.Background(), code, "wrong-verifier", ""); !errors.Is(err, domain.ErrInvalidGrant) {
+		t.Errorf("expected invalid_grant for a wrong verifier, got %v", err)
+	}
+	if _, err := provider.Exchange(context.Background(), code, testVerifier, ""); !errors.Is(err, domain.ErrInvalidGrant) {
+		t.Errorf("expected invalid_grant for a reused code, got %v", err)
+	}
+}
+
+func TestServer_RefreshRotatesRefreshToken(t *testing.T) {
+	server := newTestServer(t, Options{})
+	provider, token := login(t, server)
+
+	refreshed, err := provider.Refresh(context.Background(), token)
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if refreshed.RefreshToken == token.RefreshToken || refreshed.AccessToken == token.AccessToken {
+		t.Error("expected new access and refresh tokens")
+	}
+
+	// 使用済みのリフレッシュトークンは無効
+	if _, err := provider.Refresh(context.Background(), token); !errors.Is(err, domain.ErrInvalidGrant) {
+		t.Errorf("expected invalid_grant for a rotated refresh token, got %v", err)
+	}
+	if got := server.Requests(EndpointToken); got != 3 {
+		t.Errorf("expected 3 token requests, got %d", got)
+	}
+}
+
+func TestServer_RefreshTokenExpiry(t *testing.T) {
+	now := time.Now()
+	server := newTestServer(t, Options{RefreshTokenLifetime: 24 * time.Hour, Now: func() time.Time { return now }})
+	provider, token := login(t, server)
+
+	now = now.Add(25 * time.Hour)
+
+	if _, err := provider.Refresh(context.Background(), token); !errors.Is(err, domain.ErrInvalidGrant) {
+		t.Errorf("expected invalid_grant for an expired refresh token, got %v", err)
+	}
+}
+
+func TestServer_Revoke(t *testing.T) {
+	server := newTestServer(t, Options{})
+	provider, token := login(t, server)
+
+	if err := provider.Revoke(context.Background(), token); err != nil {
+		t.Fatalf("revoke failed: %v", err)
+	}
+	if _, err := provider.Refresh(context.Background(), token); !errors.Is(err, domain.ErrInvalidGrant) {
+		t.Errorf("expected invalid_grant after revocation, got %v", err)
+	}
+}
+
+func TestServer_FailNext(t *testing.T) {
+	server := newTestServer(t, Options{})
+	provider, token := login(t, server)
+
+	server.FailNext(EndpointToken, Failure{Status: http.StatusServiceUnavailable, Code: "temporarily_unavailable"})
+
+	if _, err := provider.Refresh(context.Background(), token); !errors.Is(err, domain.ErrTransient) {
+		t.Errorf("expected injected transient error, got %v", err)
+	}
+	// 注入したエラーは1回だけ返し、リフレッシュトークンは消費しない
+	if _, err := provider.Refresh(context.Background(), token); err != nil {
+		t.Errorf("expected refresh to succeed after the injected failure, got %v", err)
+	}
+}
+
+func TestServer_AuthorizeFailure(t *testing.T) {
+	server := newTestServer(t, Options{})
+	redirectURL, received := callbackServer(t)
+	provider := newProvider(server, redirectURL)
+
+	server.FailNext(EndpointAuthorize, Failure{Code: "access_denied"})
+	server.Open(provider.AuthorizationURL("state", testVerifier, ""))
+
+	if resp := <-received; resp["error"] != "access_denied" || resp["state"] != "state" {
+		t.Errorf("expected access_denied redirect, got %v", resp)
+	}
+}
+
+func TestServer_UsersMe(t *testing.T) {
+	server := newTestServer(t, Options{})
+	_, token := login(t, server)
+
+	get := func() int {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+UsersMePath, nil)
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := get(); status != http.StatusOK {
+		t.Errorf("expected 200 with a valid token, got %d", status)
+	}
+	server.ExpireAccessTokens()
+	if status := get(); status != http.StatusUnauthorized {
+		t.Errorf("expected 401 with an expired token, got %d", status)
+	}
+}
+
+func TestServer_UsersMeCompanies(t *testing.T) {
+	companies := []Company{{ID: 10, DisplayName: "freee事務所", Role: "admin"}, {ID: 20, DisplayName: "freee商店", Role: "read_only"}}
+	server := newTestServer(t, Options{Companies: companies})
+	_, token := login(t, server)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+UsersMePath+"?companies=true", nil)
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		User struct {
+			Companies []Company `json:"companies"`
+		} `json:"user"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(body.User.Companies) != 2 || body.User.Companies[1] != companies[1] {
+		t.Errorf("expected companies %+v, got %+v", companies, body.User.Companies)
+	}
+}
+
+func TestServer_OOBShowsCode(t *testing.T) {
+	server := newTestServer(t, Options{})
+	provider := newProvider(server, "urn:ietf:wg:oauth:2.0:oob")
+
+	resp, err := http.Get(provider.AuthorizationURL("state", testVerifier, ""))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if !strings.Contains(string(body), `<pre id="code">`) {
+		t.Errorf("expected authorization code page, got %s", body)
+	}
+}
+
+func TestServer_RejectsUnknownClient(t *testing.T) {
+	server := newTestServer(t, Options{})
+	provider := freee.NewFreeeOAuthProviderWithEndpoint(DefaultClientID, "wrong-secret", "http://localhost/callback", nil,
+		server.AuthURL(), server.TokenURL(), server.RevokeURL())
+
+	_, err := provider.Refresh(context.Background(), domain.NewToken("access", "refresh", time.Now()))
+
+	if !errors.Is(err, domain.ErrInvalidClient) {
+		t.Errorf("expected invalid_client, got %v", err)
+	}
+}
+
+func TestServer_StateFileSharesTokensAcrossServers(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	first := newTestServer(t, Options{StateFile: stateFile})
+	_, token := login(t, first)
+	first.Close()
+
+	second := newTestServer(t, Options{StateFile: stateFile})
+	provider := newProvider(second, "http://localhost/callback")
+
+	if _, err := provider.Refresh(context.Background(), token); err != nil {
+		t.Errorf("expected refresh token issued by another server to be accepted, got %v", err)
+	}
+}
@@ -1,7 +1,17 @@
 package freee
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"freee-oauth-app/domain"
@@ -10,38 +20,113 @@ import (
 	"golang.org/x/oauth2"
 )
 
+// APIBaseURL はfreee APIのベースURL
+const APIBaseURL = "https://api.freee.co.jp"
+
+// AuthURL・TokenURL はfreeeの認可エンドポイントとトークンエンドポイント
+const (
+	AuthURL  = auth.AuthURL
+	TokenURL = auth.TokenURL
+)
+
+// maxTokenResponseSize はトークンレスポンスとして読み込む最大サイズ（oauth2パッケージと同じ）
+const maxTokenResponseSize = 1 << 20
+
+// RevokeURL はfreeeのトークン無効化エンドポイント
+const RevokeURL = "https://accounts.secure.freee.co.jp/public_api/revoke"
+
+// DefaultScopes はスコープが指定されなかった場合に要求するスコープ
+var DefaultScopes = []string{"read", "write"}
+
 // FreeeOAuthProvider はfreee APIのOAuth認可プロバイダー
 type FreeeOAuthProvider struct {
-	config *auth.Config
+	config       *auth.Config
+	scopes       []string
+	clientID     string
+	clientSecret string
+	revokeURL    string
+	// skew はトークンエンドポイントの Date ヘッダから認可サーバーとの時刻のずれを記録する
+	skew *domain.ClockSkew
 }
 
 // NewFreeeOAuthProvider は新しいFreeeOAuthProviderを生成する
-func NewFreeeOAuthProvider(clientID, clientSecret, redirectURL string) *FreeeOAuthProvider {
+// scopes が空の場合は DefaultScopes を要求する
+func NewFreeeOAuthProvider(clientID, clientSecret, redirectURL string, scopes []string) *FreeeOAuthProvider {
 	return &FreeeOAuthProvider{
-		config: auth.NewConfig(clientID, clientSecret, redirectURL, []string{"read", "write"}),
+		config:       auth.NewConfig(clientID, clientSecret, redirectURL, scopesOrDefault(scopes)),
+		scopes:       scopesOrDefault(scopes),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		revokeURL:    RevokeURL,
+		skew:         domain.NewClockSkew(domain.SystemClock),
 	}
 }
 
 // NewFreeeOAuthProviderWithEndpoint はカスタムエンドポイントでFreeeOAuthProviderを生成する
-func NewFreeeOAuthProviderWithEndpoint(clientID, clientSecret, redirectURL, authURL, tokenURL string) *FreeeOAuthProvider {
+func NewFreeeOAuthProviderWithEndpoint(clientID, clientSecret, redirectURL string, scopes []string, authURL, tokenURL, revokeURL string) *FreeeOAuthProvider {
 	return &FreeeOAuthProvider{
-		config: auth.NewConfigWithEndpoint(clientID, clientSecret, redirectURL, []string{"read", "write"}, authURL, tokenURL),
+		config:       auth.NewConfigWithEndpoint(clientID, clientSecret, redirectURL, scopesOrDefault(scopes), authURL, tokenURL),
+		scopes:       scopesOrDefault(scopes),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		revokeURL:    revokeURL,
+		skew:         domain.NewClockSkew(domain.SystemClock),
+	}
+}
+
+// WithClock は有効期限の計算に使うローカルの時計を設定する（既定: domain.SystemClock）
+// ユースケースと同じ時計を渡す
+func (p *FreeeOAuthProvider) WithClock(clock domain.Clock) *FreeeOAuthProvider {
+	p.skew = domain.NewClockSkew(clock)
+	return p
+}
+
+// ClockSkew は最後に観測した認可サーバーとローカルの時計のずれを返す
+func (p *FreeeOAuthProvider) ClockSkew() time.Duration {
+	return p.skew.Skew()
+}
+
+func scopesOrDefault(scopes []string) []string {
+	if len(scopes) == 0 {
+		return DefaultScopes
 	}
+	return scopes
+}
+
+// Scopes は認可時に要求するスコープを返す
+func (p *FreeeOAuthProvider) Scopes() []string {
+	return p.scopes
 }
 
-// AuthorizationURL は認可URLを生成する
-func (p *FreeeOAuthProvider) AuthorizationURL(state string) string {
-	return p.config.AuthCodeURL(state)
+// AuthorizationURL はPKCE(S256)のコードチャレンジ付きの認可URLを生成する
+// redirectURL が空の場合は生成時に指定したリダイレクトURLを使用する
+func (p *FreeeOAuthProvider) AuthorizationURL(state, codeVerifier, redirectURL string) string {
+	opts := []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(codeVerifier)}
+	if redirectURL != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("redirect_uri", redirectURL))
+	}
+	return p.config.AuthCodeURL(state, opts...)
 }
 
-// Exchange は認可コードをトークンに交換する
-func (p *FreeeOAuthProvider) Exchange(ctx context.Context, code string) (*domain.Token, error) {
-	token, err := p.config.Exchange(ctx, code)
+// Exchange は認可コードをコードベリファイアと共にトークンに交換する
+// redirectURL には認可URLの生成時と同じ値を指定する
+func (p *FreeeOAuthProvider) Exchange(ctx context.Context, code, codeVerifier, redirectURL string) (*domain.Token, error) {
+	opts := []oauth2.AuthCodeOption{oauth2.VerifierOption(codeVerifier)}
+	if redirectURL != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("redirect_uri", redirectURL))
+	}
+	ctx, recorder := p.recordResponse(ctx)
+	token, err := p.config.Exchange(ctx, code, opts...)
 	if err != nil {
-		return nil, err
+		return nil, classifyError(ctx, "exchange", err, recorder.sent())
 	}
 
-	return domain.FromOAuth2Token(token), nil
+	// RFC 6749 5.1: scopeが省略された場合は要求したスコープが付与されている
+	result := p.fromOAuth2Token(token, recorder.fields())
+	if len(result.Scopes) == 0 {
+		result.Scopes = p.scopes
+	}
+	return result, nil
 }
 
 // Refresh はリフレッシュトークンを使用してトークンを更新する
@@ -52,11 +137,264 @@ func (p *FreeeOAuthProvider) Refresh(ctx context.Context, token *domain.Token) (
 		Expiry:       time.Now().Add(-time.Hour), // 期限切れとしてマーク
 	}
 
+	ctx, recorder := p.recordResponse(ctx)
 	tokenSource := p.config.TokenSource(ctx, oauth2Token)
 	newToken, err := tokenSource.Token()
+	if err != nil {
+		return nil, classifyError(ctx, "refresh", err, recorder.sent())
+	}
+
+	// RFC 6749 6: scopeが省略された場合は元のトークンと同じスコープが付与されている
+	result := p.fromOAuth2Token(newToken, recorder.fields())
+	if len(result.Scopes) == 0 {
+		result.Scopes = token.Scopes
+	}
+	// リフレッシュトークンがローテーションされなかった場合は、有効期限も引き継ぐ
+	if result.RefreshToken == token.RefreshToken {
+		result.RefreshTokenExpiry = token.RefreshTokenExpiry
+	}
+	if result.CompanyID == 0 {
+		result.CompanyID = token.CompanyID
+	}
+	return result, nil
+}
+
+// Revoke はRFC 7009に従いリフレッシュトークンとアクセストークンを無効化する
+// リフレッシュトークンを先に無効化することで、以降のトークン再発行を防ぐ
+func (p *FreeeOAuthProvider) Revoke(ctx context.Context, token *domain.Token) error {
+	if token.HasRefreshToken() {
+		if err := p.revoke(ctx, token.RefreshToken, "refresh_token"); err != nil {
+			return err
+		}
+	}
+	if token.AccessToken != "" {
+		if err := p.revoke(ctx, token.AccessToken, "access_token"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *FreeeOAuthProvider) revoke(ctx context.Context, token, tokenTypeHint string) error {
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {tokenTypeHint},
+		"client_id":       {p.clientID},
+		"client_secret":   {p.clientSecret},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.revokeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient(ctx).Do(req)
+	if err != nil {
+		return &domain.OAuthError{Op: "revoke", Err: err}
+	}
+	defer resp.Body.Close()
+
+	// RFC 7009: 無効なトークンに対しても200が返される
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return revokeError(tokenTypeHint, resp.StatusCode, body)
+	}
+	return nil
+}
+
+// standardFields はRFC 6749 5.1で定義されたトークンレスポンスのフィールド
+var standardFields = []string{"access_token", "token_type", "expires_in", "refresh_token", "scope"}
+
+// fromOAuth2Token はトークンレスポンスをdomain.Tokenに変換する
+//
+// 有効期限はfreeeが返す発行時刻（created_at）から expires_in 後とし、
+// 認可サーバーとの時刻のずれを補正してローカルの時計の時刻で保存する。
+// 発行時刻がない場合は、注入された時計の現在時刻から計算する。
+// fields はレスポンスのJSONで、RFC 6749で定義されていないフィールドを Extra に保存する。
+func (p *FreeeOAuthProvider) fromOAuth2Token(t *oauth2.Token, fields map[string]any) *domain.Token {
+	token := domain.FromOAuth2Token(t)
+	issuedAt := p.skew.Now()
+	if createdAt, ok := unixTime(t.Extra("created_at")); ok {
+		issuedAt = p.skew.Local(createdAt)
+	}
+	token.IssuedAt = issuedAt
+	if t.ExpiresIn > 0 {
+		token.Expiry = issuedAt.Add(time.Duration(t.ExpiresIn) * time.Second)
+	}
+	// refresh_token_expires_in が含まれない場合、リフレッシュトークンの有効期限は不明とする
+	if sec, ok := integer(t.Extra("refresh_token_expires_in")); ok && sec > 0 && token.HasRefreshToken() {
+		token.RefreshTokenExpiry = issuedAt.Add(time.Duration(sec) * time.Second)
+	}
+	if id, ok := integer(t.Extra("company_id")); ok {
+		token.CompanyID = id
+	}
+
+	for _, name := range standardFields {
+		delete(fields, name)
+	}
+	if len(fields) > 0 {
+		token.Extra = fields
+	}
+	return token
+}
+
+// integer はトークンレスポンスの整数の値（数値または文字列）を解析する
+func integer(v any) (int64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return int64(v), true
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// unixTime はトークンレスポンスのUNIX時刻の値を解析する
+func unixTime(v any) (time.Time, bool) {
+	sec, ok := integer(v)
+	if !ok || sec <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(sec, 0), true
+}
+
+// recordResponse はトークンエンドポイントのレスポンスを記録するcontextを返す
+// ctx に設定されたHTTPクライアントのタイムアウトなどの設定は引き継ぐ
+func (p *FreeeOAuthProvider) recordResponse(ctx context.Context) (context.Context, *responseRecorder) {
+	client := *httpClient(ctx)
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	recorder := &responseRecorder{base: transport, skew: p.skew}
+	client.Transport = recorder
+	return context.WithValue(ctx, oauth2.HTTPClient, &client), recorder
+}
+
+// responseRecorder はトークンエンドポイントのレスポンスを記録する
+//
+// Date ヘッダから認可サーバーとの時刻のずれを記録し、成功したレスポンスのJSONを保持する。
+// oauth2.Token からはレスポンスのフィールドを列挙できないため、未知のフィールドを保存するのに使う。
+// 失敗したリクエストを再試行してよいか判定できるよう、リクエストを送信し終えたかも記録する。
+type responseRecorder struct {
+	base http.RoundTripper
+	skew *domain.ClockSkew
+
+	mu          sync.Mutex
+	body        map[string]any
+	requestSent bool
+}
+
+func (r *responseRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				r.mu.Lock()
+				r.requestSent = true
+				r.mu.Unlock()
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		r.skew.Observe(date)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTokenResponseSize))
+	resp.Body.Close()
 	if err != nil {
 		return nil, err
 	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	var body map[string]any
+	if json.Unmarshal(data, &body) == nil {
+		r.mu.Lock()
+		r.body = body
+		r.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// sent はリクエストを認可サーバーに送信し終えたかを返す
+func (r *responseRecorder) sent() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requestSent
+}
+
+// fields は最後に成功したレスポンスのJSONを返す（JSONでない場合はnil）
+func (r *responseRecorder) fields() map[string]any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.body
+}
+
+// errorResponse はRFC 6749 5.2のエラーレスポンス
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// revokeError は無効化エンドポイントのエラーレスポンス（RFC 7009 2.2.1）から OAuthError を生成する
+func revokeError(tokenTypeHint string, statusCode int, body []byte) error {
+	var resp errorResponse
+	json.Unmarshal(body, &resp)
+	err := &domain.OAuthError{
+		Op:          "revoke " + tokenTypeHint,
+		Code:        resp.Error,
+		Description: resp.ErrorDescription,
+		StatusCode:  statusCode,
+	}
+	if err.Code == "" {
+		if text := strings.TrimSpace(string(body)); text != "" {
+			err.Err = errors.New(text)
+		}
+	}
+	return err
+}
 
-	return domain.FromOAuth2Token(newToken), nil
+// classifyError はトークンエンドポイントのエラーを OAuthError に変換する
+// *oauth2.RetrieveError からエラーコード・説明・HTTPステータスを取り出し、元のエラーはラップして保持する
+//
+// 呼び出し元のcontextのキャンセル・期限切れはそのまま返す。HTTPクライアントのタイムアウトは
+// context.DeadlineExceeded として扱われるが、通信の一時的な障害として分類する。
+// sent にはリクエストを送信し終えたかを指定する。
+func classifyError(ctx context.Context, op string, err error, sent bool) error {
+	if ctx.Err() != nil {
+		return err
+	}
+	oauthErr := &domain.OAuthError{Op: op, Err: err, Unsent: !sent}
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		oauthErr.Code = retrieveErr.ErrorCode
+		oauthErr.Description = retrieveErr.ErrorDescription
+		if retrieveErr.Response != nil {
+			oauthErr.StatusCode = retrieveErr.Response.StatusCode
+		}
+		// Content-Typeがapplication/jsonでない場合、oauth2パッケージはエラーコードを解析しない
+		var resp errorResponse
+		if oauthErr.Code == "" && json.Unmarshal(retrieveErr.Body, &resp) == nil {
+			oauthErr.Code = resp.Error
+			oauthErr.Description = resp.ErrorDescription
+		}
+	}
+	return oauthErr
+}
+
+// httpClient はcontextに設定されたHTTPクライアントを返す（oauth2パッケージと同じ規約）
+func httpClient(ctx context.Context) *http.Client {
+	if c, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok && c != nil {
+		return c
+	}
+	return http.DefaultClient
 }
@@ -3,6 +3,7 @@ package freee
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -10,12 +11,14 @@ import (
 	"time"
 
 	"freee-oauth-app/domain"
+
+	"golang.org/x/oauth2"
 )
 
 func TestFreeeOAuthProvider_AuthorizationURL(t *testing.T) {
-	provider := NewFreeeOAuthProvider("client_id", "client_secret", "http://localhost/callback")
+	provider := NewFreeeOAuthProvider("client_id", "client_secret", "http://localhost/callback", nil)
 
-	url := provider.AuthorizationURL("test_state")
+	url := provider.AuthorizationURL("test_state", "test_verifier", "")
 
 	if !strings.Contains(url, "accounts.secure.freee.co.jp") {
 		t.Error("expected freee authorization URL")
@@ -32,6 +35,68 @@ func TestFreeeOAuthProvider_AuthorizationURL(t *testing.T) {
 	if !strings.Contains(url, "response_type=code") {
 		t.Error("expected response_type=code in URL")
 	}
+	if !strings.Contains(url, "code_challenge_method=S256") {
+		t.Error("expected code_challenge_method=S256 in URL")
+	}
+	if !strings.Contains(url, "code_challenge="+oauth2.S256ChallengeFromVerifier("test_verifier")) {
+		t.Error("expected S256 code_challenge in URL")
+	}
+	if strings.Contains(url, "test_verifier") {
+		t.Error("code verifier must not be sent in authorization URL")
+	}
+	if !strings.Contains(url, "scope=read+write") {
+		t.Error("expected default scopes in URL")
+	}
+}
+
+func TestFreeeOAuthProvider_AuthorizationURL_OverridesRedirectURL(t *testing.T) {
+	provider := NewFreeeOAuthProvider("client_id", "client_secret", "http://localhost:8080/callback", nil)
+
+	url := provider.AuthorizationURL("test_state", "test_verifier", "http://localhost:8081/callback")
+
+	if !strings.Contains(url, "redirect_uri=http%3A%2F%2Flocalhost%3A8081%2Fcallback") {
+		t.Errorf("expected overridden redirect_uri in URL, got %s", url)
+	}
+}
+
+func TestFreeeOAuthProvider_Exchange_SendsRedirectURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if got := r.Form.Get("redirect_uri"); got != "http://localhost:8081/callback" {
+			t.Errorf("expected overridden redirect_uri, got %q", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "test_access_token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer server.Close()
+
+	provider := NewFreeeOAuthProviderWithEndpoint(
+		"client_id",
+		"client_secret",
+		"http://localhost:8080/callback",
+		nil,
+		"http://example.com/auth",
+		server.URL,
+		"http://example.com/revoke",
+	)
+
+	if _, err := provider.Exchange(context.Background(), "auth_code", "test_verifier", "http://localhost:8081/callback"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFreeeOAuthProvider_AuthorizationURL_WithScopes(t *testing.T) {
+	provider := NewFreeeOAuthProvider("client_id", "client_secret", "http://localhost/callback", []string{"read"})
+
+	url := provider.AuthorizationURL("test_state", "test_verifier", "")
+
+	if !strings.Contains(url, "scope=read&") && !strings.HasSuffix(url, "scope=read") {
+		t.Errorf("expected only read scope in URL, got %s", url)
+	}
 }
 
 func TestFreeeOAuthProvider_Exchange_Success(t *testing.T) {
@@ -40,6 +105,9 @@ func TestFreeeOAuthProvider_Exchange_Success(t *testing.T) {
 		if r.Method != "POST" {
 			t.Errorf("expected POST, got %s", r.Method)
 		}
+		if v := r.FormValue("code_verifier"); v != "test_verifier" {
+			t.Errorf("expected code_verifier 'test_verifier', got '%s'", v)
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -55,12 +123,14 @@ func TestFreeeOAuthProvider_Exchange_Success(t *testing.T) {
 		"client_id",
 		"client_secret",
 		"http://localhost/callback",
+		nil,
 		"http://example.com/auth",
 		server.URL,
+		"http://example.com/revoke",
 	)
 
 	ctx := context.Background()
-	token, err := provider.Exchange(ctx, "auth_code")
+	token, err := provider.Exchange(ctx, "auth_code", "test_verifier", "")
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -71,6 +141,42 @@ func TestFreeeOAuthProvider_Exchange_Success(t *testing.T) {
 	if token.RefreshToken != "test_refresh_token" {
 		t.Errorf("expected test_refresh_token, got %s", token.RefreshToken)
 	}
+	if strings.Join(token.Scopes, " ") != "read write" {
+		t.Errorf("expected requested scopes to be recorded, got %v", token.Scopes)
+	}
+}
+
+func TestFreeeOAuthProvider_Exchange_RecordsGrantedScopes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "test_access_token",
+			"refresh_token": "test_refresh_token",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+			"scope":         "read",
+		})
+	}))
+	defer server.Close()
+
+	provider := NewFreeeOAuthProviderWithEndpoint(
+		"client_id",
+		"client_secret",
+		"http://localhost/callback",
+		[]string{"read", "write"},
+		"http://example.com/auth",
+		server.URL,
+		"http://example.com/revoke",
+	)
+
+	token, err := provider.Exchange(context.Background(), "auth_code", "test_verifier", "")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(token.Scopes, " ") != "read" {
+		t.Errorf("expected granted scopes [read], got %v", token.Scopes)
+	}
 }
 
 func TestFreeeOAuthProvider_Exchange_Error(t *testing.T) {
@@ -87,15 +193,135 @@ func TestFreeeOAuthProvider_Exchange_Error(t *testing.T) {
 		"client_id",
 		"client_secret",
 		"http://localhost/callback",
+		nil,
 		"http://example.com/auth",
 		server.URL,
+		"http://example.com/revoke",
 	)
 
 	ctx := context.Background()
-	_, err := provider.Exchange(ctx, "invalid_code")
+	_, err := provider.Exchange(ctx, "invalid_code", "test_verifier", "")
 
 	if err == nil {
-		t.Error("expected error for invalid code")
+		t.Fatal("expected error for invalid code")
+	}
+	var oauthErr *domain.OAuthError
+	if !errors.As(err, &oauthErr) {
+		t.Fatalf("expected OAuthError, got %T", err)
+	}
+	if oauthErr.Code != "invalid_grant" || oauthErr.Description != "Invalid authorization code" || oauthErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected OAuthError: %+v", oauthErr)
+	}
+	var retrieveErr *oauth2.RetrieveError
+	if !errors.As(err, &retrieveErr) {
+		t.Error("expected underlying oauth2.RetrieveError to be preserved")
+	}
+	if !errors.Is(err, domain.ErrInvalidGrant) {
+		t.Error("expected error to match ErrInvalidGrant")
+	}
+}
+
+func TestFreeeOAuthProvider_Refresh_ClassifiesErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		revoked   bool
+		transient bool
+	}{
+		{"invalid_grant", http.StatusBadRequest, `{"error":"invalid_grant","error_description":"refresh token revoked"}`, true, false},
+		{"temporarily_unavailable", http.StatusServiceUnavailable, `{"error":"temporarily_unavailable"}`, false, true},
+		{"server error without body", http.StatusBadGateway, ``, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			provider := NewFreeeOAuthProviderWithEndpoint(
+				"client_id",
+				"client_secret",
+				"http://localhost/callback",
+				nil,
+				"http://example.com/auth",
+				server.URL,
+				"http://example.com/revoke",
+			)
+
+			_, err := provider.Refresh(context.Background(), domain.NewToken("old_access", "old_refresh", time.Now().Add(-time.Hour)))
+
+			var oauthErr *domain.OAuthError
+			if !errors.As(err, &oauthErr) || oauthErr.StatusCode != tt.status {
+				t.Fatalf("expected OAuthError with status %d, got %v", tt.status, err)
+			}
+			if got := errors.Is(err, domain.ErrInvalidGrant); got != tt.revoked {
+				t.Errorf("errors.Is(ErrInvalidGrant) = %t, want %t", got, tt.revoked)
+			}
+			if got := errors.Is(err, domain.ErrTransient); got != tt.transient {
+				t.Errorf("errors.Is(ErrTransient) = %t, want %t", got, tt.transient)
+			}
+		})
+	}
+}
+
+func TestFreeeOAuthProvider_Refresh_NetworkErrorIsTransient(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	tokenURL := server.URL
+	server.Close()
+
+	provider := NewFreeeOAuthProviderWithEndpoint(
+		"client_id",
+		"client_secret",
+		"http://localhost/callback",
+		nil,
+		"http://example.com/auth",
+		tokenURL,
+		"http://example.com/revoke",
+	)
+
+	_, err := provider.Refresh(context.Background(), domain.NewToken("old_access", "old_refresh", time.Now().Add(-time.Hour)))
+
+	if !errors.Is(err, domain.ErrTransient) {
+		t.Errorf("expected connection failure to be transient, got %v", err)
+	}
+	var oauthErr *domain.OAuthError
+	if !errors.As(err, &oauthErr) || !oauthErr.Unsent {
+		t.Errorf("expected connection failure to be marked as unsent, got %+v", oauthErr)
+	}
+}
+
+func TestFreeeOAuthProvider_Refresh_ClientTimeoutIsTransient(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	provider := NewFreeeOAuthProviderWithEndpoint(
+		"client_id",
+		"client_secret",
+		"http://localhost/callback",
+		nil,
+		"http://example.com/auth",
+		server.URL,
+		"http://example.com/revoke",
+	)
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Timeout: 50 * time.Millisecond})
+
+	_, err := provider.Refresh(ctx, domain.NewToken("old_access", "old_refresh", time.Now().Add(-time.Hour)))
+
+	if !errors.Is(err, domain.ErrTransient) {
+		t.Fatalf("expected client timeout to be transient, got %v", err)
+	}
+	// リフレッシュトークンを送信した後のタイムアウトは、ローテーション済みの可能性があるため再試行しない
+	var oauthErr *domain.OAuthError
+	if !errors.As(err, &oauthErr) || oauthErr.IsRetryableGrant() {
+		t.Errorf("expected a timeout after sending not to be retryable, got %+v", oauthErr)
 	}
 }
 
@@ -115,8 +341,10 @@ func TestFreeeOAuthProvider_Refresh_Success(t *testing.T) {
 		"client_id",
 		"client_secret",
 		"http://localhost/callback",
+		nil,
 		"http://example.com/auth",
 		server.URL,
+		"http://example.com/revoke",
 	)
 
 	oldToken := domain.NewToken("old_access", "old_refresh", time.Now().Add(-time.Hour))
@@ -130,3 +358,226 @@ func TestFreeeOAuthProvider_Refresh_Success(t *testing.T) {
 		t.Errorf("expected new_access_token, got %s", newToken.AccessToken)
 	}
 }
+
+func TestFreeeOAuthProvider_Refresh_CorrectsClockSkew(t *testing.T) {
+	// 認可サーバーの時計がローカルより10分進んでいる
+	serverNow := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	createdAt := serverNow.Add(-30 * time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Date", serverNow.UTC().Format(http.TimeFormat))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "new_access_token",
+			"refresh_token": "new_refresh_token",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+			"created_at":    createdAt.Unix(),
+		})
+	}))
+	defer server.Close()
+
+	provider := NewFreeeOAuthProviderWithEndpoint(
+		"client_id",
+		"client_secret",
+		"http://localhost/callback",
+		nil,
+		"http://example.com/auth",
+		server.URL,
+		"http://example.com/revoke",
+	)
+
+	newToken, err := provider.Refresh(context.Background(), domain.NewToken("old_access", "old_refresh", time.Now().Add(-time.Hour)))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if skew := provider.ClockSkew(); skew < 9*time.Minute || skew > 11*time.Minute {
+		t.Errorf("expected about 10m of skew, got %s", skew)
+	}
+	// 有効期限は発行時刻をローカルの時計に変換して計算する（発行から30秒経過している）
+	if remaining := time.Until(newToken.Expiry); remaining < 59*time.Minute || remaining > 59*time.Minute+31*time.Second {
+		t.Errorf("expected about 59m30s remaining on the local clock, got %s", remaining)
+	}
+}
+
+func TestFreeeOAuthProvider_Exchange_ExpiryUsesInjectedClock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access_token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"created_at":   time.Now().Unix(),
+		})
+	}))
+	defer server.Close()
+
+	// ローカルの時計が1日進んでいる
+	now := time.Now().Add(24 * time.Hour)
+	provider := NewFreeeOAuthProviderWithEndpoint("client_id", "client_secret", "http://localhost/callback", nil,
+		"http://example.com/auth", server.URL, "http://example.com/revoke",
+	).WithClock(domain.ClockFunc(func() time.Time { return now }))
+
+	token, err := provider.Exchange(context.Background(), "code", "verifier", "")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if remaining := token.Expiry.Sub(now); remaining < 59*time.Minute || remaining > 61*time.Minute {
+		t.Errorf("expected expiry about 1h after the injected clock, got %s", remaining)
+	}
+}
+
+func TestFreeeOAuthProvider_Exchange_RecordsResponseMetadata(t *testing.T) {
+	createdAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":             "access_token",
+			"refresh_token":            "refresh_token",
+			"token_type":               "bearer",
+			"expires_in":               21600,
+			"scope":                    "read",
+			"created_at":               createdAt.Unix(),
+			"refresh_token_expires_in": 86400,
+			"company_id":               12345,
+			"external_cid":             "cid",
+		})
+	}))
+	defer server.Close()
+
+	provider := NewFreeeOAuthProviderWithEndpoint("client_id", "client_secret", "http://localhost/callback", nil,
+		"http://example.com/auth", server.URL, "http://example.com/revoke")
+
+	token, err := provider.Exchange(context.Background(), "code", "verifier", "")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.TokenType != "bearer" {
+		t.Errorf("expected token type bearer, got %q", token.TokenType)
+	}
+	if !token.IssuedAt.Equal(createdAt) {
+		t.Errorf("expected issued at %v, got %v", createdAt, token.IssuedAt)
+	}
+	if want := createdAt.Add(24 * time.Hour); !token.RefreshTokenExpiry.Equal(want) {
+		t.Errorf("expected refresh token expiry %v, got %v", want, token.RefreshTokenExpiry)
+	}
+	if token.CompanyID != 12345 {
+		t.Errorf("expected company id 12345, got %d", token.CompanyID)
+	}
+	if token.Extra["external_cid"] != "cid" || token.Extra["created_at"] == nil {
+		t.Errorf("expected freee-specific fields in extra, got %v", token.Extra)
+	}
+	if _, ok := token.Extra["access_token"]; ok {
+		t.Error("standard fields must not be stored in extra")
+	}
+}
+
+func TestFreeeOAuthProvider_Refresh_RefreshTokenExpiry(t *testing.T) {
+	refreshToken := "rotated_refresh_token"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "new_access_token",
+			"refresh_token": refreshToken,
+			"token_type":    "bearer",
+			"expires_in":    3600,
+		})
+	}))
+	defer server.Close()
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	provider := NewFreeeOAuthProviderWithEndpoint("client_id", "client_secret", "http://localhost/callback", nil,
+		"http://example.com/auth", server.URL, "http://example.com/revoke",
+	).WithClock(domain.ClockFunc(func() time.Time { return now }))
+	old := domain.NewToken("old_access", "old_refresh", now.Add(-time.Hour))
+	old.RefreshTokenExpiry = now.Add(24 * time.Hour)
+	old.CompanyID = 12345
+
+	// refresh_token_expires_in が含まれない場合、ローテーションされたリフレッシュトークンの有効期限は不明
+	rotated, err := provider.Refresh(context.Background(), old)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !rotated.RefreshTokenExpiry.IsZero() {
+		t.Errorf("expected unknown refresh token expiry, got %v", rotated.RefreshTokenExpiry)
+	}
+	if rotated.CompanyID != 12345 {
+		t.Errorf("expected company id to be kept, got %d", rotated.CompanyID)
+	}
+
+	// ローテーションされなかった場合は、元の有効期限を引き継ぐ
+	refreshToken = "old_refresh"
+	kept, err := provider.Refresh(context.Background(), old)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !kept.RefreshTokenExpiry.Equal(old.RefreshTokenExpiry) {
+		t.Errorf("expected refresh token expiry %v to be kept, got %v", old.RefreshTokenExpiry, kept.RefreshTokenExpiry)
+	}
+}
+
+func TestFreeeOAuthProvider_Revoke_Success(t *testing.T) {
+	var revoked []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("expected POST, got %s", r.Method)
+		}
+		if r.FormValue("client_id") != "client_id" || r.FormValue("client_secret") != "client_secret" {
+			t.Error("expected client credentials in revoke request")
+		}
+		revoked = append(revoked, r.FormValue("token_type_hint")+":"+r.FormValue("token"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	provider := NewFreeeOAuthProviderWithEndpoint(
+		"client_id",
+		"client_secret",
+		"http://localhost/callback",
+		nil,
+		"http://example.com/auth",
+		"http://example.com/token",
+		server.URL,
+	)
+
+	token := domain.NewToken("access", "refresh", time.Now().Add(time.Hour))
+	if err := provider.Revoke(context.Background(), token); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"refresh_token:refresh", "access_token:access"}
+	if strings.Join(revoked, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected revocations %v, got %v", expected, revoked)
+	}
+}
+
+func TestFreeeOAuthProvider_Revoke_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": "invalid_client",
+		})
+	}))
+	defer server.Close()
+
+	provider := NewFreeeOAuthProviderWithEndpoint(
+		"client_id",
+		"client_secret",
+		"http://localhost/callback",
+		nil,
+		"http://example.com/auth",
+		"http://example.com/token",
+		server.URL,
+	)
+
+	token := domain.NewToken("access", "refresh", time.Now().Add(time.Hour))
+	err := provider.Revoke(context.Background(), token)
+	if err == nil {
+		t.Fatal("expected error when revocation is rejected")
+	}
+	if !errors.Is(err, domain.ErrInvalidClient) {
+		t.Errorf("expected error to match ErrInvalidClient, got %v", err)
+	}
+}
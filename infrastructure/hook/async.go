@@ -0,0 +1,93 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"freee-oauth-app/domain"
+)
+
+var (
+	// ErrQueueFull は処理待ちのイベントが多すぎるため、イベントを破棄したことを表す
+	ErrQueueFull = errors.New("hook queue is full")
+	// ErrClosed は Close 後にイベントを受け取ったことを表す
+	ErrClosed = errors.New("hook is closed")
+)
+
+// asyncQueueSize は処理待ちにできるイベントの数
+const asyncQueueSize = 64
+
+// Handler はイベントを処理するフック（ExecHook・Webhook）
+type Handler interface {
+	Handle(ctx context.Context, event domain.Event) error
+}
+
+// Async はフックを呼び出し元から切り離し、イベントを発行順に1つずつ処理する
+//
+// 遅いフックがトークンの取得やブローカーの応答を待たせないよう、Handle はイベントを
+// キューに積んですぐに戻る。フックの失敗は onError に渡す。
+// Close はキューに積まれたイベントの処理が終わるまで待つため、終了前に呼び出す。
+type Async struct {
+	handler Handler
+	onError func(domain.Event, error)
+	queue   chan queuedEvent
+	done    chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+type queuedEvent struct {
+	ctx   context.Context
+	event domain.Event
+}
+
+// NewAsync はフックを別のゴルーチンで処理するAsyncを生成する
+func NewAsync(handler Handler, onError func(domain.Event, error)) *Async {
+	a := &Async{
+		handler: handler,
+		onError: onError,
+		queue:   make(chan queuedEvent, asyncQueueSize),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Handle はイベントをキューに積む
+// 呼び出し元のキャンセルはフックに伝えない（値は引き継ぐ）。
+// キューがいっぱいの場合は ErrQueueFull、Close 後は ErrClosed を返す。
+func (a *Async) Handle(ctx context.Context, event domain.Event) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return ErrClosed
+	}
+	select {
+	case a.queue <- queuedEvent{ctx: context.WithoutCancel(ctx), event: event}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close は新しいイベントの受け付けを止め、キューに積まれたイベントの処理が終わるまで待つ
+func (a *Async) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+	<-a.done
+}
+
+func (a *Async) run() {
+	defer close(a.done)
+	for q := range a.queue {
+		if err := a.handler.Handle(q.ctx, q.event); err != nil && a.onError != nil {
+			a.onError(q.event, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"freee-oauth-app/domain"
+)
+
+// blockingHandler は release が閉じられるまで処理を待機し、受け取ったイベントを記録する
+type blockingHandler struct {
+	release chan struct{}
+	err     error
+
+	mu     sync.Mutex
+	events []domain.EventType
+}
+
+func (h *blockingHandler) Handle(ctx context.Context, event domain.Event) error {
+	<-h.release
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, event.Type)
+	return h.err
+}
+
+func TestAsync_HandleDoesNotWaitForHook(t *testing.T) {
+	handler := &blockingHandler{release: make(chan struct{})}
+	async := NewAsync(handler, nil)
+
+	done := make(chan error, 1)
+	go func() { done <- async.Handle(context.Background(), domain.Event{Type: domain.EventTokenRefreshed}) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Handle to return without waiting for the hook")
+	}
+	close(handler.release)
+	async.Close()
+}
+
+func TestAsync_CloseWaitsForQueuedEventsInOrder(t *testing.T) {
+	handler := &blockingHandler{release: make(chan struct{}), err: errors.New("hook failed")}
+	var failed []domain.EventType
+	async := NewAsync(handler, func(event domain.Event, err error) {
+		failed = append(failed, event.Type)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	async.Handle(ctx, domain.Event{Type: domain.EventTokenRefreshed})
+	async.Handle(ctx, domain.Event{Type: domain.EventTokenDeleted})
+	// 呼び出し元がキャンセルしてもフックは実行する
+	cancel()
+	close(handler.release)
+	async.Close()
+
+	want := []domain.EventType{domain.EventTokenRefreshed, domain.EventTokenDeleted}
+	if len(handler.events) != 2 || handler.events[0] != want[0] || handler.events[1] != want[1] {
+		t.Errorf("expected events %v, got %v", want, handler.events)
+	}
+	if len(failed) != 2 {
+		t.Errorf("expected 2 failures to be reported, got %v", failed)
+	}
+	if err := async.Handle(context.Background(), domain.Event{Type: domain.EventTokenObtained}); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed after Close, got %v", err)
+	}
+}
+
+func TestAsync_DropsEventsWhenQueueIsFull(t *testing.T) {
+	handler := &blockingHandler{release: make(chan struct{})}
+	async := NewAsync(handler, nil)
+	defer async.Close()
+	defer close(handler.release)
+
+	var err error
+	for i := 0; i <= asyncQueueSize+1 && err == nil; i++ {
+		err = async.Handle(context.Background(), domain.Event{Type: domain.EventTokenRefreshed})
+	}
+	if !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"freee-oauth-app/domain"
+)
+
+// ExecHook はイベントごとにシェルコマンドを実行するフック
+//
+// Payload のJSONを標準入力に渡し、主な項目を環境変数でも渡す:
+//
+//	FREEE_EVENT                  イベントの種類（token.refreshed など）
+//	FREEE_EVENT_TIME             イベントの時刻（RFC 3339）
+//	FREEE_PROFILE                プロファイル名
+//	FREEE_TOKEN_EXPIRY           トークンの有効期限（取得・リフレッシュ時のみ）
+//	FREEE_REFRESH_TOKEN_ROTATED  リフレッシュトークンが更新されたか（true / false）
+//	FREEE_EVENT_ERROR            失敗の原因（token.refresh_failed のみ）
+type ExecHook struct {
+	command string
+	profile string
+	timeout time.Duration
+}
+
+// NewExecHook は新しいExecHookを生成する
+// コマンドは timeout を過ぎると強制終了する
+func NewExecHook(command, profile string, timeout time.Duration) *ExecHook {
+	return &ExecHook{command: command, profile: profile, timeout: timeout}
+}
+
+// Handle はイベントを渡してコマンドを実行し、終了を待つ
+func (h *ExecHook) Handle(ctx context.Context, event domain.Event) error {
+	payload := NewPayload(h.profile, event)
+	input, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, h.command)
+	cmd.Env = append(os.Environ(), payloadEnv(payload)...)
+	cmd.Stdin = bytes.NewReader(input)
+	// 標準出力は token コマンドの出力と混ざらないよう、失敗時のエラーメッセージにのみ使う
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if text := strings.TrimSpace(string(output)); text != "" {
+			return fmt.Errorf("exec hook %q: %w: %s", h.command, err, text)
+		}
+		return fmt.Errorf("exec hook %q: %w", h.command, err)
+	}
+	return nil
+}
+
+func payloadEnv(payload Payload) []string {
+	env := []string{
+		"FREEE_EVENT=" + string(payload.Type),
+		"FREEE_EVENT_TIME=" + payload.Time.Format(time.RFC3339),
+		"FREEE_PROFILE=" + payload.Profile,
+		"FREEE_REFRESH_TOKEN_ROTATED=" + strconv.FormatBool(payload.RefreshTokenRotated),
+	}
+	if payload.Expiry != nil {
+		env = append(env, "FREEE_TOKEN_EXPIRY="+payload.Expiry.Format(time.RFC3339))
+	}
+	if payload.Error != "" {
+		env = append(env, "FREEE_EVENT_ERROR="+payload.Error)
+	}
+	return env
+}
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
@@ -0,0 +1,80 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"freee-oauth-app/domain"
+)
+
+func TestExecHook_PassesEventToCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "env")
+	stdinFile := filepath.Join(dir, "stdin")
+	command := `echo "$FREEE_EVENT $FREEE_PROFILE $FREEE_REFRESH_TOKEN_ROTATED $FREEE_TOKEN_EXPIRY" > ` + envFile + ` && cat > ` + stdinFile
+
+	expiry := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	event := domain.Event{
+		Type:                domain.EventTokenRefreshed,
+		Time:                expiry.Add(-time.Hour),
+		Token:               domain.NewToken("secret_access", "secret_refresh", expiry),
+		RefreshTokenRotated: true,
+	}
+	if err := NewExecHook(command, "sandbox", 5*time.Second).Handle(context.Background(), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	env, _ := os.ReadFile(envFile)
+	if got := strings.TrimSpace(string(env)); got != "token.refreshed sandbox true 2025-01-01T12:00:00Z" {
+		t.Errorf("unexpected environment: %q", got)
+	}
+	stdin, _ := os.ReadFile(stdinFile)
+	var payload Payload
+	if err := json.Unmarshal(stdin, &payload); err != nil {
+		t.Fatalf("expected JSON payload on stdin: %v", err)
+	}
+	if payload.Type != domain.EventTokenRefreshed || payload.Profile != "sandbox" || !payload.Expiry.Equal(expiry) {
+		t.Errorf("unexpected payload: %+v", payload)
+	}
+	if strings.Contains(string(stdin), "secret_") {
+		t.Error("tokens must not be passed to hooks")
+	}
+}
+
+func TestExecHook_ReportsFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	event := domain.Event{Type: domain.EventRefreshFailed, Err: errors.New("boom")}
+
+	err := NewExecHook(`echo "failed: $FREEE_EVENT_ERROR" >&2; exit 3`, "", 5*time.Second).Handle(context.Background(), event)
+
+	if err == nil || !strings.Contains(err.Error(), "failed: boom") {
+		t.Errorf("expected error with command output, got %v", err)
+	}
+}
+
+func TestExecHook_Timeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	start := time.Now()
+	err := NewExecHook("exec sleep 10", "", 100*time.Millisecond).Handle(context.Background(), domain.Event{Type: domain.EventTokenDeleted})
+
+	if err == nil {
+		t.Error("expected error when the command times out")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("expected the command to be killed after the timeout")
+	}
+}
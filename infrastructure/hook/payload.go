@@ -0,0 +1,41 @@
+// Package hook はトークンのライフサイクルイベントを外部に通知するアダプターを提供する
+//
+// ExecHook はコマンドを実行し、Webhook はHTTPでPOSTする。いずれもイベントを
+// Payload のJSONとして渡す。アクセストークン・リフレッシュトークンは含めないため、
+// 新しいトークンが必要な場合は token コマンドやトークンブローカーから取得する。
+package hook
+
+import (
+	"time"
+
+	"freee-oauth-app/domain"
+)
+
+// Payload はフックに渡すイベントのJSON表現
+type Payload struct {
+	Type    domain.EventType `json:"type"`
+	Time    time.Time        `json:"time"`
+	Profile string           `json:"profile,omitempty"`
+	// Expiry は取得・リフレッシュしたトークンの有効期限
+	Expiry              *time.Time `json:"expiry,omitempty"`
+	RefreshTokenRotated bool       `json:"refresh_token_rotated,omitempty"`
+	Error               string     `json:"error,omitempty"`
+}
+
+// NewPayload はイベントからPayloadを生成する
+func NewPayload(profile string, event domain.Event) Payload {
+	payload := Payload{
+		Type:                event.Type,
+		Time:                event.Time,
+		Profile:             profile,
+		RefreshTokenRotated: event.RefreshTokenRotated,
+	}
+	if event.Token != nil {
+		expiry := event.Token.Expiry
+		payload.Expiry = &expiry
+	}
+	if event.Err != nil {
+		payload.Error = event.Err.Error()
+	}
+	return payload
+}
@@ -0,0 +1,62 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"freee-oauth-app/domain"
+)
+
+// Webhook はイベントを Payload のJSONとしてURLにPOSTするフック
+// URLにシークレットを含むサービスがあるため、エラーメッセージにはURLを含めない
+type Webhook struct {
+	url     string
+	profile string
+	client  *http.Client
+}
+
+// NewWebhook は新しいWebhookを生成する
+// client が nil の場合は http.DefaultClient を使用する
+func NewWebhook(endpoint, profile string, client *http.Client) *Webhook {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Webhook{url: endpoint, profile: profile, client: client}
+}
+
+// Handle はイベントをPOSTし、2xx以外のレスポンスをエラーとして返す
+func (h *Webhook) Handle(ctx context.Context, event domain.Event) error {
+	body, err := json.Marshal(NewPayload(h.profile, event))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		// *url.Error はURLを含むため、原因のみを返す
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: %s", resp.Status)
+	}
+	return nil
+}
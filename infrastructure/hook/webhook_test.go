@@ -0,0 +1,72 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"freee-oauth-app/domain"
+)
+
+func TestWebhook_PostsPayload(t *testing.T) {
+	var received Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected POST, got %s", r.Method)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("expected JSON content type, got %s", ct)
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	event := domain.Event{
+		Type:  domain.EventTokenObtained,
+		Time:  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Token: domain.NewToken("access", "refresh", time.Date(2025, 1, 1, 6, 0, 0, 0, time.UTC)),
+	}
+	if err := NewWebhook(server.URL, "production", nil).Handle(context.Background(), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if received.Type != domain.EventTokenObtained || received.Profile != "production" || received.Expiry == nil {
+		t.Errorf("unexpected payload: %+v", received)
+	}
+}
+
+func TestWebhook_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	err := NewWebhook(server.URL+"/secret-path", "", nil).Handle(context.Background(), domain.Event{Type: domain.EventTokenDeleted})
+
+	if err == nil {
+		t.Fatal("expected error for 500 response")
+	}
+	if strings.Contains(err.Error(), "secret-path") {
+		t.Errorf("webhook URL must not appear in errors: %v", err)
+	}
+}
+
+func TestWebhook_ConnectionError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	endpoint := server.URL + "/secret-path"
+	server.Close()
+
+	err := NewWebhook(endpoint, "", nil).Handle(context.Background(), domain.Event{Type: domain.EventTokenDeleted})
+
+	if err == nil {
+		t.Fatal("expected error when the server is unreachable")
+	}
+	if strings.Contains(err.Error(), "secret-path") {
+		t.Errorf("webhook URL must not appear in errors: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package persistence
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// backupPath はトークンファイルの1世代前のバックアップのパスを返す
+func backupPath(path string) string {
+	return path + ".bak"
+}
+
+// writeFileAtomic は同じディレクトリの一時ファイルに書き込んでfsyncした後、
+// renameで置き換えることで、書き込み途中のクラッシュやディスクフルでも
+// 壊れたファイルが残らないようにする
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // rename後は存在しないため何もしない
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	syncDir(dir)
+	return nil
+}
+
+// syncDir はrenameをディスクに反映するためディレクトリをfsyncする
+// ディレクトリのfsyncをサポートしない環境もあるためエラーは無視する
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// saveWithBackup は現在のファイルをバックアップしてから新しい内容をアトミックに書き込む
+// 現在のファイルが壊れている場合は、既存の正常なバックアップを上書きしない
+func saveWithBackup(path string, data []byte) error {
+	if current, err := os.ReadFile(path); err == nil && json.Valid(current) {
+		if err := writeFileAtomic(backupPath(path), current); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(path, data)
+}
+
+// loadWithBackup はファイルを読み込んでデコードし、失敗した場合はバックアップから読み込む
+// ファイルが存在しない場合はバックアップを使わずにエラーを返す
+func loadWithBackup[T any](path string, decode func([]byte) (T, error)) (T, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	result, err := decode(data)
+	if err == nil {
+		return result, nil
+	}
+
+	backup, backupErr := os.ReadFile(backupPath(path))
+	if backupErr != nil {
+		return result, err
+	}
+	if backupResult, backupErr := decode(backup); backupErr == nil {
+		return backupResult, nil
+	}
+	return result, err
+}
+
+// removeWithBackup はファイルとバックアップを削除する
+// ファイルが存在しない場合は何もしない
+func removeWithBackup(path string) error {
+	for _, p := range []string{path, backupPath(path)} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,426 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"freee-oauth-app/domain"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// 暗号化ファイルのエンベロープ形式のバージョン
+	envelopeVersion = 1
+	// AES-256の鍵長
+	encryptionKeyLength = 32
+	// scryptのソルト長
+	scryptSaltLength = 16
+
+	kdfScrypt  = "scrypt"
+	kdfKeyFile = "keyfile"
+)
+
+// scryptのデフォルトパラメータ
+var defaultScryptParams = scryptParams{N: 1 << 15, R: 8, P: 1}
+
+// scryptKey はパスフレーズから鍵を導出する（テストで導出の回数を数えるために差し替える）
+var scryptKey = scrypt.Key
+
+var (
+	ErrDecryptFailed         = errors.New("failed to decrypt token file (wrong key or corrupted file)")
+	ErrUnsupportedEnvelope   = errors.New("unsupported token file envelope version")
+	ErrInvalidKeyFile        = errors.New("key file must contain 32 bytes (raw, hex or base64)")
+	ErrEmptyPassphrase       = errors.New("passphrase must not be empty")
+	ErrNoEncryptionKey       = errors.New("no encryption key configured")
+	ErrUnknownKeyDerivation  = errors.New("unknown key derivation function")
+	errUnrecognizedTokenFile = errors.New("unrecognized token file format")
+)
+
+// TokenKey はトークンファイルの暗号鍵の導出元を表す
+// パスフレーズ（scryptで鍵導出）または鍵ファイルのいずれか
+type TokenKey struct {
+	passphrase []byte
+	keyFileKey []byte
+	// derived はパスフレーズから導出した鍵のキャッシュ（TokenKeyのコピー間で共有する）
+	derived *derivedKeyCache
+}
+
+// derivedKeyCache はscryptで直近に導出した鍵をソルトとパラメータとともに保持する
+// scryptは意図的に遅いため、同じトークンファイルを読み込むたびに導出し直さない。
+// 保存のたびにソルトが変わるため、保持するのは直近の1つだけでよい。
+type derivedKeyCache struct {
+	mu     sync.Mutex
+	salt   []byte
+	params scryptParams
+	key    []byte
+}
+
+// get はソルトとパラメータが一致する導出済みの鍵を返し、なければ導出して保持する
+func (c *derivedKeyCache) get(passphrase, salt []byte, params scryptParams) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.key != nil && c.params == params && bytes.Equal(c.salt, salt) {
+		return c.key, nil
+	}
+	key, err := scryptKey(passphrase, salt, params.N, params.R, params.P, encryptionKeyLength)
+	if err != nil {
+		return nil, err
+	}
+	c.salt = append([]byte(nil), salt...)
+	c.params = params
+	c.key = key
+	return key, nil
+}
+
+// NewPassphraseKey はパスフレーズからscryptで鍵を導出するTokenKeyを生成する
+func NewPassphraseKey(passphrase string) (TokenKey, error) {
+	if passphrase == "" {
+		return TokenKey{}, ErrEmptyPassphrase
+	}
+	return TokenKey{passphrase: []byte(passphrase), derived: &derivedKeyCache{}}, nil
+}
+
+// NewKeyFileKey は鍵ファイルから32バイトの鍵を読み込むTokenKeyを生成する
+// 鍵ファイルは生の32バイト、hex、base64のいずれかの形式を受け付ける
+func NewKeyFileKey(path string) (TokenKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return TokenKey{}, err
+	}
+	key, err := parseKeyFile(data)
+	if err != nil {
+		return TokenKey{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return TokenKey{keyFileKey: key}, nil
+}
+
+func parseKeyFile(data []byte) ([]byte, error) {
+	if len(data) == encryptionKeyLength {
+		return data, nil
+	}
+	text := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == encryptionKeyLength {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == encryptionKeyLength {
+		return key, nil
+	}
+	return nil, ErrInvalidKeyFile
+}
+
+func (k TokenKey) kdf() string {
+	if k.keyFileKey != nil {
+		return kdfKeyFile
+	}
+	return kdfScrypt
+}
+
+func (k TokenKey) isZero() bool {
+	return k.passphrase == nil && k.keyFileKey == nil
+}
+
+// deriveKey はエンベロープの情報から暗号鍵を導出する
+func (k TokenKey) deriveKey(env *tokenEnvelope) ([]byte, error) {
+	switch env.KDF {
+	case kdfKeyFile:
+		if k.keyFileKey == nil {
+			return nil, ErrDecryptFailed
+		}
+		return k.keyFileKey, nil
+	case kdfScrypt:
+		if k.passphrase == nil || env.Scrypt == nil {
+			return nil, ErrDecryptFailed
+		}
+		if k.derived == nil {
+			return scryptKey(k.passphrase, env.Salt, env.Scrypt.N, env.Scrypt.R, env.Scrypt.P, encryptionKeyLength)
+		}
+		return k.derived.get(k.passphrase, env.Salt, *env.Scrypt)
+	default:
+		return nil, ErrUnknownKeyDerivation
+	}
+}
+
+type scryptParams struct {
+	N int `json:"n"`
+	R int `json:"r"`
+	P int `json:"p"`
+}
+
+// tokenEnvelope は暗号化されたトークンファイルのディスク上の形式
+type tokenEnvelope struct {
+	Version    int           `json:"version"`
+	KDF        string        `json:"kdf"`
+	Salt       []byte        `json:"salt,omitempty"`
+	Scrypt     *scryptParams `json:"scrypt,omitempty"`
+	Nonce      []byte        `json:"nonce"`
+	Ciphertext []byte        `json:"ciphertext"`
+}
+
+// additionalData はエンベロープのヘッダをAES-GCMの認証対象に含める
+func (e *tokenEnvelope) additionalData() []byte {
+	return []byte(fmt.Sprintf("freee-oauth-app/token/v%d/%s", e.Version, e.KDF))
+}
+
+// EncryptedFileTokenRepository はAES-GCMで暗号化したファイルにトークンを保存するリポジトリ
+//
+// 読み込み時は現在の鍵に加えて以前の鍵でも復号を試み、以前の鍵で復号できた場合は
+// 現在の鍵で再暗号化して保存し直す（鍵のローテーション）。
+// 暗号化されていない従来のトークンファイルも読み込み、暗号化して保存し直す。
+type EncryptedFileTokenRepository struct {
+	filePath     string
+	key          TokenKey
+	previousKeys []TokenKey
+}
+
+// NewEncryptedFileTokenRepository は新しいEncryptedFileTokenRepositoryを生成する
+// previousKeys にはローテーション前の鍵を指定する
+func NewEncryptedFileTokenRepository(filePath string, key TokenKey, previousKeys ...TokenKey) *EncryptedFileTokenRepository {
+	return &EncryptedFileTokenRepository{
+		filePath:     filePath,
+		key:          key,
+		previousKeys: previousKeys,
+	}
+}
+
+// Save はトークンを暗号化してファイルにアトミックに保存する
+// 保存前のトークンファイルは "<file>.bak" にバックアップする。
+// 暗号化されていない従来のトークンファイルは平文のリフレッシュトークンを残さないよう、
+// バックアップせずに置き換え、以前のバックアップも削除する。
+func (r *EncryptedFileTokenRepository) Save(ctx context.Context, token *domain.Token) error {
+	data, err := r.encrypt(token)
+	if err != nil {
+		return err
+	}
+	if current, err := os.ReadFile(r.filePath); err == nil && !isEnvelope(current) {
+		return r.replace(data)
+	}
+	return saveWithBackup(r.filePath, data)
+}
+
+// migrate は以前の形式・鍵で保存されていたトークンを現在の鍵で保存し直す
+//
+// 他のプロセスのリフレッシュが保存したトークンを古いトークンで上書きしないよう、
+// トークンファイルのロックを取得してから読み込み直し、まだ以前の形式・鍵のままであれば保存する。
+// ロックを取得できない場合（リフレッシュ中など）は保存し直さず、次の読み込みで再び試みる。
+func (r *EncryptedFileTokenRepository) migrate() error {
+	unlock, locked, err := tryLockFile(r.filePath)
+	if err != nil || !locked {
+		return err
+	}
+	defer unlock()
+
+	decoded, err := loadWithBackup(r.filePath, r.decode)
+	if err != nil || !decoded.resave {
+		return err
+	}
+	return r.resave(decoded.token)
+}
+
+// resave はトークンを現在の鍵で保存し直す
+func (r *EncryptedFileTokenRepository) resave(token *domain.Token) error {
+	data, err := r.encrypt(token)
+	if err != nil {
+		return err
+	}
+	return r.replace(data)
+}
+
+// replace はトークンファイルをバックアップせずに置き換える
+// 以前の形式・鍵のバックアップを残さないよう、バックアップも削除する
+func (r *EncryptedFileTokenRepository) replace(data []byte) error {
+	if err := writeFileAtomic(r.filePath, data); err != nil {
+		return err
+	}
+	if err := os.Remove(backupPath(r.filePath)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (r *EncryptedFileTokenRepository) encrypt(token *domain.Token) ([]byte, error) {
+	if r.key.isZero() {
+		return nil, ErrNoEncryptionKey
+	}
+
+	plaintext, err := marshalToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := r.seal(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(env, "", "  ")
+}
+
+func (r *EncryptedFileTokenRepository) seal(plaintext []byte) (*tokenEnvelope, error) {
+	env := &tokenEnvelope{
+		Version: envelopeVersion,
+		KDF:     r.key.kdf(),
+	}
+	if env.KDF == kdfScrypt {
+		env.Salt = make([]byte, scryptSaltLength)
+		if _, err := rand.Read(env.Salt); err != nil {
+			return nil, err
+		}
+		params := defaultScryptParams
+		env.Scrypt = &params
+	}
+
+	key, err := r.key.deriveKey(env)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	env.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return nil, err
+	}
+	env.Ciphertext = aead.Seal(nil, env.Nonce, plaintext, env.additionalData())
+	return env, nil
+}
+
+// decodedToken は復号したトークンと、現在の鍵で保存し直す必要があるかを表す
+type decodedToken struct {
+	token  *domain.Token
+	resave bool
+}
+
+// Load はファイルからトークンを読み込んで復号する
+// ファイルが壊れている場合はバックアップから読み込む
+func (r *EncryptedFileTokenRepository) Load(ctx context.Context) (*domain.Token, error) {
+	decoded, err := loadWithBackup(r.filePath, r.decode)
+	if err != nil {
+		return nil, err
+	}
+
+	if decoded.resave {
+		if err := r.migrate(); err != nil {
+			return nil, err
+		}
+	}
+	return decoded.token, nil
+}
+
+// isEnvelope はファイルの内容が暗号化されたトークンファイルかを判定する
+func isEnvelope(data []byte) bool {
+	var env tokenEnvelope
+	return json.Unmarshal(data, &env) == nil && env.Version != 0
+}
+
+func (r *EncryptedFileTokenRepository) decode(data []byte) (decodedToken, error) {
+	var env tokenEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return decodedToken{}, err
+	}
+
+	if env.Version == 0 {
+		// 暗号化導入前の平文トークンファイル
+		token, err := decodePlaintextToken(data)
+		if err != nil {
+			return decodedToken{}, err
+		}
+		return decodedToken{token: token, resave: true}, nil
+	}
+	if env.Version != envelopeVersion {
+		return decodedToken{}, fmt.Errorf("%w: %d", ErrUnsupportedEnvelope, env.Version)
+	}
+
+	keys := append([]TokenKey{r.key}, r.previousKeys...)
+	for i, key := range keys {
+		plaintext, err := openEnvelope(key, &env)
+		if err != nil {
+			if errors.Is(err, ErrUnknownKeyDerivation) {
+				return decodedToken{}, err
+			}
+			continue
+		}
+
+		token, err := unmarshalToken(plaintext)
+		if err != nil {
+			return decodedToken{}, err
+		}
+		// 以前の鍵で復号できた場合は現在の鍵で再暗号化する
+		return decodedToken{token: token, resave: i > 0}, nil
+	}
+
+	return decodedToken{}, ErrDecryptFailed
+}
+
+func openEnvelope(key TokenKey, env *tokenEnvelope) ([]byte, error) {
+	if key.isZero() {
+		return nil, ErrDecryptFailed
+	}
+	derived, err := key.deriveKey(env)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(derived)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Nonce) != aead.NonceSize() {
+		return nil, ErrDecryptFailed
+	}
+	plaintext, err := aead.Open(nil, env.Nonce, env.Ciphertext, env.additionalData())
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func decodePlaintextToken(data []byte) (*domain.Token, error) {
+	token, err := unmarshalToken(data)
+	if err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, errUnrecognizedTokenFile
+	}
+	return token, nil
+}
+
+// Lock はトークンファイルのアドバイザリロックを取得する
+// 複数プロセスが同時にリフレッシュしてリフレッシュトークンを失うことを防ぐ
+func (r *EncryptedFileTokenRepository) Lock(ctx context.Context) (func(), error) {
+	return lockFile(ctx, r.filePath)
+}
+
+// Exists はトークンファイルが存在するかを確認する
+func (r *EncryptedFileTokenRepository) Exists(ctx context.Context) bool {
+	_, err := os.Stat(r.filePath)
+	return err == nil
+}
+
+// Delete はトークンファイルとバックアップを削除する
+// ファイルが存在しない場合は何もしない
+func (r *EncryptedFileTokenRepository) Delete(ctx context.Context) error {
+	return removeWithBackup(r.filePath)
+}
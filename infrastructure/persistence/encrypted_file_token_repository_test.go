@@ -0,0 +1,311 @@
+package persistence
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"freee-oauth-app/domain"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+func mustPassphraseKey(t *testing.T, passphrase string) TokenKey {
+	t.Helper()
+	key, err := NewPassphraseKey(passphrase)
+	if err != nil {
+		t.Fatalf("failed to create passphrase key: %v", err)
+	}
+	return key
+}
+
+func writeKeyFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	raw := make([]byte, 32)
+	rand.Read(raw)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(raw)+"\n"), 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+	return path
+}
+
+func TestEncryptedFileTokenRepository_Save_And_Load_WithPassphrase(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token.json")
+	repo := NewEncryptedFileTokenRepository(filePath, mustPassphraseKey(t, "correct horse"))
+
+	ctx := context.Background()
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := repo.Save(ctx, domain.NewToken("access123", "refresh456", expiry)); err != nil {
+		t.Fatalf("failed to save token: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if strings.Contains(string(data), "access123") || strings.Contains(string(data), "refresh456") {
+		t.Error("token file must not contain plaintext tokens")
+	}
+
+	loaded, err := repo.Load(ctx)
+	if err != nil {
+		t.Fatalf("failed to load token: %v", err)
+	}
+	if loaded.AccessToken != "access123" {
+		t.Errorf("expected access123, got %s", loaded.AccessToken)
+	}
+	if loaded.RefreshToken != "refresh456" {
+		t.Errorf("expected refresh456, got %s", loaded.RefreshToken)
+	}
+	if !loaded.Expiry.Equal(expiry) {
+		t.Errorf("expected expiry %v, got %v", expiry, loaded.Expiry)
+	}
+}
+
+func TestEncryptedFileTokenRepository_Save_And_Load_WithKeyFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	key, err := NewKeyFileKey(writeKeyFile(t, tmpDir, "token.key"))
+	if err != nil {
+		t.Fatalf("failed to load key file: %v", err)
+	}
+	repo := NewEncryptedFileTokenRepository(filepath.Join(tmpDir, "token.json"), key)
+
+	ctx := context.Background()
+	if err := repo.Save(ctx, domain.NewToken("access", "refresh", time.Now().Add(time.Hour))); err != nil {
+		t.Fatalf("failed to save token: %v", err)
+	}
+
+	loaded, err := repo.Load(ctx)
+	if err != nil {
+		t.Fatalf("failed to load token: %v", err)
+	}
+	if loaded.AccessToken != "access" {
+		t.Errorf("expected access, got %s", loaded.AccessToken)
+	}
+}
+
+func TestEncryptedFileTokenRepository_Load_WithWrongPassphrase(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token.json")
+	ctx := context.Background()
+
+	repo := NewEncryptedFileTokenRepository(filePath, mustPassphraseKey(t, "right"))
+	repo.Save(ctx, domain.NewToken("access", "refresh", time.Now().Add(time.Hour)))
+
+	wrongRepo := NewEncryptedFileTokenRepository(filePath, mustPassphraseKey(t, "wrong"))
+	_, err := wrongRepo.Load(ctx)
+
+	if !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("expected ErrDecryptFailed, got %v", err)
+	}
+}
+
+func TestEncryptedFileTokenRepository_Load_RotatesPreviousKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "token.json")
+	ctx := context.Background()
+
+	oldKey := mustPassphraseKey(t, "old passphrase")
+	NewEncryptedFileTokenRepository(filePath, oldKey).Save(ctx, domain.NewToken("access", "refresh", time.Now().Add(time.Hour)))
+
+	newKey, err := NewKeyFileKey(writeKeyFile(t, tmpDir, "new.key"))
+	if err != nil {
+		t.Fatalf("failed to load key file: %v", err)
+	}
+	repo := NewEncryptedFileTokenRepository(filePath, newKey, oldKey)
+
+	loaded, err := repo.Load(ctx)
+	if err != nil {
+		t.Fatalf("failed to load token with previous key: %v", err)
+	}
+	if loaded.AccessToken != "access" {
+		t.Errorf("expected access, got %s", loaded.AccessToken)
+	}
+
+	// 再暗号化後は新しい鍵だけで読み込める
+	if _, err := NewEncryptedFileTokenRepository(filePath, newKey).Load(ctx); err != nil {
+		t.Errorf("expected token to be re-encrypted with new key: %v", err)
+	}
+	if _, err := NewEncryptedFileTokenRepository(filePath, oldKey).Load(ctx); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("expected old key to no longer decrypt, got %v", err)
+	}
+}
+
+func TestEncryptedFileTokenRepository_Load_MigratesPlaintextFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token.json")
+	ctx := context.Background()
+
+	NewFileTokenRepository(filePath).Save(ctx, domain.NewToken("access123", "refresh456", time.Now().Add(time.Hour)))
+
+	repo := NewEncryptedFileTokenRepository(filePath, mustPassphraseKey(t, "passphrase"))
+	loaded, err := repo.Load(ctx)
+	if err != nil {
+		t.Fatalf("failed to load plaintext token: %v", err)
+	}
+	if loaded.AccessToken != "access123" {
+		t.Errorf("expected access123, got %s", loaded.AccessToken)
+	}
+
+	data, _ := os.ReadFile(filePath)
+	if strings.Contains(string(data), "access123") {
+		t.Error("expected plaintext token file to be encrypted after load")
+	}
+}
+
+func TestEncryptedFileTokenRepository_FilePermissions(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token.json")
+	repo := NewEncryptedFileTokenRepository(filePath, mustPassphraseKey(t, "passphrase"))
+
+	repo.Save(context.Background(), domain.NewToken("access", "refresh", time.Now().Add(time.Hour)))
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to stat file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("expected file permission 0600, got %o", perm)
+	}
+}
+
+func TestNewKeyFileKey_InvalidLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "short.key")
+	os.WriteFile(path, []byte("too short"), 0600)
+
+	_, err := NewKeyFileKey(path)
+
+	if !errors.Is(err, ErrInvalidKeyFile) {
+		t.Errorf("expected ErrInvalidKeyFile, got %v", err)
+	}
+}
+
+func TestNewPassphraseKey_Empty(t *testing.T) {
+	if _, err := NewPassphraseKey(""); !errors.Is(err, ErrEmptyPassphrase) {
+		t.Errorf("expected ErrEmptyPassphrase, got %v", err)
+	}
+}
+
+func TestEncryptedFileTokenRepository_Load_FallsBackToBackup(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token.json")
+	repo := NewEncryptedFileTokenRepository(filePath, mustPassphraseKey(t, "passphrase"))
+
+	ctx := context.Background()
+	repo.Save(ctx, domain.NewToken("first", "refresh", time.Now().Add(time.Hour)))
+	repo.Save(ctx, domain.NewToken("second", "refresh", time.Now().Add(time.Hour)))
+	os.WriteFile(filePath, []byte(`{"version": 1, "kdf": "scr`), 0600)
+
+	loaded, err := repo.Load(ctx)
+	if err != nil {
+		t.Fatalf("expected fallback to backup, got error: %v", err)
+	}
+	if loaded.AccessToken != "first" {
+		t.Errorf("expected first, got %s", loaded.AccessToken)
+	}
+}
+
+func TestEncryptedFileTokenRepository_Load_MigrationDropsPlaintextBackup(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token.json")
+	ctx := context.Background()
+
+	plain := NewFileTokenRepository(filePath)
+	plain.Save(ctx, domain.NewToken("old-access", "refresh", time.Now().Add(time.Hour)))
+	plain.Save(ctx, domain.NewToken("access123", "refresh", time.Now().Add(time.Hour)))
+
+	if _, err := NewEncryptedFileTokenRepository(filePath, mustPassphraseKey(t, "passphrase")).Load(ctx); err != nil {
+		t.Fatalf("failed to load plaintext token: %v", err)
+	}
+	if _, err := os.Stat(backupPath(filePath)); !os.IsNotExist(err) {
+		t.Error("expected plaintext backup to be removed after migration")
+	}
+}
+
+func TestEncryptedFileTokenRepository_Save_DoesNotBackUpPlaintextFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token.json")
+	ctx := context.Background()
+
+	plain := NewFileTokenRepository(filePath)
+	plain.Save(ctx, domain.NewToken("old-access", "old-refresh", time.Now().Add(time.Hour)))
+	plain.Save(ctx, domain.NewToken("access123", "refresh456", time.Now().Add(time.Hour)))
+
+	// 読み込みによる移行を経ずに、暗号化して保存する
+	repo := NewEncryptedFileTokenRepository(filePath, mustPassphraseKey(t, "passphrase"))
+	if err := repo.Save(ctx, domain.NewToken("new-access", "new-refresh", time.Now().Add(time.Hour))); err != nil {
+		t.Fatalf("failed to save token: %v", err)
+	}
+
+	if _, err := os.Stat(backupPath(filePath)); !os.IsNotExist(err) {
+		t.Error("expected no plaintext backup to remain after the first encrypted save")
+	}
+	data, _ := os.ReadFile(filePath)
+	if strings.Contains(string(data), "refresh") {
+		t.Error("expected the token file to be encrypted")
+	}
+
+	// 暗号化されたファイルは引き続きバックアップする
+	if err := repo.Save(ctx, domain.NewToken("newer-access", "newer-refresh", time.Now().Add(time.Hour))); err != nil {
+		t.Fatalf("failed to save token: %v", err)
+	}
+	backup, err := os.ReadFile(backupPath(filePath))
+	if err != nil {
+		t.Fatalf("expected encrypted backup: %v", err)
+	}
+	if !isEnvelope(backup) {
+		t.Error("expected backup to be encrypted")
+	}
+}
+
+func TestEncryptedFileTokenRepository_Load_ReusesDerivedKey(t *testing.T) {
+	derivations := 0
+	scryptKey = func(password, salt []byte, N, r, p, keyLen int) ([]byte, error) {
+		derivations++
+		return scrypt.Key(password, salt, N, r, p, keyLen)
+	}
+	t.Cleanup(func() { scryptKey = scrypt.Key })
+
+	filePath := filepath.Join(t.TempDir(), "token.json")
+	repo := NewEncryptedFileTokenRepository(filePath, mustPassphraseKey(t, "passphrase"))
+	ctx := context.Background()
+	repo.Save(ctx, domain.NewToken("access123", "refresh456", time.Now().Add(time.Hour)))
+
+	for i := 0; i < 3; i++ {
+		if _, err := repo.Load(ctx); err != nil {
+			t.Fatalf("failed to load token: %v", err)
+		}
+	}
+
+	if derivations != 1 {
+		t.Errorf("expected the key to be derived once per salt, got %d derivations", derivations)
+	}
+}
+
+func TestEncryptedFileTokenRepository_Load_MigratesOnlyUnderLock(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token.json")
+	ctx := context.Background()
+	NewFileTokenRepository(filePath).Save(ctx, domain.NewToken("access123", "refresh456", time.Now().Add(time.Hour)))
+	repo := NewEncryptedFileTokenRepository(filePath, mustPassphraseKey(t, "passphrase"))
+
+	// 他のプロセスがリフレッシュ中でロックを保持している間は書き換えない
+	unlock, err := lockFile(ctx, filePath)
+	if err != nil {
+		t.Fatalf("failed to lock token file: %v", err)
+	}
+	if _, err := repo.Load(ctx); err != nil {
+		t.Fatalf("failed to load plaintext token: %v", err)
+	}
+	if data, _ := os.ReadFile(filePath); !strings.Contains(string(data), "access123") {
+		t.Error("expected the token file not to be rewritten while locked")
+	}
+	unlock()
+
+	if _, err := repo.Load(ctx); err != nil {
+		t.Fatalf("failed to load plaintext token: %v", err)
+	}
+	if data, _ := os.ReadFile(filePath); strings.Contains(string(data), "access123") {
+		t.Error("expected the token file to be encrypted once the lock is free")
+	}
+}
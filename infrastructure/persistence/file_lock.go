@@ -0,0 +1,48 @@
+package persistence
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// ロック取得を再試行する間隔
+const lockRetryInterval = 50 * time.Millisecond
+
+// lockFile はトークンファイルに対応する "<path>.lock" に排他的なアドバイザリロックを取得する
+// ロックを取得できるまで再試行し、contextがキャンセルされた場合はエラーを返す
+func lockFile(ctx context.Context, path string) (func(), error) {
+	for {
+		unlock, locked, err := tryLockFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			return unlock, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// tryLockFile は "<path>.lock" のロックを再試行せずに取得する
+// 他のプロセス（または同じプロセスの別の呼び出し）がロックしている場合は locked にfalseを返す
+func tryLockFile(path string) (release func(), locked bool, err error) {
+	f, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, false, err
+	}
+	locked, err = tryLock(f)
+	if err != nil || !locked {
+		f.Close()
+		return nil, false, err
+	}
+	return func() {
+		unlock(f)
+		f.Close()
+	}, true, nil
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package persistence
+
+import "os"
+
+// tryLock はflockが使えない環境ではロックを行わない
+// プロセス内の排他制御はユースケース側で行われる
+func tryLock(f *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlock(f *os.File) {}
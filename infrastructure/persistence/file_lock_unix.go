@@ -0,0 +1,25 @@
+//go:build unix
+
+package persistence
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// tryLock はflockで非ブロッキングに排他ロックの取得を試みる
+func tryLock(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func unlock(f *os.File) {
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
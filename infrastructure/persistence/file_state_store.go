@@ -0,0 +1,128 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"freee-oauth-app/domain"
+)
+
+// FileStateStore はJSONファイルに認可リクエストを保持するStateStore
+//
+// 複数のプロセス（ブローカーとCLIなど）で認可リクエストを共有できる。
+// 読み込みから書き込みまでをファイルロックで排他制御するため、
+// 同じstateを2つのプロセスが同時に取り出すことはない。
+type FileStateStore struct {
+	filePath string
+	ttl      time.Duration
+	now      func() time.Time
+}
+
+// storedAuthorization は認可リクエストのディスク上の形式
+type storedAuthorization struct {
+	CodeVerifier string    `json:"code_verifier"`
+	RedirectURL  string    `json:"redirect_url,omitempty"`
+	Profile      string    `json:"profile,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// NewFileStateStore は新しいFileStateStoreを生成する
+// 作成から ttl を過ぎた認可リクエストは取り出せない
+func NewFileStateStore(filePath string, ttl time.Duration, opts ...StateStoreOption) *FileStateStore {
+	o := newStateStoreOptions(opts)
+	return &FileStateStore{
+		filePath: filePath,
+		ttl:      ttl,
+		now:      o.clock.Now,
+	}
+}
+
+// Save は認可リクエストを保存する。期限切れの認可リクエストはこの時に削除する
+func (s *FileStateStore) Save(ctx context.Context, auth *domain.PendingAuthorization) error {
+	return s.update(ctx, func(pending map[string]*domain.PendingAuthorization) error {
+		pruneExpired(pending, s.now(), s.ttl)
+		copied := *auth
+		pending[auth.State] = &copied
+		return nil
+	})
+}
+
+// Consume は認可リクエストを取り出して削除する
+func (s *FileStateStore) Consume(ctx context.Context, state string) (*domain.PendingAuthorization, error) {
+	var auth *domain.PendingAuthorization
+	var consumeErr error
+	err := s.update(ctx, func(pending map[string]*domain.PendingAuthorization) error {
+		auth, consumeErr = consume(pending, state, s.now(), s.ttl)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return auth, consumeErr
+}
+
+// update はロックを取得してファイルを読み込み、fn で変更した内容を書き戻す
+func (s *FileStateStore) update(ctx context.Context, fn func(map[string]*domain.PendingAuthorization) error) error {
+	unlock, err := lockFile(ctx, s.filePath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	pending, err := s.load()
+	if err != nil {
+		return err
+	}
+	if err := fn(pending); err != nil {
+		return err
+	}
+	return s.save(pending)
+}
+
+func (s *FileStateStore) load() (map[string]*domain.PendingAuthorization, error) {
+	pending := map[string]*domain.PendingAuthorization{}
+
+	data, err := os.ReadFile(s.filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return pending, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored map[string]storedAuthorization
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	for state, a := range stored {
+		pending[state] = &domain.PendingAuthorization{
+			State:        state,
+			CodeVerifier: a.CodeVerifier,
+			RedirectURL:  a.RedirectURL,
+			Profile:      a.Profile,
+			CreatedAt:    a.CreatedAt,
+		}
+	}
+	return pending, nil
+}
+
+func (s *FileStateStore) save(pending map[string]*domain.PendingAuthorization) error {
+	stored := make(map[string]storedAuthorization, len(pending))
+	for state, a := range pending {
+		stored[state] = storedAuthorization{
+			CodeVerifier: a.CodeVerifier,
+			RedirectURL:  a.RedirectURL,
+			Profile:      a.Profile,
+			CreatedAt:    a.CreatedAt,
+		}
+	}
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.filePath, data)
+}
@@ -5,8 +5,6 @@ import (
 	"os"
 
 	"freee-oauth-app/domain"
-
-	"github.com/u-masato/freee-api-go/auth"
 )
 
 // FileTokenRepository はファイルベースのトークンリポジトリ
@@ -21,19 +19,26 @@ func NewFileTokenRepository(filePath string) *FileTokenRepository {
 	}
 }
 
-// Save はトークンをファイルに保存する
+// Save はトークンをファイルにアトミックに保存する（パーミッション0600）
+// 保存前のトークンは "<file>.bak" にバックアップする
 func (r *FileTokenRepository) Save(ctx context.Context, token *domain.Token) error {
-	return auth.SaveTokenToFile(token.ToOAuth2Token(), r.filePath)
+	data, err := marshalToken(token)
+	if err != nil {
+		return err
+	}
+	return saveWithBackup(r.filePath, data)
 }
 
 // Load はファイルからトークンを読み込む
+// ファイルが壊れている場合はバックアップから読み込む
 func (r *FileTokenRepository) Load(ctx context.Context) (*domain.Token, error) {
-	oauth2Token, err := auth.LoadTokenFromFile(r.filePath)
-	if err != nil {
-		return nil, err
-	}
+	return loadWithBackup(r.filePath, unmarshalToken)
+}
 
-	return domain.FromOAuth2Token(oauth2Token), nil
+// Lock はトークンファイルのアドバイザリロックを取得する
+// 複数プロセスが同時にリフレッシュしてリフレッシュトークンを失うことを防ぐ
+func (r *FileTokenRepository) Lock(ctx context.Context) (func(), error) {
+	return lockFile(ctx, r.filePath)
 }
 
 // Exists はトークンファイルが存在するかを確認する
@@ -41,3 +46,9 @@ func (r *FileTokenRepository) Exists(ctx context.Context) bool {
 	_, err := os.Stat(r.filePath)
 	return err == nil
 }
+
+// Delete はトークンファイルとバックアップを削除する
+// ファイルが存在しない場合は何もしない
+func (r *FileTokenRepository) Delete(ctx context.Context) error {
+	return removeWithBackup(r.filePath)
+}
@@ -47,6 +47,85 @@ func TestFileTokenRepository_Save_And_Load(t *testing.T) {
 	}
 }
 
+func TestFileTokenRepository_Save_And_Load_Scopes(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token.json")
+	repo := NewFileTokenRepository(filePath)
+
+	ctx := context.Background()
+	token := domain.NewToken("access", "refresh", time.Now().Add(time.Hour))
+	token.Scopes = []string{"read"}
+	if err := repo.Save(ctx, token); err != nil {
+		t.Fatalf("failed to save token: %v", err)
+	}
+
+	loaded, err := repo.Load(ctx)
+	if err != nil {
+		t.Fatalf("failed to load token: %v", err)
+	}
+	if len(loaded.Scopes) != 1 || loaded.Scopes[0] != "read" {
+		t.Errorf("expected scopes [read], got %v", loaded.Scopes)
+	}
+}
+
+func TestFileTokenRepository_Save_And_Load_Metadata(t *testing.T) {
+	repo := NewFileTokenRepository(filepath.Join(t.TempDir(), "token.json"))
+
+	ctx := context.Background()
+	issuedAt := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	token := domain.NewToken("access", "refresh", issuedAt.Add(6*time.Hour))
+	token.TokenType = "bearer"
+	token.IssuedAt = issuedAt
+	token.RefreshTokenExpiry = issuedAt.Add(90 * 24 * time.Hour)
+	token.CompanyID = 12345
+	token.Extra = map[string]any{"created_at": float64(issuedAt.Unix()), "external_cid": "cid"}
+	token.DefaultCompany = &domain.Company{ID: 12345, DisplayName: "freee事務所", Role: "admin"}
+	if err := repo.Save(ctx, token); err != nil {
+		t.Fatalf("failed to save token: %v", err)
+	}
+
+	loaded, err := repo.Load(ctx)
+	if err != nil {
+		t.Fatalf("failed to load token: %v", err)
+	}
+	if loaded.TokenType != "bearer" {
+		t.Errorf("expected token type bearer, got %q", loaded.TokenType)
+	}
+	if !loaded.IssuedAt.Equal(token.IssuedAt) || !loaded.RefreshTokenExpiry.Equal(token.RefreshTokenExpiry) {
+		t.Errorf("expected issued at %v and refresh expiry %v, got %v and %v",
+			token.IssuedAt, token.RefreshTokenExpiry, loaded.IssuedAt, loaded.RefreshTokenExpiry)
+	}
+	if loaded.CompanyID != 12345 {
+		t.Errorf("expected company id 12345, got %d", loaded.CompanyID)
+	}
+	if loaded.DefaultCompany == nil || *loaded.DefaultCompany != *token.DefaultCompany {
+		t.Errorf("expected default company %+v, got %+v", token.DefaultCompany, loaded.DefaultCompany)
+	}
+	if loaded.Extra["external_cid"] != "cid" || loaded.Extra["created_at"] != float64(issuedAt.Unix()) {
+		t.Errorf("unexpected extra fields: %v", loaded.Extra)
+	}
+}
+
+func TestFileTokenRepository_Load_LegacyFormat(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token.json")
+	legacy := `{"access_token":"access","token_type":"Bearer","refresh_token":"refresh","expiry":"2030-01-01T00:00:00Z"}`
+	os.WriteFile(filePath, []byte(legacy), 0600)
+	repo := NewFileTokenRepository(filePath)
+
+	loaded, err := repo.Load(context.Background())
+	if err != nil {
+		t.Fatalf("failed to load legacy token: %v", err)
+	}
+	if loaded.AccessToken != "access" || loaded.RefreshToken != "refresh" {
+		t.Errorf("unexpected token: %+v", loaded)
+	}
+	if loaded.Expiry.Year() != 2030 {
+		t.Errorf("unexpected expiry: %v", loaded.Expiry)
+	}
+	if loaded.TokenType != "Bearer" || !loaded.RefreshTokenExpiry.IsZero() {
+		t.Errorf("unexpected token metadata: %+v", loaded)
+	}
+}
+
 func TestFileTokenRepository_Load_WhenFileNotExists(t *testing.T) {
 	tmpDir := t.TempDir()
 	filePath := filepath.Join(tmpDir, "nonexistent.json")
@@ -81,6 +160,54 @@ func TestFileTokenRepository_Exists(t *testing.T) {
 	}
 }
 
+func TestFileTokenRepository_Delete(t *testing.T) {
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "token.json")
+	repo := NewFileTokenRepository(filePath)
+
+	ctx := context.Background()
+	token := domain.NewToken("access", "refresh", time.Now().Add(time.Hour))
+	repo.Save(ctx, token)
+
+	if err := repo.Delete(ctx); err != nil {
+		t.Fatalf("failed to delete token: %v", err)
+	}
+	if repo.Exists(ctx) {
+		t.Error("expected Exists to return false after delete")
+	}
+
+	// 存在しないファイルの削除はエラーにならない
+	if err := repo.Delete(ctx); err != nil {
+		t.Errorf("expected no error when deleting nonexistent file, got %v", err)
+	}
+}
+
+func TestFileTokenRepository_Lock(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token.json")
+	repo := NewFileTokenRepository(filePath)
+	other := NewFileTokenRepository(filePath)
+
+	unlock, err := repo.Lock(context.Background())
+	if err != nil {
+		t.Fatalf("failed to lock: %v", err)
+	}
+
+	// ロック中は他のインスタンスがロックを取得できない
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := other.Lock(ctx); err == nil {
+		t.Fatal("expected lock to be held")
+	}
+
+	unlock()
+
+	unlockOther, err := other.Lock(context.Background())
+	if err != nil {
+		t.Fatalf("failed to lock after unlock: %v", err)
+	}
+	unlockOther()
+}
+
 func TestFileTokenRepository_FilePermissions(t *testing.T) {
 	tmpDir := t.TempDir()
 	filePath := filepath.Join(tmpDir, "token.json")
@@ -101,3 +228,93 @@ func TestFileTokenRepository_FilePermissions(t *testing.T) {
 		t.Errorf("expected file permission 0600, got %o", perm)
 	}
 }
+
+func TestFileTokenRepository_Save_KeepsBackup(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token.json")
+	repo := NewFileTokenRepository(filePath)
+
+	ctx := context.Background()
+	repo.Save(ctx, domain.NewToken("first", "refresh", time.Now().Add(time.Hour)))
+	repo.Save(ctx, domain.NewToken("second", "refresh", time.Now().Add(time.Hour)))
+
+	backup, err := NewFileTokenRepository(backupPath(filePath)).Load(ctx)
+	if err != nil {
+		t.Fatalf("failed to load backup: %v", err)
+	}
+	if backup.AccessToken != "first" {
+		t.Errorf("expected backup to hold previous token, got %s", backup.AccessToken)
+	}
+
+	info, err := os.Stat(backupPath(filePath))
+	if err != nil {
+		t.Fatalf("failed to stat backup: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("expected backup permission 0600, got %o", perm)
+	}
+}
+
+func TestFileTokenRepository_Save_LeavesNoTempFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	repo := NewFileTokenRepository(filepath.Join(tmpDir, "token.json"))
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		repo.Save(ctx, domain.NewToken("access", "refresh", time.Now().Add(time.Hour)))
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to read dir: %v", err)
+	}
+	for _, e := range entries {
+		if e.Name() != "token.json" && e.Name() != "token.json.bak" {
+			t.Errorf("unexpected file left behind: %s", e.Name())
+		}
+	}
+}
+
+func TestFileTokenRepository_Load_FallsBackToBackup(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token.json")
+	repo := NewFileTokenRepository(filePath)
+
+	ctx := context.Background()
+	repo.Save(ctx, domain.NewToken("first", "refresh", time.Now().Add(time.Hour)))
+	repo.Save(ctx, domain.NewToken("second", "refresh", time.Now().Add(time.Hour)))
+
+	// 書き込み途中で壊れたファイルを再現する
+	os.WriteFile(filePath, []byte(`{"access_token": "sec`), 0600)
+
+	loaded, err := repo.Load(ctx)
+	if err != nil {
+		t.Fatalf("expected fallback to backup, got error: %v", err)
+	}
+	if loaded.AccessToken != "first" {
+		t.Errorf("expected first, got %s", loaded.AccessToken)
+	}
+
+	// 壊れたファイルへの保存で正常なバックアップを上書きしない
+	if err := repo.Save(ctx, domain.NewToken("third", "refresh", time.Now().Add(time.Hour))); err != nil {
+		t.Fatalf("failed to save token: %v", err)
+	}
+	backup, _ := NewFileTokenRepository(backupPath(filePath)).Load(ctx)
+	if backup == nil || backup.AccessToken != "first" {
+		t.Errorf("expected backup to be preserved, got %+v", backup)
+	}
+}
+
+func TestFileTokenRepository_Delete_RemovesBackup(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token.json")
+	repo := NewFileTokenRepository(filePath)
+
+	ctx := context.Background()
+	repo.Save(ctx, domain.NewToken("first", "refresh", time.Now().Add(time.Hour)))
+	repo.Save(ctx, domain.NewToken("second", "refresh", time.Now().Add(time.Hour)))
+
+	if err := repo.Delete(ctx); err != nil {
+		t.Fatalf("failed to delete token: %v", err)
+	}
+	if _, err := os.Stat(backupPath(filePath)); !os.IsNotExist(err) {
+		t.Error("expected backup to be deleted")
+	}
+}
@@ -0,0 +1,92 @@
+package persistence
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"freee-oauth-app/domain"
+)
+
+// MemoryStateStore はプロセス内のメモリに認可リクエストを保持するStateStore
+type MemoryStateStore struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]*domain.PendingAuthorization
+}
+
+// StateStoreOption はStateStoreの設定を変更する
+type StateStoreOption func(*stateStoreOptions)
+
+type stateStoreOptions struct {
+	clock domain.Clock
+}
+
+// WithStateClock は認可リクエストの有効期限の判定に使う時計を設定する（既定: domain.SystemClock）
+func WithStateClock(clock domain.Clock) StateStoreOption {
+	return func(o *stateStoreOptions) {
+		o.clock = clock
+	}
+}
+
+func newStateStoreOptions(opts []StateStoreOption) stateStoreOptions {
+	o := stateStoreOptions{clock: domain.SystemClock}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// NewMemoryStateStore は新しいMemoryStateStoreを生成する
+// 作成から ttl を過ぎた認可リクエストは取り出せない
+func NewMemoryStateStore(ttl time.Duration, opts ...StateStoreOption) *MemoryStateStore {
+	o := newStateStoreOptions(opts)
+	return &MemoryStateStore{
+		ttl:     ttl,
+		now:     o.clock.Now,
+		pending: map[string]*domain.PendingAuthorization{},
+	}
+}
+
+// Save は認可リクエストを保存する。期限切れの認可リクエストはこの時に削除する
+func (s *MemoryStateStore) Save(ctx context.Context, auth *domain.PendingAuthorization) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pruneExpired(s.pending, s.now(), s.ttl)
+	copied := *auth
+	s.pending[auth.State] = &copied
+	return nil
+}
+
+// Consume は認可リクエストを取り出して削除する
+func (s *MemoryStateStore) Consume(ctx context.Context, state string) (*domain.PendingAuthorization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return consume(s.pending, state, s.now(), s.ttl)
+}
+
+// consume はstateの認可リクエストを削除し、有効期限内であれば返す
+func consume(pending map[string]*domain.PendingAuthorization, state string, now time.Time, ttl time.Duration) (*domain.PendingAuthorization, error) {
+	auth, ok := pending[state]
+	if !ok {
+		return nil, domain.ErrAuthorizationNotFound
+	}
+	delete(pending, state)
+	if auth.IsExpired(now, ttl) {
+		return nil, domain.ErrAuthorizationExpired
+	}
+	return auth, nil
+}
+
+// pruneExpired は期限切れの認可リクエストを削除する
+func pruneExpired(pending map[string]*domain.PendingAuthorization, now time.Time, ttl time.Duration) {
+	for state, auth := range pending {
+		if auth.IsExpired(now, ttl) {
+			delete(pending, state)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"freee-oauth-app/domain"
+)
+
+// stateStoreFactories は両方のStateStore実装に同じテストを適用するためのファクトリ
+func stateStoreFactories(t *testing.T) map[string]func(now func() time.Time) domain.StateStore {
+	return map[string]func(now func() time.Time) domain.StateStore{
+		"memory": func(now func() time.Time) domain.StateStore {
+			return NewMemoryStateStore(10*time.Minute, WithStateClock(domain.ClockFunc(now)))
+		},
+		"file": func(now func() time.Time) domain.StateStore {
+			return NewFileStateStore(filepath.Join(t.TempDir(), "states.json"), 10*time.Minute, WithStateClock(domain.ClockFunc(now)))
+		},
+	}
+}
+
+func TestStateStore_SaveAndConsume(t *testing.T) {
+	for name, newStore := range stateStoreFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(time.Now)
+			ctx := context.Background()
+
+			first := &domain.PendingAuthorization{State: "s1", CodeVerifier: "v1", RedirectURL: "http://localhost:8080/callback", Profile: "default", CreatedAt: time.Now()}
+			second := &domain.PendingAuthorization{State: "s2", CodeVerifier: "v2", Profile: "sandbox", CreatedAt: time.Now()}
+			store.Save(ctx, first)
+			store.Save(ctx, second)
+
+			// 2つ目の認可リクエストを開始しても1つ目は有効
+			got, err := store.Consume(ctx, "s1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.CodeVerifier != "v1" || got.RedirectURL != first.RedirectURL || got.Profile != "default" {
+				t.Errorf("unexpected authorization: %+v", got)
+			}
+
+			got, err = store.Consume(ctx, "s2")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.CodeVerifier != "v2" || got.Profile != "sandbox" {
+				t.Errorf("unexpected authorization: %+v", got)
+			}
+		})
+	}
+}
+
+func TestStateStore_ConsumeIsOneTime(t *testing.T) {
+	for name, newStore := range stateStoreFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(time.Now)
+			ctx := context.Background()
+			store.Save(ctx, &domain.PendingAuthorization{State: "s1", CodeVerifier: "v1", CreatedAt: time.Now()})
+
+			if _, err := store.Consume(ctx, "s1"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, err := store.Consume(ctx, "s1"); !errors.Is(err, domain.ErrAuthorizationNotFound) {
+				t.Errorf("expected ErrAuthorizationNotFound on replay, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStateStore_Expired(t *testing.T) {
+	for name, newStore := range stateStoreFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			store := newStore(func() time.Time { return now })
+			ctx := context.Background()
+			store.Save(ctx, &domain.PendingAuthorization{State: "s1", CodeVerifier: "v1", CreatedAt: now})
+
+			now = now.Add(11 * time.Minute)
+			if _, err := store.Consume(ctx, "s1"); !errors.Is(err, domain.ErrAuthorizationExpired) {
+				t.Errorf("expected ErrAuthorizationExpired, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStateStore_UnknownState(t *testing.T) {
+	for name, newStore := range stateStoreFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(time.Now)
+			if _, err := store.Consume(context.Background(), "unknown"); !errors.Is(err, domain.ErrAuthorizationNotFound) {
+				t.Errorf("expected ErrAuthorizationNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFileStateStore_SharedBetweenInstances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "states.json")
+	ctx := context.Background()
+
+	NewFileStateStore(path, time.Minute).Save(ctx, &domain.PendingAuthorization{State: "s1", CodeVerifier: "v1", CreatedAt: time.Now()})
+
+	// 同じstateを複数のインスタンスが同時に取り出しても成功するのは1つだけ
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := NewFileStateStore(path, time.Minute).Consume(ctx, "s1"); err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != 1 {
+		t.Errorf("expected exactly one consumer to succeed, got %d", succeeded)
+	}
+}
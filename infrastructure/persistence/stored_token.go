@@ -0,0 +1,89 @@
+package persistence
+
+import (
+	"encoding/json"
+	"time"
+
+	"freee-oauth-app/domain"
+)
+
+// storedToken はトークンファイルに保存するJSON形式
+// oauth2.Token のJSON形式と互換性があり、付与されたスコープやトークンレスポンスの追加情報も保存する
+type storedToken struct {
+	AccessToken        string         `json:"access_token"`
+	TokenType          string         `json:"token_type,omitempty"`
+	RefreshToken       string         `json:"refresh_token,omitempty"`
+	Expiry             time.Time      `json:"expiry,omitempty"`
+	Scopes             []string       `json:"scopes,omitempty"`
+	IssuedAt           time.Time      `json:"issued_at,omitzero"`
+	RefreshTokenExpiry time.Time      `json:"refresh_token_expiry,omitzero"`
+	CompanyID          int64          `json:"company_id,omitempty"`
+	Extra              map[string]any `json:"extra,omitempty"`
+	DefaultCompany     *storedCompany `json:"default_company,omitempty"`
+}
+
+// storedCompany はトークンと共に保存する既定の事業所
+type storedCompany struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	Role        string `json:"role,omitempty"`
+}
+
+func marshalToken(token *domain.Token) ([]byte, error) {
+	return json.MarshalIndent(storedToken{
+		AccessToken:        token.AccessToken,
+		TokenType:          token.TokenType,
+		RefreshToken:       token.RefreshToken,
+		Expiry:             token.Expiry,
+		Scopes:             token.Scopes,
+		IssuedAt:           token.IssuedAt,
+		RefreshTokenExpiry: token.RefreshTokenExpiry,
+		CompanyID:          token.CompanyID,
+		Extra:              token.Extra,
+		DefaultCompany:     toStoredCompany(token.DefaultCompany),
+	}, "", "  ")
+}
+
+func unmarshalToken(data []byte) (*domain.Token, error) {
+	var stored storedToken
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	return &domain.Token{
+		AccessToken:        stored.AccessToken,
+		TokenType:          stored.TokenType,
+		RefreshToken:       stored.RefreshToken,
+		Expiry:             stored.Expiry,
+		Scopes:             stored.Scopes,
+		IssuedAt:           stored.IssuedAt,
+		RefreshTokenExpiry: stored.RefreshTokenExpiry,
+		CompanyID:          stored.CompanyID,
+		Extra:              stored.Extra,
+		DefaultCompany:     stored.DefaultCompany.toDomain(),
+	}, nil
+}
+
+func toStoredCompany(company *domain.Company) *storedCompany {
+	if company == nil {
+		return nil
+	}
+	return &storedCompany{
+		ID:          company.ID,
+		Name:        company.Name,
+		DisplayName: company.DisplayName,
+		Role:        company.Role,
+	}
+}
+
+func (c *storedCompany) toDomain() *domain.Company {
+	if c == nil {
+		return nil
+	}
+	return &domain.Company{
+		ID:          c.ID,
+		Name:        c.Name,
+		DisplayName: c.DisplayName,
+		Role:        c.Role,
+	}
+}
@@ -0,0 +1,151 @@
+// Package retry は一時的な障害に対して再試行する domain.OAuthProvider のデコレーターを提供する
+//
+// 再試行するのは domain.ErrTransient に分類されるエラー（ネットワークエラー、5xx、429、
+// temporarily_unavailable）のみで、invalid_grant などは即座に返す。
+// 認可コード・リフレッシュトークンを使う Exchange と Refresh は、リクエストを送信した後に
+// 応答を受け取れなかった場合は再試行しない（domain.OAuthError.IsRetryableGrant）。
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"freee-oauth-app/domain"
+)
+
+// Policy は再試行の方針
+type Policy struct {
+	// MaxAttempts は最初の試行を含む最大試行回数（1以下の場合は再試行しない）
+	MaxAttempts int
+	// InitialBackoff は1回目の再試行までの待ち時間（以降は2倍ずつ増やす）
+	InitialBackoff time.Duration
+	// MaxBackoff は再試行までの待ち時間の上限
+	MaxBackoff time.Duration
+	// MaxElapsed は最初の試行からの経過時間の上限（0の場合は無制限）
+	// 待ち時間がこの上限を超える場合は再試行せずに最後のエラーを返す
+	MaxElapsed time.Duration
+}
+
+// DefaultPolicy は既定の再試行の方針
+var DefaultPolicy = Policy{
+	MaxAttempts:    4,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     8 * time.Second,
+	MaxElapsed:     30 * time.Second,
+}
+
+// Provider はトークンエンドポイントへのリクエストを指数バックオフで再試行する domain.OAuthProvider
+//
+// freeeは認可コードを1回しか使えず、リフレッシュ時にはリフレッシュトークンをローテーションするため、
+// リクエストがfreeeに届いた後に応答が失われた場合の再試行は invalid_grant で失敗する。
+// そのため Exchange と Refresh は、接続エラーなど送信前の失敗と、エラーの応答を受け取った場合だけ再試行する。
+type Provider struct {
+	inner  domain.OAuthProvider
+	policy Policy
+	now    func() time.Time
+	sleep  func(ctx context.Context, d time.Duration) error
+	jitter func(d time.Duration) time.Duration
+}
+
+// NewProvider は inner を再試行するProviderを生成する
+func NewProvider(inner domain.OAuthProvider, policy Policy) *Provider {
+	return &Provider{
+		inner:  inner,
+		policy: policy,
+		now:    time.Now,
+		sleep:  sleep,
+		jitter: equalJitter,
+	}
+}
+
+// Scopes は認可時に要求するスコープを返す
+func (p *Provider) Scopes() []string {
+	return p.inner.Scopes()
+}
+
+// AuthorizationURL は認可URLを生成する（ネットワークにアクセスしないため再試行しない）
+func (p *Provider) AuthorizationURL(state, codeVerifier, redirectURL string) string {
+	return p.inner.AuthorizationURL(state, codeVerifier, redirectURL)
+}
+
+// Exchange は認可コードをトークンに交換する
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, redirectURL string) (*domain.Token, error) {
+	var token *domain.Token
+	err := p.do(ctx, isRetryableGrant, func() (err error) {
+		token, err = p.inner.Exchange(ctx, code, codeVerifier, redirectURL)
+		return err
+	})
+	return token, err
+}
+
+// Refresh はリフレッシュトークンを使用してトークンを更新する
+func (p *Provider) Refresh(ctx context.Context, token *domain.Token) (*domain.Token, error) {
+	var newToken *domain.Token
+	err := p.do(ctx, isRetryableGrant, func() (err error) {
+		newToken, err = p.inner.Refresh(ctx, token)
+		return err
+	})
+	return newToken, err
+}
+
+// Revoke はトークンを認可サーバー上で無効化する
+func (p *Provider) Revoke(ctx context.Context, token *domain.Token) error {
+	return p.do(ctx, isTransient, func() error {
+		return p.inner.Revoke(ctx, token)
+	})
+}
+
+// do は op が retryable なエラーで失敗した場合に、試行回数と経過時間の上限まで再試行する
+func (p *Provider) do(ctx context.Context, retryable func(error) bool, op func() error) error {
+	deadline := p.now().Add(p.policy.MaxElapsed)
+	backoff := p.policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || !retryable(err) || attempt >= p.policy.MaxAttempts {
+			return err
+		}
+
+		delay := p.jitter(backoff)
+		if p.policy.MaxElapsed > 0 && p.now().Add(delay).After(deadline) {
+			return err
+		}
+		if err := p.sleep(ctx, delay); err != nil {
+			return err
+		}
+		backoff = min(backoff*2, p.policy.MaxBackoff)
+	}
+}
+
+// isTransient は一時的な障害かを判定する
+func isTransient(err error) bool {
+	return errors.Is(err, domain.ErrTransient)
+}
+
+// isRetryableGrant は認可コード・リフレッシュトークンを消費していない一時的な障害かを判定する
+func isRetryableGrant(err error) bool {
+	var oauthErr *domain.OAuthError
+	return errors.As(err, &oauthErr) && oauthErr.IsRetryableGrant()
+}
+
+// equalJitter は d の半分から d までの一様乱数を返す
+// 複数のプロセスが同時に再試行して認可サーバーに負荷が集中するのを避ける
+func equalJitter(d time.Duration) time.Duration {
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + rand.N(d-half+1)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
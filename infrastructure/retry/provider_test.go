@@ -0,0 +1,233 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"freee-oauth-app/domain"
+)
+
+var (
+	errUnavailable = &domain.OAuthError{Op: "refresh", StatusCode: http.StatusServiceUnavailable}
+	errRevoked     = &domain.OAuthError{Op: "refresh", Code: domain.ErrorCodeInvalidGrant, StatusCode: http.StatusBadRequest}
+	// errConnect はリクエストを送信する前の接続エラー
+	errConnect = &domain.OAuthError{Op: "refresh", Unsent: true, Err: errors.New("connection refused")}
+	// errNoResponse はリクエストを送信した後に応答を受け取れなかったエラー
+	errNoResponse = &domain.OAuthError{Op: "refresh", Err: errors.New("timeout awaiting response headers")}
+)
+
+// scriptedProvider は呼び出しごとに errs の先頭から順にエラーを返す（尽きたら成功する）
+type scriptedProvider struct {
+	errs  []error
+	calls int
+}
+
+func (m *scriptedProvider) next() error {
+	m.calls++
+	if len(m.errs) == 0 {
+		return nil
+	}
+	err := m.errs[0]
+	m.errs = m.errs[1:]
+	return err
+}
+
+func (m *scriptedProvider) Scopes() []string { return []string{"read"} }
+
+func (m *scriptedProvider) AuthorizationURL(state, codeVerifier, redirectURL string) string {
+	return "https://example.com/auth?state=" + state
+}
+
+func (m *scriptedProvider) Exchange(ctx context.Context, code, codeVerifier, redirectURL string) (*domain.Token, error) {
+	if err := m.next(); err != nil {
+		return nil, err
+	}
+	return domain.NewToken("exchanged", "refresh", time.Now().Add(time.Hour)), nil
+}
+
+func (m *scriptedProvider) Refresh(ctx context.Context, token *domain.Token) (*domain.Token, error) {
+	if err := m.next(); err != nil {
+		return nil, err
+	}
+	return domain.NewToken("refreshed", "refresh", time.Now().Add(time.Hour)), nil
+}
+
+func (m *scriptedProvider) Revoke(ctx context.Context, token *domain.Token) error {
+	return m.next()
+}
+
+// newTestProvider は待ち時間を記録し、実際には待たずに時計を進めるProviderを生成する
+func newTestProvider(inner domain.OAuthProvider, policy Policy) (*Provider, *[]time.Duration) {
+	var delays []time.Duration
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := NewProvider(inner, policy)
+	p.now = func() time.Time { return now }
+	p.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		now = now.Add(d)
+		return ctx.Err()
+	}
+	p.jitter = func(d time.Duration) time.Duration { return d }
+	return p, &delays
+}
+
+func TestProvider_RetriesTransientErrors(t *testing.T) {
+	inner := &scriptedProvider{errs: []error{errUnavailable, errUnavailable}}
+	p, delays := newTestProvider(inner, DefaultPolicy)
+
+	token, err := p.Refresh(context.Background(), domain.NewToken("old", "refresh", time.Now()))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.AccessToken != "refreshed" {
+		t.Errorf("expected refreshed token, got %s", token.AccessToken)
+	}
+	if inner.calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", inner.calls)
+	}
+	want := []time.Duration{500 * time.Millisecond, time.Second}
+	if len(*delays) != len(want) || (*delays)[0] != want[0] || (*delays)[1] != want[1] {
+		t.Errorf("expected backoff %v, got %v", want, *delays)
+	}
+}
+
+func TestProvider_DoesNotRetryPermanentErrors(t *testing.T) {
+	inner := &scriptedProvider{errs: []error{errRevoked}}
+	p, delays := newTestProvider(inner, DefaultPolicy)
+
+	_, err := p.Refresh(context.Background(), domain.NewToken("old", "refresh", time.Now()))
+
+	if !errors.Is(err, domain.ErrInvalidGrant) {
+		t.Errorf("expected ErrInvalidGrant, got %v", err)
+	}
+	if inner.calls != 1 || len(*delays) != 0 {
+		t.Errorf("expected a single attempt, got %d attempts and delays %v", inner.calls, *delays)
+	}
+}
+
+func TestProvider_StopsAtMaxAttempts(t *testing.T) {
+	inner := &scriptedProvider{errs: []error{errUnavailable, errUnavailable, errUnavailable, errUnavailable, errUnavailable}}
+	p, _ := newTestProvider(inner, Policy{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: time.Second})
+
+	_, err := p.Exchange(context.Background(), "code", "verifier", "")
+
+	if !errors.Is(err, domain.ErrTransient) {
+		t.Errorf("expected last transient error, got %v", err)
+	}
+	if inner.calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", inner.calls)
+	}
+}
+
+func TestProvider_CapsBackoff(t *testing.T) {
+	inner := &scriptedProvider{errs: []error{errUnavailable, errUnavailable, errUnavailable, errUnavailable}}
+	p, delays := newTestProvider(inner, Policy{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: 3 * time.Second})
+
+	if err := p.Revoke(context.Background(), domain.NewToken("access", "refresh", time.Now())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}
+	for i := range want {
+		if i >= len(*delays) || (*delays)[i] != want[i] {
+			t.Fatalf("expected backoff %v, got %v", want, *delays)
+		}
+	}
+}
+
+func TestProvider_StopsAtMaxElapsed(t *testing.T) {
+	inner := &scriptedProvider{errs: []error{errUnavailable, errUnavailable, errUnavailable}}
+	p, delays := newTestProvider(inner, Policy{MaxAttempts: 10, InitialBackoff: 2 * time.Second, MaxBackoff: time.Minute, MaxElapsed: 5 * time.Second})
+
+	_, err := p.Refresh(context.Background(), domain.NewToken("old", "refresh", time.Now()))
+
+	if !errors.Is(err, domain.ErrTransient) {
+		t.Errorf("expected last transient error, got %v", err)
+	}
+	// 2秒待った後、次の4秒待つと上限の5秒を超えるため打ち切る
+	if inner.calls != 2 || len(*delays) != 1 {
+		t.Errorf("expected 2 attempts and 1 delay, got %d attempts and delays %v", inner.calls, *delays)
+	}
+}
+
+func TestProvider_StopsWhenContextIsCanceled(t *testing.T) {
+	inner := &scriptedProvider{errs: []error{errUnavailable, errUnavailable}}
+	p, _ := newTestProvider(inner, DefaultPolicy)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := p.Refresh(ctx, domain.NewToken("old", "refresh", time.Now()))
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if inner.calls != 1 {
+		t.Errorf("expected a single attempt, got %d", inner.calls)
+	}
+}
+
+func TestProvider_SingleAttemptDisablesRetry(t *testing.T) {
+	inner := &scriptedProvider{errs: []error{errUnavailable}}
+	p, _ := newTestProvider(inner, Policy{MaxAttempts: 1})
+
+	if _, err := p.Refresh(context.Background(), domain.NewToken("old", "refresh", time.Now())); err == nil {
+		t.Error("expected error")
+	}
+	if inner.calls != 1 {
+		t.Errorf("expected a single attempt, got %d", inner.calls)
+	}
+}
+
+func TestProvider_RetriesGrantOnlyWhenNotConsumed(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		calls int
+	}{
+		{"connect error", errConnect, 2},
+		{"5xx response", errUnavailable, 2},
+		{"no response after sending", errNoResponse, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refresh := &scriptedProvider{errs: []error{tt.err}}
+			p, _ := newTestProvider(refresh, DefaultPolicy)
+			p.Refresh(context.Background(), domain.NewToken("old", "refresh", time.Now()))
+			if refresh.calls != tt.calls {
+				t.Errorf("refresh: expected %d attempts, got %d", tt.calls, refresh.calls)
+			}
+
+			exchange := &scriptedProvider{errs: []error{tt.err}}
+			p, _ = newTestProvider(exchange, DefaultPolicy)
+			p.Exchange(context.Background(), "code", "verifier", "")
+			if exchange.calls != tt.calls {
+				t.Errorf("exchange: expected %d attempts, got %d", tt.calls, exchange.calls)
+			}
+		})
+	}
+}
+
+func TestProvider_RetriesRevokeAfterRequestSent(t *testing.T) {
+	inner := &scriptedProvider{errs: []error{errNoResponse}}
+	p, _ := newTestProvider(inner, DefaultPolicy)
+
+	if err := p.Revoke(context.Background(), domain.NewToken("access", "refresh", time.Now())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if inner.calls != 2 {
+		t.Errorf("expected revoke to be retried, got %d attempts", inner.calls)
+	}
+}
+
+func TestEqualJitter(t *testing.T) {
+	for range 100 {
+		if d := equalJitter(time.Second); d < 500*time.Millisecond || d > time.Second {
+			t.Fatalf("jitter out of range: %s", d)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Package client はOAuthUseCaseをバックエンドとするfreee API用のHTTPクライアントを提供する
+//
+// トークンのリフレッシュはユースケースを経由するため、リフレッシュ結果は
+// 常にTokenRepositoryに保存され、他のプロセスとも排他制御される。
+//
+//	uc := usecase.NewOAuthUseCase(tokenRepo, provider, persistence.NewMemoryStateStore(5*time.Minute))
+//	httpClient := client.NewClient(ctx, uc)
+//	resp, err := httpClient.Get("https://api.freee.co.jp/api/1/users/me")
+package client
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"freee-oauth-app/domain"
+
+	"golang.org/x/oauth2"
+)
+
+// UseCase はクライアントが必要とするユースケースのインターフェース
+// *usecase.OAuthUseCase が満たす
+type UseCase interface {
+	GetOrRefreshToken(ctx context.Context) (*domain.Token, error)
+	ForceRefresh(ctx context.Context) (*domain.Token, error)
+}
+
+// TokenSource はユースケースからトークンを取得する oauth2.TokenSource
+//
+// 取得したトークンは有効な間メモリに保持し、期限が近づいた場合だけ
+// ユースケースに問い合わせる（必要に応じてリフレッシュして保存される）。
+type TokenSource struct {
+	ctx     context.Context
+	useCase UseCase
+	// expiry はメモリに保持したトークンの有効期限の判定に使う
+	expiry domain.ExpiryPolicy
+
+	mu    sync.Mutex
+	token *domain.Token
+}
+
+var _ oauth2.TokenSource = (*TokenSource)(nil)
+
+// NewTokenSource は新しいTokenSourceを生成する
+// ctx はリフレッシュ時のリクエストに使用される（oauth2.HTTPClient を設定できる）
+// ユースケースが ExpiryPolicy() を持つ場合は、ユースケースと同じ時計・しきい値で有効期限を判定する
+func NewTokenSource(ctx context.Context, useCase UseCase) *TokenSource {
+	s := &TokenSource{
+		ctx:     ctx,
+		useCase: useCase,
+		expiry:  domain.DefaultExpiryPolicy,
+	}
+	if p, ok := useCase.(interface{ ExpiryPolicy() domain.ExpiryPolicy }); ok {
+		s.expiry = p.ExpiryPolicy()
+	}
+	return s
+}
+
+// Token は有効なアクセストークンを返す
+func (s *TokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != nil && s.expiry.IsValid(s.token) {
+		return s.token.ToOAuth2Token(), nil
+	}
+
+	token, err := s.useCase.GetOrRefreshToken(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	return token.ToOAuth2Token(), nil
+}
+
+// Refresh はAPIに拒否されたトークンの代わりとなる新しいトークンを返す
+// 保存されているトークンが既に更新されている場合はリフレッシュせずにそれを使う
+func (s *TokenSource) Refresh(rejected *oauth2.Token) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, err := s.useCase.GetOrRefreshToken(s.ctx)
+	if err != nil || token.AccessToken == rejected.AccessToken {
+		if token, err = s.useCase.ForceRefresh(s.ctx); err != nil {
+			return nil, err
+		}
+	}
+	s.token = token
+	return token.ToOAuth2Token(), nil
+}
+
+// Transport はリクエストにAuthorizationヘッダを付与する http.RoundTripper
+//
+// APIが401を返した場合は、リクエストを再送できるときに限り
+// トークンをリフレッシュして1回だけ再送する。
+type Transport struct {
+	Source *TokenSource
+	// Base は実際にリクエストを送信するRoundTripper（nilの場合は http.DefaultTransport）
+	Base http.RoundTripper
+}
+
+// RoundTrip はリクエストを送信する
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTripperは元のリクエストを変更してはならないため、クローンに認可ヘッダを付与する
+	token, err := t.Source.Token()
+	if err != nil {
+		closeBody(req)
+		return nil, err
+	}
+
+	resp, err := t.base().RoundTrip(authorize(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || !replayable(req) {
+		return resp, err
+	}
+
+	retry, err := rewind(req)
+	if err != nil {
+		return resp, nil
+	}
+	token, err = t.Source.Refresh(token)
+	if err != nil {
+		closeBody(retry)
+		return resp, nil
+	}
+	resp.Body.Close()
+	return t.base().RoundTrip(authorize(retry, token))
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// NewClient はユースケースのトークンで認可する *http.Client を生成する
+func NewClient(ctx context.Context, useCase UseCase) *http.Client {
+	return &http.Client{
+		Transport: &Transport{
+			Source: NewTokenSource(ctx, useCase),
+			Base:   baseTransport(ctx),
+		},
+	}
+}
+
+// baseTransport は ctx に oauth2.HTTPClient が設定されていればそのTransportを返す
+func baseTransport(ctx context.Context) http.RoundTripper {
+	if c, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok && c.Transport != nil {
+		return c.Transport
+	}
+	return nil
+}
+
+func authorize(req *http.Request, token *oauth2.Token) *http.Request {
+	out := req.Clone(req.Context())
+	token.SetAuthHeader(out)
+	return out
+}
+
+// replayable はリクエストを再送できるかを判定する
+func replayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// rewind は再送用にボディを作り直したリクエストを返す
+func rewind(req *http.Request) (*http.Request, error) {
+	out := req.Clone(req.Context())
+	if req.GetBody == nil {
+		return out, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	out.Body = body
+	return out, nil
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
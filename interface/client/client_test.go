@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"freee-oauth-app/domain"
+)
+
+// モックUseCase
+type mockUseCase struct {
+	mu           sync.Mutex
+	token        *domain.Token
+	refreshed    *domain.Token
+	err          error
+	getCalls     int
+	refreshCalls int
+}
+
+func (m *mockUseCase) GetOrRefreshToken(ctx context.Context) (*domain.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.getCalls++
+	return m.token, m.err
+}
+
+func (m *mockUseCase) ForceRefresh(ctx context.Context) (*domain.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refreshCalls++
+	m.token = m.refreshed
+	return m.token, nil
+}
+
+func TestTokenSource_CachesValidToken(t *testing.T) {
+	uc := &mockUseCase{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	src := NewTokenSource(context.Background(), uc)
+
+	for i := 0; i < 3; i++ {
+		token, err := src.Token()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if token.AccessToken != "access" {
+			t.Errorf("expected access, got %s", token.AccessToken)
+		}
+	}
+	if uc.getCalls != 1 {
+		t.Errorf("expected 1 use case call, got %d", uc.getCalls)
+	}
+}
+
+func TestTokenSource_AsksUseCaseWhenExpiring(t *testing.T) {
+	uc := &mockUseCase{token: domain.NewToken("expiring", "refresh", time.Now().Add(time.Minute))}
+	src := NewTokenSource(context.Background(), uc)
+
+	src.Token()
+	uc.token = domain.NewToken("refreshed", "refresh", time.Now().Add(time.Hour))
+	token, err := src.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.AccessToken != "refreshed" {
+		t.Errorf("expected refreshed, got %s", token.AccessToken)
+	}
+}
+
+func TestTokenSource_PropagatesError(t *testing.T) {
+	wantErr := errors.New("no token")
+	src := NewTokenSource(context.Background(), &mockUseCase{err: wantErr})
+
+	if _, err := src.Token(); !errors.Is(err, wantErr) {
+		t.Errorf("expected %v, got %v", wantErr, err)
+	}
+}
+
+func TestNewClient_SetsAuthorization(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer access" {
+			t.Errorf("expected Bearer access, got %q", got)
+		}
+	}))
+	defer server.Close()
+
+	uc := &mockUseCase{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	resp, err := NewClient(context.Background(), uc).Get(server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestTransport_RetriesOnceAfterUnauthorized(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "payload" {
+			t.Errorf("expected body to be resent, got %q", body)
+		}
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	uc := &mockUseCase{
+		token:     domain.NewToken("stale", "refresh", time.Now().Add(time.Hour)),
+		refreshed: domain.NewToken("fresh", "refresh", time.Now().Add(time.Hour)),
+	}
+	resp, err := NewClient(context.Background(), uc).Post(server.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200, got %d", resp.StatusCode)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+	if uc.refreshCalls != 1 {
+		t.Errorf("expected 1 forced refresh, got %d", uc.refreshCalls)
+	}
+}
+
+func TestTransport_DoesNotRetryUnreplayableBody(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	uc := &mockUseCase{token: domain.NewToken("stale", "refresh", time.Now().Add(time.Hour))}
+	req, _ := http.NewRequest(http.MethodPost, server.URL, io.NopCloser(strings.NewReader("payload")))
+	resp, err := NewClient(context.Background(), uc).Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", resp.StatusCode)
+	}
+	if calls != 1 || uc.refreshCalls != 0 {
+		t.Errorf("expected no retry, got %d calls and %d refreshes", calls, uc.refreshCalls)
+	}
+}
@@ -0,0 +1,91 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"syscall"
+)
+
+// ErrNonLoopbackRedirect はリダイレクトURLのホストがループバックでないことを表す
+var ErrNonLoopbackRedirect = errors.New("redirect URL host must be localhost or a loopback address")
+
+// ListenLoopback はリダイレクトURLのホストに対応するループバックアドレスだけで待ち受ける
+//
+// ports を順に試し、使用中のポートは読み飛ばす。ポート0はOSが選んだ空きポートを使う。
+// ホストが localhost の場合は 127.0.0.1 と [::1] の両方で同じポートを待ち受ける
+// （IPv6が使えない環境では 127.0.0.1 のみ）。
+// 戻り値のリダイレクトURLには実際に待ち受けたポートが反映される。
+func ListenLoopback(redirectURL string, ports []int) ([]net.Listener, string, error) {
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid redirect URL: %w", err)
+	}
+	hosts, err := loopbackHosts(u.Hostname())
+	if err != nil {
+		return nil, "", err
+	}
+	if len(ports) == 0 {
+		return nil, "", errors.New("no callback port configured")
+	}
+
+	var lastErr error
+	for _, port := range ports {
+		listeners, bound, err := listenAll(hosts, port)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(bound))
+		return listeners, u.String(), nil
+	}
+	return nil, "", fmt.Errorf("no callback port available: %w", lastErr)
+}
+
+// loopbackHosts はリダイレクトURLのホストから待ち受けるアドレスを決定する
+func loopbackHosts(host string) ([]string, error) {
+	if host == "localhost" {
+		return []string{"127.0.0.1", "::1"}, nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return []string{host}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrNonLoopbackRedirect, host)
+}
+
+// listenAll は全てのアドレスで同じポートを待ち受ける
+//
+// いずれかのアドレスでポートが使用中の場合は、ブラウザが別のプロセスに
+// リダイレクトされることを避けるため、そのポートを使わない。
+// 使用中以外の理由（IPv6が無効など）で待ち受けられないアドレスは読み飛ばす。
+func listenAll(hosts []string, port int) ([]net.Listener, int, error) {
+	var listeners []net.Listener
+	var lastErr error
+	for _, host := range hosts {
+		l, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			if errors.Is(err, syscall.EADDRINUSE) {
+				closeAll(listeners)
+				return nil, 0, err
+			}
+			lastErr = err
+			continue
+		}
+		if port == 0 {
+			port = l.Addr().(*net.TCPAddr).Port
+		}
+		listeners = append(listeners, l)
+	}
+	if len(listeners) == 0 {
+		return nil, 0, lastErr
+	}
+	return listeners, port, nil
+}
+
+func closeAll(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
@@ -0,0 +1,78 @@
+package http
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func closeListeners(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+func TestListenLoopback_BindsLoopbackOnly(t *testing.T) {
+	listeners, redirectURL, err := ListenLoopback("http://localhost:8080/callback", []int{0})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer closeListeners(listeners)
+
+	for _, l := range listeners {
+		ip := l.Addr().(*net.TCPAddr).IP
+		if !ip.IsLoopback() {
+			t.Errorf("expected loopback address, got %s", ip)
+		}
+	}
+
+	u, _ := url.Parse(redirectURL)
+	if u.Hostname() != "localhost" || u.Path != "/callback" {
+		t.Errorf("expected host and path to be kept, got %s", redirectURL)
+	}
+	if u.Port() != strconv.Itoa(listeners[0].Addr().(*net.TCPAddr).Port) {
+		t.Errorf("expected redirect URL to use the bound port, got %s", redirectURL)
+	}
+}
+
+func TestListenLoopback_FallsBackWhenPortInUse(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer busy.Close()
+	busyPort := busy.Addr().(*net.TCPAddr).Port
+
+	listeners, redirectURL, err := ListenLoopback("http://127.0.0.1/callback", []int{busyPort, 0})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer closeListeners(listeners)
+
+	u, _ := url.Parse(redirectURL)
+	if u.Port() == strconv.Itoa(busyPort) {
+		t.Errorf("expected a fallback port, got %s", redirectURL)
+	}
+}
+
+func TestListenLoopback_AllPortsInUse(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer busy.Close()
+
+	_, _, err = ListenLoopback("http://127.0.0.1/callback", []int{busy.Addr().(*net.TCPAddr).Port})
+	if err == nil {
+		t.Error("expected error when all ports are in use")
+	}
+}
+
+func TestListenLoopback_RejectsNonLoopbackHost(t *testing.T) {
+	_, _, err := ListenLoopback("https://example.com/callback", []int{0})
+	if !errors.Is(err, ErrNonLoopbackRedirect) {
+		t.Errorf("expected ErrNonLoopbackRedirect, got %v", err)
+	}
+}
@@ -13,7 +13,7 @@ import (
 // OAuthUseCaseInterface はHTTPハンドラが必要とするユースケースのインターフェース
 type OAuthUseCaseInterface interface {
 	GetOrRefreshToken(ctx context.Context) (*domain.Token, error)
-	StartAuthorization() (authURL string, state string)
+	StartAuthorization(ctx context.Context, req usecase.AuthorizationRequest) (authURL string, state string, err error)
 	CompleteAuthorization(ctx context.Context, code, state string) (*domain.Token, error)
 }
 
@@ -57,7 +57,7 @@ func (h *CallbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	token, err := h.useCase.CompleteAuthorization(r.Context(), code, state)
 	if err != nil {
 		h.errChan <- err
-		if errors.Is(err, usecase.ErrStateMismatch) {
+		if errors.Is(err, usecase.ErrStateMismatch) || errors.Is(err, usecase.ErrStateExpired) {
 			http.Error(w, "Invalid state parameter.", http.StatusBadRequest)
 			return
 		}
@@ -26,11 +26,12 @@ func (m *mockOAuthUseCase) GetOrRefreshToken(ctx context.Context) (*domain.Token
 	return nil, nil
 }
 
-func (m *mockOAuthUseCase) StartAuthorization() (string, string) {
+func (m *mockOAuthUseCase) StartAuthorization(ctx context.Context, req usecase.AuthorizationRequest) (string, string, error) {
 	if m.startAuth != nil {
-		return m.startAuth()
+		authURL, state := m.startAuth()
+		return authURL, state, nil
 	}
-	return "", ""
+	return "", "", nil
 }
 
 func (m *mockOAuthUseCase) CompleteAuthorization(ctx context.Context, code, state string) (*domain.Token, error) {
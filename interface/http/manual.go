@@ -0,0 +1,48 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// OOBRedirectURL はブラウザからのリダイレクトを受けられない環境向けのリダイレクトURI
+// freeeは認可後に認可コードを画面に表示する
+const OOBRedirectURL = "urn:ietf:wg:oauth:2.0:oob"
+
+// ParseAuthorizationResponse は手動で貼り付けられた認可レスポンスから認可コードとstateを取り出す
+//
+// 以下のいずれかの形式を受け付ける。認可コードだけが貼り付けられた場合、stateは空になる。
+//
+//   - リダイレクト先のURL全体（http://localhost:8080/callback?code=...&state=...）
+//   - クエリ文字列（code=...&state=...）
+//   - 認可コードのみ（out-of-bandリダイレクトで表示されたもの）
+func ParseAuthorizationResponse(input string) (code, state string, err error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", "", errors.New("no authorization code received")
+	}
+
+	query := input
+	if i := strings.IndexByte(input, '?'); i >= 0 {
+		query = input[i+1:]
+	} else if !strings.Contains(input, "=") {
+		return input, "", nil
+	}
+	query, _, _ = strings.Cut(query, "#")
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid redirect URL: %w", err)
+	}
+	if errParam := values.Get("error"); errParam != "" {
+		return "", "", fmt.Errorf("%s: %s", errParam, values.Get("error_description"))
+	}
+
+	code = values.Get("code")
+	if code == "" {
+		return "", "", errors.New("no authorization code received")
+	}
+	return code, values.Get("state"), nil
+}
@@ -0,0 +1,35 @@
+package http
+
+import "testing"
+
+func TestParseAuthorizationResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantCode  string
+		wantState string
+		wantErr   bool
+	}{
+		{"full URL", "http://localhost:8080/callback?code=abc&state=xyz\n", "abc", "xyz", false},
+		{"query only", "code=abc&state=xyz", "abc", "xyz", false},
+		{"bare code", "  abc123 \n", "abc123", "", false},
+		{"fragment ignored", "http://localhost/callback?code=abc&state=xyz#_", "abc", "xyz", false},
+		{"error response", "http://localhost/callback?error=access_denied&error_description=denied", "", "", true},
+		{"missing code", "http://localhost/callback?state=xyz", "", "", true},
+		{"empty", "\n", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, state, err := ParseAuthorizationResponse(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %t, got %v", tt.wantErr, err)
+			}
+			if code != tt.wantCode {
+				t.Errorf("expected code %q, got %q", tt.wantCode, code)
+			}
+			if state != tt.wantState {
+				t.Errorf("expected state %q, got %q", tt.wantState, state)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"freee-oauth-app/domain"
+)
+
+// プロキシが受け付けるリクエストボディの上限
+const maxProxyBodySize = 32 << 20
+
+// hopByHopHeaders はプロキシで転送しないヘッダ（RFC 9110 7.6.1）
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// TokenRefresher はプロキシが必要とするユースケースのインターフェース
+type TokenRefresher interface {
+	GetOrRefreshToken(ctx context.Context) (*domain.Token, error)
+	ForceRefresh(ctx context.Context) (*domain.Token, error)
+}
+
+// ProxyHandler はリクエストにAuthorizationヘッダを付与してfreee APIに転送するHTTPハンドラ
+//
+// freee APIが401を返した場合はトークンを強制的にリフレッシュし、1回だけ再送する。
+// DNSリバインディング対策として、Hostヘッダがループバック以外のリクエストは拒否する。
+// ブラウザ上の他サイトからのリクエスト（CSRF）にトークンを付与しないよう、
+// Origin ヘッダ付きのリクエストと Sec-Fetch-Site が cross-site/same-site のリクエストも拒否する。
+type ProxyHandler struct {
+	useCase  TokenRefresher
+	upstream *url.URL
+	client   *http.Client
+}
+
+// NewProxyHandler は新しいProxyHandlerを生成する
+// upstream には転送先のfreee APIのベースURLを指定する
+func NewProxyHandler(useCase TokenRefresher, upstream *url.URL, client *http.Client) *ProxyHandler {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &ProxyHandler{
+		useCase:  useCase,
+		upstream: upstream,
+		client:   client,
+	}
+}
+
+// ServeHTTP はHTTPリクエストを処理する
+func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isLoopbackHost(r.Host) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "proxy only accepts requests to localhost"})
+		return
+	}
+	if isBrowserCrossSite(r) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "proxy does not accept cross-origin requests"})
+		return
+	}
+
+	// 再送に備えてリクエストボディを読み込んでおく
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxProxyBodySize))
+	if err != nil {
+		writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx := r.Context()
+	token, err := h.useCase.GetOrRefreshToken(ctx)
+	if err != nil {
+		writeJSON(w, tokenErrorStatus(err), errorResponse{Error: err.Error()})
+		return
+	}
+
+	resp, err := h.forward(r, body, token)
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, errorResponse{Error: err.Error()})
+		return
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		if retried, err := h.retryWithFreshToken(r, body, token); err != nil {
+			log.Printf("Proxy: retry after 401 failed: %v", err)
+		} else {
+			resp.Body.Close()
+			resp = retried
+		}
+	}
+	defer resp.Body.Close()
+
+	copyHeader(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// retryWithFreshToken は新しいトークンでリクエストを再送する
+// 他のリクエストが既にリフレッシュしている場合はそのトークンを使い、リフレッシュしない
+func (h *ProxyHandler) retryWithFreshToken(r *http.Request, body []byte, used *domain.Token) (*http.Response, error) {
+	ctx := r.Context()
+	token, err := h.useCase.GetOrRefreshToken(ctx)
+	if err != nil || token.AccessToken == used.AccessToken {
+		if token, err = h.useCase.ForceRefresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return h.forward(r, body, token)
+}
+
+// forward はリクエストをfreee APIに転送する
+func (h *ProxyHandler) forward(r *http.Request, body []byte, token *domain.Token) (*http.Response, error) {
+	target := *h.upstream
+	target.Path = strings.TrimSuffix(h.upstream.Path, "/") + r.URL.Path
+	target.RawPath = ""
+	target.RawQuery = r.URL.RawQuery
+
+	out, err := http.NewRequestWithContext(r.Context(), r.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	copyHeader(out.Header, r.Header)
+	out.Header.Del("Cookie")
+	out.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	return h.client.Do(out)
+}
+
+// copyHeader はホップバイホップヘッダを除いてヘッダをコピーする
+func copyHeader(dst, src http.Header) {
+	for key, values := range src {
+		dst[key] = append([]string(nil), values...)
+	}
+	for _, key := range hopByHopHeaders {
+		dst.Del(key)
+	}
+}
+
+// isBrowserCrossSite はリクエストがブラウザ上の他のオリジンから送られたものかを判定する
+// ローカルのツール（curlなど）は Origin や Sec-Fetch-Site を送らない
+func isBrowserCrossSite(r *http.Request) bool {
+	if r.Header.Get("Origin") != "" {
+		return true
+	}
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "cross-site", "same-site":
+		return true
+	}
+	return false
+}
+
+// isLoopbackHost はHostヘッダがループバックを指しているかを判定する
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
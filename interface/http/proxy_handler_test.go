@@ -0,0 +1,182 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"freee-oauth-app/domain"
+)
+
+// モックTokenRefresher
+type mockTokenRefresher struct {
+	mu           sync.Mutex
+	token        *domain.Token
+	refreshed    *domain.Token
+	refreshCalls int
+}
+
+func (m *mockTokenRefresher) GetOrRefreshToken(ctx context.Context) (*domain.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.token, nil
+}
+
+func (m *mockTokenRefresher) ForceRefresh(ctx context.Context) (*domain.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refreshCalls++
+	m.token = m.refreshed
+	return m.token, nil
+}
+
+func newTestProxy(t *testing.T, refresher TokenRefresher, upstream http.HandlerFunc) *ProxyHandler {
+	t.Helper()
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+	u, _ := url.Parse(server.URL)
+	return NewProxyHandler(refresher, u, server.Client())
+}
+
+func TestProxyHandler_InjectsAuthorization(t *testing.T) {
+	refresher := &mockTokenRefresher{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	proxy := newTestProxy(t, refresher, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer access" {
+			t.Errorf("expected Bearer access, got %q", got)
+		}
+		if r.URL.Path != "/api/1/users/me" || r.URL.RawQuery != "companies=true" {
+			t.Errorf("unexpected upstream URL: %s", r.URL)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"a":1}` {
+			t.Errorf("unexpected body: %s", body)
+		}
+		w.Header().Set("X-Upstream", "ok")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "created")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:8788/api/1/users/me?companies=true", strings.NewReader(`{"a":1}`))
+	req.Header.Set("Authorization", "Bearer client-supplied")
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Errorf("expected status 201, got %d", rec.Code)
+	}
+	if rec.Header().Get("X-Upstream") != "ok" {
+		t.Error("expected upstream headers to be copied")
+	}
+	if rec.Body.String() != "created" {
+		t.Errorf("expected body 'created', got %q", rec.Body.String())
+	}
+}
+
+func TestProxyHandler_RetriesOnceAfterUnauthorized(t *testing.T) {
+	refresher := &mockTokenRefresher{
+		token:     domain.NewToken("stale", "refresh", time.Now().Add(time.Hour)),
+		refreshed: domain.NewToken("fresh", "refresh", time.Now().Add(time.Hour)),
+	}
+	var calls int
+	proxy := newTestProxy(t, refresher, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "payload" {
+			t.Errorf("expected body to be resent, got %q", body)
+		}
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, "ok")
+	})
+
+	req := httptest.NewRequest(http.MethodPut, "http://localhost/api/1/deals/1", strings.NewReader("payload"))
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", rec.Code)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 upstream calls, got %d", calls)
+	}
+	if refresher.refreshCalls != 1 {
+		t.Errorf("expected 1 forced refresh, got %d", refresher.refreshCalls)
+	}
+}
+
+func TestProxyHandler_DoesNotRetryTwice(t *testing.T) {
+	refresher := &mockTokenRefresher{
+		token:     domain.NewToken("stale", "refresh", time.Now().Add(time.Hour)),
+		refreshed: domain.NewToken("also-rejected", "refresh", time.Now().Add(time.Hour)),
+	}
+	var calls int
+	proxy := newTestProxy(t, refresher, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/api/1/users/me", nil)
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", rec.Code)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 upstream calls, got %d", calls)
+	}
+}
+
+func TestProxyHandler_RejectsNonLoopbackHost(t *testing.T) {
+	refresher := &mockTokenRefresher{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	proxy := newTestProxy(t, refresher, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request must not be forwarded")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "http://attacker.example/api/1/users/me", nil)
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d", rec.Code)
+	}
+}
+
+func TestProxyHandler_RejectsCrossOriginRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		value  string
+	}{
+		{"origin", "Origin", "https://attacker.example"},
+		{"null origin", "Origin", "null"},
+		{"cross-site", "Sec-Fetch-Site", "cross-site"},
+		{"same-site", "Sec-Fetch-Site", "same-site"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refresher := &mockTokenRefresher{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+			proxy := newTestProxy(t, refresher, func(w http.ResponseWriter, r *http.Request) {
+				t.Error("request must not be forwarded")
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "http://localhost:8788/api/1/deals", strings.NewReader("company_id=1"))
+			req.Header.Set(tt.header, tt.value)
+			rec := httptest.NewRecorder()
+			proxy.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("expected status 403, got %d", rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package http
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"freee-oauth-app/domain"
+	"freee-oauth-app/usecase"
+)
+
+// TokenProvider はトークンブローカーが必要とするユースケースのインターフェース
+type TokenProvider interface {
+	GetOrRefreshToken(ctx context.Context) (*domain.Token, error)
+}
+
+// expiryPolicyProvider は有効期限の判定方法を公開するユースケース
+// *usecase.OAuthUseCase が満たす
+type expiryPolicyProvider interface {
+	ExpiryPolicy() domain.ExpiryPolicy
+}
+
+// tokenResponse はトークンブローカーのレスポンス
+type tokenResponse struct {
+	AccessToken string   `json:"access_token"`
+	TokenType   string   `json:"token_type"`
+	Expiry      string   `json:"expiry"`
+	ExpiresIn   int64    `json:"expires_in"`
+	Scopes      []string `json:"scopes,omitempty"`
+	// CompanyID は既定の事業所のID（未選択の場合は省略）
+	CompanyID int64 `json:"company_id,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// TokenHandler は他のプロセスに有効なアクセストークンを返すHTTPハンドラ
+//
+// secret が設定されている場合は "Authorization: Bearer <secret>" を要求する。
+type TokenHandler struct {
+	useCase TokenProvider
+	secret  string
+	// expiry は expires_in の計算に使う（ユースケースと同じ時計を使う）
+	expiry domain.ExpiryPolicy
+}
+
+// NewTokenHandler は新しいTokenHandlerを生成する
+// secret が空の場合は認証を行わない（unixソケットでの待ち受けを想定）
+func NewTokenHandler(useCase TokenProvider, secret string) *TokenHandler {
+	h := &TokenHandler{
+		useCase: useCase,
+		secret:  secret,
+		expiry:  domain.DefaultExpiryPolicy,
+	}
+	if p, ok := useCase.(expiryPolicyProvider); ok {
+		h.expiry = p.ExpiryPolicy()
+	}
+	return h
+}
+
+// ServeHTTP はHTTPリクエストを処理する
+func (h *TokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="freee-oauth-app"`)
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+		return
+	}
+
+	token, err := h.useCase.GetOrRefreshToken(r.Context())
+	if err != nil {
+		writeJSON(w, tokenErrorStatus(err), errorResponse{Error: err.Error()})
+		return
+	}
+
+	resp := tokenResponse{
+		AccessToken: token.AccessToken,
+		TokenType:   token.TokenType,
+		Expiry:      token.Expiry.Format(time.RFC3339),
+		ExpiresIn:   int64(h.expiry.Remaining(token).Seconds()),
+		Scopes:      token.Scopes,
+	}
+	// トークンレスポンスに token_type がなかった（古いトークンファイルなど）場合はBearerとみなす
+	if resp.TokenType == "" {
+		resp.TokenType = "Bearer"
+	}
+	if token.DefaultCompany != nil {
+		resp.CompanyID = token.DefaultCompany.ID
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// authorized はリクエストのBearerシークレットを定数時間で比較する
+func (h *TokenHandler) authorized(r *http.Request) bool {
+	if h.secret == "" {
+		return true
+	}
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(h.secret)) == 1
+}
+
+// tokenErrorStatus はユースケースのエラーをHTTPステータスに変換する
+// freeeの一時的な障害によるリフレッシュ失敗は、再試行を促すため503とする
+func tokenErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrTransient):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, usecase.ErrRefreshFailed):
+		return http.StatusBadGateway
+	case errors.Is(err, usecase.ErrNoToken),
+		errors.Is(err, usecase.ErrNoRefreshToken),
+		errors.Is(err, usecase.ErrInsufficientScope):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
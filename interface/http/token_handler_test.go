@@ -0,0 +1,172 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"freee-oauth-app/domain"
+	"freee-oauth-app/usecase"
+)
+
+func TestTokenHandler_ReturnsToken(t *testing.T) {
+	token := domain.NewToken("access", "refresh", time.Now().Add(time.Hour))
+	token.Scopes = []string{"read"}
+	token.DefaultCompany = &domain.Company{ID: 12345}
+	mock := &mockOAuthUseCase{
+		getOrRefreshToken: func() (*domain.Token, error) { return token, nil },
+	}
+
+	handler := NewTokenHandler(mock, "")
+	req := httptest.NewRequest(http.MethodGet, "/token", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("expected Cache-Control no-store, got %q", cc)
+	}
+	var body tokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if body.AccessToken != "access" {
+		t.Errorf("expected access, got %s", body.AccessToken)
+	}
+	if body.TokenType != "Bearer" {
+		t.Errorf("expected Bearer, got %s", body.TokenType)
+	}
+	if body.ExpiresIn <= 0 {
+		t.Errorf("expected positive expires_in, got %d", body.ExpiresIn)
+	}
+	if len(body.Scopes) != 1 || body.Scopes[0] != "read" {
+		t.Errorf("expected scopes [read], got %v", body.Scopes)
+	}
+	if body.CompanyID != 12345 {
+		t.Errorf("expected company_id 12345, got %d", body.CompanyID)
+	}
+}
+
+func TestTokenHandler_ReturnsStoredTokenType(t *testing.T) {
+	token := domain.NewToken("access", "refresh", time.Now().Add(time.Hour))
+	token.TokenType = "bearer"
+	mock := &mockOAuthUseCase{
+		getOrRefreshToken: func() (*domain.Token, error) { return token, nil },
+	}
+
+	rec := httptest.NewRecorder()
+	NewTokenHandler(mock, "").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/token", nil))
+
+	var body tokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if body.TokenType != "bearer" {
+		t.Errorf("expected the stored token type, got %s", body.TokenType)
+	}
+}
+
+// clockedUseCase は注入された時計で有効期限を判定するユースケース
+type clockedUseCase struct {
+	*mockOAuthUseCase
+	policy domain.ExpiryPolicy
+}
+
+func (u clockedUseCase) ExpiryPolicy() domain.ExpiryPolicy { return u.policy }
+
+func TestTokenHandler_ExpiresInUsesUseCaseClock(t *testing.T) {
+	now := time.Now().Add(10 * time.Minute)
+	token := domain.NewToken("access", "refresh", now.Add(time.Hour))
+	useCase := clockedUseCase{
+		mockOAuthUseCase: &mockOAuthUseCase{getOrRefreshToken: func() (*domain.Token, error) { return token, nil }},
+		policy:           domain.ExpiryPolicy{Clock: domain.ClockFunc(func() time.Time { return now })},
+	}
+
+	rec := httptest.NewRecorder()
+	NewTokenHandler(useCase, "").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/token", nil))
+
+	var body tokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if body.ExpiresIn != 3600 {
+		t.Errorf("expected expires_in 3600 on the use case clock, got %d", body.ExpiresIn)
+	}
+}
+
+func TestTokenHandler_RequiresSecret(t *testing.T) {
+	mock := &mockOAuthUseCase{
+		getOrRefreshToken: func() (*domain.Token, error) {
+			return domain.NewToken("access", "refresh", time.Now().Add(time.Hour)), nil
+		},
+	}
+	handler := NewTokenHandler(mock, "s3cret")
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong", "Bearer nope", http.StatusUnauthorized},
+		{"wrong scheme", "Basic s3cret", http.StatusUnauthorized},
+		{"correct", "Bearer s3cret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/token", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestTokenHandler_MethodNotAllowed(t *testing.T) {
+	handler := NewTokenHandler(&mockOAuthUseCase{}, "")
+	req := httptest.NewRequest(http.MethodPost, "/token", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", rec.Code)
+	}
+}
+
+func TestTokenHandler_Errors(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+	}{
+		{usecase.ErrNoToken, http.StatusServiceUnavailable},
+		{usecase.ErrInsufficientScope, http.StatusServiceUnavailable},
+		{usecase.ErrRefreshFailed, http.StatusBadGateway},
+		{fmt.Errorf("%w: %w", usecase.ErrRefreshFailed, &domain.OAuthError{Op: "refresh", Code: domain.ErrorCodeInvalidGrant, StatusCode: http.StatusBadRequest}), http.StatusBadGateway},
+		{fmt.Errorf("%w: %w", usecase.ErrRefreshFailed, &domain.OAuthError{Op: "refresh", StatusCode: http.StatusServiceUnavailable}), http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			mock := &mockOAuthUseCase{
+				getOrRefreshToken: func() (*domain.Token, error) { return nil, tt.err },
+			}
+			req := httptest.NewRequest(http.MethodGet, "/token", nil)
+			rec := httptest.NewRecorder()
+			NewTokenHandler(mock, "").ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+}
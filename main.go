@@ -6,109 +6,404 @@
 //
 //	export FREEE_CLIENT_ID="your-client-id"
 //	export FREEE_CLIENT_SECRET="your-client-secret"
-//	go run main.go
+//	go run . [flags] [command]
+//
+// コマンド:
+//
+//	login          新しい認可フローを開始する
+//	status         保存されているトークンの状態を表示する（ネットワークにはアクセスしない）
+//	refresh        有効期限に関わらずトークンをリフレッシュする
+//	logout         トークンを無効化し、保存されているトークンを削除する
+//	token          アクセストークンをそのまま出力する（スクリプト用）
+//	serve          他のプロセスにアクセストークンを配布するブローカーを起動する
+//	proxy          Authorizationヘッダを付与してfreee APIに転送するプロキシを起動する
+//	daemon         有効期限の前にトークンをリフレッシュし続ける
+//	companies      アクセスできる事業所の一覧表示（list）・既定の事業所の選択（select）と出力（default）を行う
+//	profiles list  プロファイルの一覧を表示する
+//	config show    有効な設定をシークレットを伏せて表示する
+//
+// 設定は設定ファイル（$XDG_CONFIG_HOME/freee-oauth-app/config.toml）・環境変数・フラグの順に上書きされる
+//
+// コマンドを省略した場合は既存トークンを確認し、必要に応じてリフレッシュまたは認可フローを開始する
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"freee-oauth-app/domain"
+	"freee-oauth-app/infrastructure/browser"
+	configfile "freee-oauth-app/infrastructure/config"
 	"freee-oauth-app/infrastructure/freee"
+	"freee-oauth-app/infrastructure/freee/freeetest"
+	"freee-oauth-app/infrastructure/hook"
 	"freee-oauth-app/infrastructure/persistence"
+	"freee-oauth-app/infrastructure/retry"
 	httphandler "freee-oauth-app/interface/http"
 	"freee-oauth-app/usecase"
-)
 
-const (
-	callbackPort = "8080"
-	callbackPath = "/callback"
-	tokenFile    = "token.json"
+	"golang.org/x/oauth2"
 )
 
 func main() {
+	// グローバルフラグの解析
+	flags, args := parseGlobalFlags(os.Args[1:])
+
 	// 設定の読み込み
-	config := loadConfig()
+	config, err := loadConfig(flags, os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if requiresCredentials(args) {
+		if err := config.validate(); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	// 依存性の注入（DI）
-	app := initializeApp(config)
+	app, err := initializeApp(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
 
 	// アプリケーションの実行
-	if err := app.Run(); err != nil {
+	if err := app.Run(args); err != nil {
+		app.Close()
 		log.Fatalf("Application error: %v", err)
 	}
 }
 
-// Config はアプリケーション設定
-type Config struct {
-	ClientID     string
-	ClientSecret string
-	RedirectURL  string
-	TokenFile    string
+// App はアプリケーションのルートコンポーネント
+type App struct {
+	environment
+	config         *Config
+	oauthUseCase   *usecase.OAuthUseCase
+	profileUseCase *usecase.ProfileUseCase
+	companyUseCase *usecase.CompanyUseCase
+	tokenRepo      domain.TokenRepository
+	// fakeServer は --fake-server で起動した偽の認可サーバー
+	fakeServer *freeetest.Server
+	// hooks はライフサイクルイベントを通知する実行中のフック
+	hooks []*hook.Async
+
+	// stdinLines は標準入力を1行ずつ読み込むゴルーチンから行を受け取る（最初の readLine で開始する）
+	// 先読みした入力を失わないよう、標準入力は1つの bufio.Reader から読み込む
+	stdinOnce  sync.Once
+	stdinLines chan inputLine
 }
 
-func loadConfig() *Config {
-	clientID := os.Getenv("FREEE_CLIENT_ID")
-	clientSecret := os.Getenv("FREEE_CLIENT_SECRET")
+// inputLine は標準入力から読み込んだ1行または読み込みのエラー
+type inputLine struct {
+	text string
+	err  error
+}
 
-	if clientID == "" || clientSecret == "" {
-		log.Fatal("FREEE_CLIENT_ID and FREEE_CLIENT_SECRET must be set")
+// environment はアプリケーションが依存する外部環境
+// e2eテストでは出力先・時計・接続先を差し替え、偽の認可サーバーに対してコマンドを実行する
+type environment struct {
+	stdout io.Writer
+	// stderr は使い方や補足のメッセージの出力先（標準出力はスクリプトが読み取るため分ける）
+	stderr io.Writer
+	stdin  io.Reader
+	// now はトークンの有効期限の計算・判定に使う時計
+	// after は認可の待ち時間の計測に使う
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+	// listen はコールバックサーバーの待ち受けを開始し、実際に待ち受けたリダイレクトURLを返す
+	listen   func(redirectURL string, ports []int) ([]net.Listener, string, error)
+	endpoint endpoint
+	browser  browser.Opener
+}
+
+// endpoint はfreeeの認可サーバーとAPIのURL
+type endpoint struct {
+	authURL  string
+	tokenURL string
+	// revokeURL はトークン無効化エンドポイント
+	revokeURL string
+	// apiBaseURL は事業所の一覧の取得先と proxy コマンドの既定の転送先
+	apiBaseURL string
+}
+
+// defaultEnvironment は本物のfreeeとプロセスの標準入出力を使う環境を返す
+func defaultEnvironment() environment {
+	return environment{
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		stdin:  os.Stdin,
+		now:    time.Now,
+		after:  time.After,
+		listen: httphandler.ListenLoopback,
+		endpoint: endpoint{
+			authURL:    freee.AuthURL,
+			tokenURL:   freee.TokenURL,
+			revokeURL:  freee.RevokeURL,
+			apiBaseURL: freee.APIBaseURL,
+		},
+		browser: browser.NewSystemOpener(),
 	}
+}
 
-	return &Config{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		RedirectURL:  fmt.Sprintf("http://localhost:%s%s", callbackPort, callbackPath),
-		TokenFile:    tokenFile,
+// fakeServerEndpoint は偽の認可サーバーのURLを返す
+func fakeServerEndpoint(server *freeetest.Server) endpoint {
+	return endpoint{
+		authURL:    server.AuthURL(),
+		tokenURL:   server.TokenURL(),
+		revokeURL:  server.RevokeURL(),
+		apiBaseURL: server.URL,
 	}
 }
 
-// App はアプリケーションのルートコンポーネント
-type App struct {
-	oauthUseCase *usecase.OAuthUseCase
-	tokenRepo    domain.TokenRepository
+// initializeApp は設定に従って外部環境を決定し、アプリケーションを構築する
+func initializeApp(config *Config) (*App, error) {
+	env := defaultEnvironment()
+	if !config.FakeServer {
+		return newApp(config, env)
+	}
+
+	// 偽の認可サーバーに接続し、認可URLはブラウザの代わりにサーバー自身が承認する
+	// 発行済みのトークンをトークンファイルの隣に保存し、次回の起動でもリフレッシュできるようにする
+	fakeServer, err := freeetest.NewServer(freeetest.Options{
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		StateFile:    strings.TrimSuffix(config.TokenFile, ".json") + ".server.json",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start fake authorization server: %w", err)
+	}
+	fmt.Fprintf(env.stderr, "Using fake freee authorization server at %s\n", fakeServer.URL)
+	env.endpoint = fakeServerEndpoint(fakeServer)
+	env.browser = fakeServer
+
+	app, err := newApp(config, env)
+	if err != nil {
+		fakeServer.Close()
+		return nil, err
+	}
+	app.fakeServer = fakeServer
+	return app, nil
 }
 
-func initializeApp(config *Config) *App {
+// newApp は外部環境を注入してアプリケーションを構築する
+func newApp(config *Config, env environment) (*App, error) {
 	// Infrastructure層の初期化
-	tokenRepo := persistence.NewFileTokenRepository(config.TokenFile)
-	oauthProvider := freee.NewFreeeOAuthProvider(
+	tokenRepo, err := newTokenRepository(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize token repository: %w", err)
+	}
+	// 有効期限の計算と判定に同じ時計を使う
+	clock := domain.ClockFunc(env.now)
+	freeeProvider := freee.NewFreeeOAuthProviderWithEndpoint(
 		config.ClientID,
 		config.ClientSecret,
 		config.RedirectURL,
-	)
+		config.Scopes,
+		env.endpoint.authURL,
+		env.endpoint.tokenURL,
+		env.endpoint.revokeURL,
+	).WithClock(clock)
+	// トークンエンドポイントの一時的な障害は再試行し、再認可を強いないようにする
+	oauthProvider := retry.NewProvider(freeeProvider, config.retryPolicy())
+	profileRepo := configfile.NewProfileRepository(config.file)
 
 	// UseCase層の初期化
-	oauthUseCase := usecase.NewOAuthUseCase(tokenRepo, oauthProvider)
+	oauthUseCase := usecase.NewOAuthUseCase(tokenRepo, oauthProvider, newStateStore(config, clock),
+		usecase.WithClock(clock),
+		usecase.WithExpiryBuffer(config.ExpiryBuffer),
+		usecase.WithProfile(config.ProfileName),
+	)
+	hooks := subscribeHooks(oauthUseCase, config)
+	profileUseCase := usecase.NewProfileUseCase(profileRepo, func(profile *domain.Profile) (domain.TokenRepository, error) {
+		config.applyProfileDefaults(profile)
+		profileConfig := *config
+		profileConfig.TokenFile = profile.TokenFile
+		return newTokenRepository(&profileConfig)
+	})
+
+	companyUseCase := usecase.NewCompanyUseCase(oauthUseCase, freee.NewCompanyDirectory(env.endpoint.apiBaseURL))
 
 	return &App{
-		oauthUseCase: oauthUseCase,
-		tokenRepo:    tokenRepo,
+		environment:    env,
+		config:         config,
+		oauthUseCase:   oauthUseCase,
+		profileUseCase: profileUseCase,
+		companyUseCase: companyUseCase,
+		tokenRepo:      tokenRepo,
+		hooks:          hooks,
+	}, nil
+}
+
+// Close はアプリケーションが起動したリソースを解放する
+// 実行中のフックの完了を待ってから終了する
+func (app *App) Close() {
+	for _, h := range app.hooks {
+		h.Close()
+	}
+	if app.fakeServer != nil {
+		app.fakeServer.Close()
+	}
+}
+
+// subscribeHooks は設定されたexecフック・webhookにトークンのライフサイクルイベントを通知する
+// フックの失敗はログに出力するだけで、トークンの取得・リフレッシュは失敗させない。
+// フックは別のゴルーチンで実行するため、終了前に返した Async を Close して処理を待つ。
+func subscribeHooks(uc *usecase.OAuthUseCase, config *Config) []*hook.Async {
+	var handlers []hook.Handler
+	if config.HookExec != "" {
+		handlers = append(handlers, hook.NewExecHook(config.HookExec, config.ProfileName, defaultHookTimeout))
+	}
+	if config.HookWebhook != "" {
+		handlers = append(handlers, hook.NewWebhook(config.HookWebhook, config.ProfileName, &http.Client{Timeout: defaultHookTimeout}))
+	}
+	hooks := make([]*hook.Async, 0, len(handlers))
+	for _, h := range handlers {
+		async := hook.NewAsync(h, func(event domain.Event, err error) {
+			log.Printf("Hook for %s failed: %v", event.Type, err)
+		})
+		uc.Subscribe(func(ctx context.Context, event domain.Event) {
+			if err := async.Handle(ctx, event); err != nil {
+				log.Printf("Hook for %s failed: %v", event.Type, err)
+			}
+		})
+		hooks = append(hooks, async)
+	}
+	return hooks
+}
+
+// newTokenRepository は設定に応じて平文または暗号化のトークンリポジトリを生成する
+// バックエンドが指定されていない場合は鍵の有無で選択する
+func newTokenRepository(config *Config) (domain.TokenRepository, error) {
+	key, err := tokenKey(config.TokenPassphrase, config.TokenKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if config.TokenStore == tokenStoreFile || (config.TokenStore == "" && key == nil) {
+		return persistence.NewFileTokenRepository(config.TokenFile), nil
+	}
+	if key == nil {
+		return nil, errors.New("encrypted token store requires FREEE_TOKEN_KEY_FILE or FREEE_TOKEN_PASSPHRASE")
+	}
+
+	var previousKeys []persistence.TokenKey
+	previousKey, err := tokenKey(config.PreviousTokenPassphrase, config.PreviousTokenKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if previousKey != nil {
+		previousKeys = append(previousKeys, *previousKey)
+	}
+
+	return persistence.NewEncryptedFileTokenRepository(config.TokenFile, *key, previousKeys...), nil
+}
+
+// newStateStore は開始済みの認可リクエストのストアを生成する
+// state_file が設定されている場合は複数のプロセスで共有できるファイルに保存する
+// 認可リクエストの有効期限は認可の待ち時間と同じ
+func newStateStore(config *Config, clock domain.Clock) domain.StateStore {
+	if config.StateFile != "" {
+		return persistence.NewFileStateStore(config.StateFile, config.AuthTimeout, persistence.WithStateClock(clock))
+	}
+	return persistence.NewMemoryStateStore(config.AuthTimeout, persistence.WithStateClock(clock))
+}
+
+// tokenKey は鍵ファイルまたはパスフレーズから暗号鍵を生成する（鍵ファイルを優先）
+// どちらも指定されていない場合はnilを返す
+func tokenKey(passphrase, keyFile string) (*persistence.TokenKey, error) {
+	var key persistence.TokenKey
+	var err error
+	switch {
+	case keyFile != "":
+		key, err = persistence.NewKeyFileKey(keyFile)
+	case passphrase != "":
+		key, err = persistence.NewPassphraseKey(passphrase)
+	default:
+		return nil, nil
 	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
 }
 
-// Run はアプリケーションを実行する
-func (app *App) Run() error {
-	ctx := context.Background()
+// Run は引数で指定されたサブコマンドを実行する
+func (app *App) Run(args []string) error {
+	// トークンエンドポイントへのリクエストにタイムアウトを設定する
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{
+		Timeout: app.config.HTTPTimeout,
+	})
+
+	if len(args) == 0 {
+		return app.runDefault(ctx)
+	}
+
+	switch args[0] {
+	case "login":
+		return app.startOAuthFlow(ctx)
+	case "status":
+		return app.runStatus(ctx)
+	case "refresh":
+		return app.runRefresh(ctx)
+	case "logout":
+		return app.runLogout(ctx)
+	case "token":
+		return app.runToken(ctx)
+	case "serve":
+		return app.runServe(ctx, args[1:])
+	case "proxy":
+		return app.runProxy(ctx, args[1:])
+	case "daemon":
+		return app.runDaemon(ctx, args[1:])
+	case "profiles":
+		return app.runProfiles(ctx, args[1:])
+	case "companies":
+		return app.runCompanies(ctx, args[1:])
+	case "config":
+		return app.runConfig(args[1:])
+	case "help", "-h", "--help":
+		printUsage(app.stdout)
+		return nil
+	default:
+		printUsage(app.stderr)
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+}
 
+// runDefault は既存トークンを確認し、必要に応じてリフレッシュまたは認可フローを開始する
+func (app *App) runDefault(ctx context.Context) error {
 	// 既存のトークンを確認
 	token, err := app.oauthUseCase.GetOrRefreshToken(ctx)
 	if err == nil {
-		fmt.Printf("Loaded existing valid token\n")
-		fmt.Printf("  Access Token: %s\n", token.MaskedAccessToken())
-		fmt.Printf("  Expires: %s\n", token.Expiry.Format(time.RFC3339))
-		fmt.Println("\nToken is ready for API requests.")
+		fmt.Fprintf(app.stdout, "Loaded existing valid token\n")
+		fmt.Fprintf(app.stdout, "  Access Token: %s\n", token.MaskedAccessToken())
+		fmt.Fprintf(app.stdout, "  Expires: %s\n", token.Expiry.Format(time.RFC3339))
+		fmt.Fprintln(app.stdout, "\nToken is ready for API requests.")
+		app.warnRefreshTokenExpiry(token)
 		return nil
 	}
 
-	if err == usecase.ErrRefreshFailed {
-		fmt.Println("Token refresh failed. Starting new OAuth2 flow...")
-	} else {
-		fmt.Println("No existing token. Starting OAuth2 flow...")
+	switch {
+	case errors.Is(err, domain.ErrTransient), errors.Is(err, domain.ErrInvalidClient):
+		// 再認可しても解決しないため、ブラウザを開かずに終了する
+		return explainAuthError(err, "token refresh failed")
+	case errors.Is(err, domain.ErrInvalidGrant):
+		fmt.Fprintln(app.stdout, "Refresh token has been revoked or expired. Starting new OAuth2 flow...")
+	case errors.Is(err, usecase.ErrRefreshFailed):
+		fmt.Fprintf(app.stdout, "Token refresh failed (%v). Starting new OAuth2 flow...\n", err)
+	case errors.Is(err, usecase.ErrInsufficientScope):
+		fmt.Fprintln(app.stdout, "Stored token lacks required scopes. Starting new OAuth2 flow...")
+	default:
+		fmt.Fprintln(app.stdout, "No existing token. Starting OAuth2 flow...")
 	}
 
 	// 新規OAuth認可フローの開始
@@ -116,8 +411,25 @@ func (app *App) Run() error {
 }
 
 func (app *App) startOAuthFlow(ctx context.Context) error {
-	// 認可フローの開始
-	authURL, _ := app.oauthUseCase.StartAuthorization()
+	// ブラウザからのリダイレクトを受けられない環境では認可レスポンスを手動で入力する
+	if app.config.Headless || app.config.RedirectURL == httphandler.OOBRedirectURL {
+		return app.startManualFlow(ctx)
+	}
+
+	// コールバックサーバーをループバックアドレスで待ち受ける
+	listeners, redirectURL, err := app.listen(app.config.RedirectURL, app.config.callbackPorts())
+	if err != nil {
+		return fmt.Errorf("failed to start callback server: %w", err)
+	}
+
+	// 認可フローの開始（実際に待ち受けたポートをリダイレクトURLに反映する）
+	authURL, _, err := app.oauthUseCase.StartAuthorization(ctx, usecase.AuthorizationRequest{
+		RedirectURL: redirectURL,
+	})
+	if err != nil {
+		closeListeners(listeners)
+		return fmt.Errorf("failed to start authorization: %w", err)
+	}
 
 	// コールバック用チャネル
 	tokenChan := make(chan *domain.Token, 1)
@@ -125,49 +437,153 @@ func (app *App) startOAuthFlow(ctx context.Context) error {
 
 	// HTTPサーバーの起動
 	handler := httphandler.NewCallbackHandler(app.oauthUseCase, tokenChan, errChan)
-	server := &http.Server{
-		Addr:    ":" + callbackPort,
-		Handler: handler,
-	}
+	server := &http.Server{Handler: handler}
 
-	go func() {
-		if err := server.ListenAndServe(); err != http.ErrServerClosed {
-			log.Printf("Server error: %v", err)
-		}
-	}()
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			if err := server.Serve(listener); err != http.ErrServerClosed {
+				log.Printf("Server error: %v", err)
+			}
+		}(listener)
+	}
+	if redirectURL != app.config.RedirectURL {
+		fmt.Fprintf(app.stdout, "Callback server is listening on %s\n", redirectURL)
+	}
 
 	// 認可URLの表示
-	fmt.Println("Visit this URL to authorize the application:")
-	fmt.Printf("\n%s\n\n", authURL)
-	fmt.Println("Waiting for authorization...")
+	app.presentAuthorizationURL(authURL)
+	fmt.Fprintln(app.stdout, "Waiting for authorization...")
 
 	// コールバック待機
 	var token *domain.Token
 	select {
 	case token = <-tokenChan:
-		fmt.Println("\nAuthorization successful!")
+		fmt.Fprintln(app.stdout, "\nAuthorization successful!")
 	case err := <-errChan:
 		shutdownServer(server)
 		return fmt.Errorf("authorization failed: %w", err)
-	case <-time.After(5 * time.Minute):
+	case <-app.after(app.config.AuthTimeout):
 		shutdownServer(server)
-		return fmt.Errorf("authorization timeout (5 minutes)")
+		return fmt.Errorf("authorization timeout (%s)", app.config.AuthTimeout)
 	}
 
 	// サーバーのシャットダウン
 	shutdownServer(server)
 
-	// 結果の表示
-	fmt.Printf("\nAccess token obtained successfully\n")
-	fmt.Printf("  Access Token: %s\n", token.MaskedAccessToken())
-	fmt.Printf("  Expires: %s\n", token.Expiry.Format(time.RFC3339))
+	app.printObtainedToken(token)
+	return app.chooseDefaultCompany(ctx, token)
+}
+
+// presentAuthorizationURL は認可URLを表示し、可能であればブラウザで開く
+// ブラウザを開けない場合は表示したURLを手動で開くよう案内する
+func (app *App) presentAuthorizationURL(authURL string) {
+	fmt.Fprintln(app.stdout, "Visit this URL to authorize the application:")
+	fmt.Fprintf(app.stdout, "\n%s\n\n", authURL)
+	if app.config.NoBrowser || app.browser == nil {
+		return
+	}
+	if err := app.browser.Open(authURL); err != nil {
+		fmt.Fprintf(app.stdout, "Could not open a browser (%v). Open the URL above manually.\n", err)
+		return
+	}
+	fmt.Fprintln(app.stdout, "Opened the URL in your browser.")
+}
+
+// startManualFlow はコールバックサーバーを起動せずに認可フローを実行する
+//
+// out-of-bandリダイレクトの場合は画面に表示された認可コードを、
+// それ以外の場合はブラウザのアドレスバーに表示されたリダイレクト先のURLを標準入力から読み込む。
+func (app *App) startManualFlow(ctx context.Context) error {
+	authURL, state, err := app.oauthUseCase.StartAuthorization(ctx, usecase.AuthorizationRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to start authorization: %w", err)
+	}
+
+	fmt.Fprintln(app.stdout, "Visit this URL to authorize the application:")
+	fmt.Fprintf(app.stdout, "\n%s\n\n", authURL)
+	if app.config.RedirectURL == httphandler.OOBRedirectURL {
+		fmt.Fprint(app.stdout, "Paste the authorization code shown by freee: ")
+	} else {
+		fmt.Fprintln(app.stdout, "After authorizing, your browser is redirected to a page that may fail to load.")
+		fmt.Fprint(app.stdout, "Paste the full URL from the address bar: ")
+	}
+
+	input, err := app.readLine()
+	if err != nil {
+		return fmt.Errorf("authorization failed: %w", err)
+	}
+	code, returnedState, err := httphandler.ParseAuthorizationResponse(input)
+	if err != nil {
+		return fmt.Errorf("authorization failed: %w", err)
+	}
+	if returnedState == "" {
+		// 認可コードだけが入力された場合は、利用者が直接入力したものとして扱う
+		returnedState = state
+	}
+
+	token, err := app.oauthUseCase.CompleteAuthorization(ctx, code, returnedState)
+	if err != nil {
+		return fmt.Errorf("authorization failed: %w", err)
+	}
+	fmt.Fprintln(app.stdout, "\nAuthorization successful!")
+
+	app.printObtainedToken(token)
+	return app.chooseDefaultCompany(ctx, token)
+}
+
+// readLine は標準入力から1行を読み込む。認可の待ち時間を過ぎた場合はエラーを返す
+// 待ち時間を過ぎた後に入力された行は、次の readLine で返す
+func (app *App) readLine() (string, error) {
+	app.stdinOnce.Do(func() {
+		app.stdinLines = make(chan inputLine)
+		go app.readStdin()
+	})
+
+	select {
+	case line, ok := <-app.stdinLines:
+		if !ok {
+			return "", io.EOF
+		}
+		return line.text, line.err
+	case <-app.after(app.config.AuthTimeout):
+		return "", fmt.Errorf("authorization timeout (%s)", app.config.AuthTimeout)
+	}
+}
+
+// readStdin は標準入力を1行ずつ読み込んで stdinLines に送る
+// 読み込みに失敗した場合はエラーを送ってチャネルを閉じる
+func (app *App) readStdin() {
+	defer close(app.stdinLines)
+	reader := bufio.NewReader(app.stdin)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			app.stdinLines <- inputLine{err: err}
+			return
+		}
+		app.stdinLines <- inputLine{text: line}
+	}
+}
+
+// printObtainedToken は取得したトークンの情報を表示する
+func (app *App) printObtainedToken(token *domain.Token) {
+	fmt.Fprintf(app.stdout, "\nAccess token obtained successfully\n")
+	fmt.Fprintf(app.stdout, "  Access Token: %s\n", token.MaskedAccessToken())
+	fmt.Fprintf(app.stdout, "  Expires: %s\n", token.Expiry.Format(time.RFC3339))
 	if token.HasRefreshToken() {
-		fmt.Printf("  Refresh Token: (available)\n")
+		fmt.Fprintf(app.stdout, "  Refresh Token: (available)\n")
 	}
-	fmt.Printf("\nToken saved to %s\n", tokenFile)
-	fmt.Println("\nYou can now use this token to make API requests.")
+	if len(token.Scopes) > 0 {
+		fmt.Fprintf(app.stdout, "  Scopes: %s\n", strings.Join(token.Scopes, " "))
+	}
+	fmt.Fprintf(app.stdout, "\nToken saved to %s\n", app.config.TokenFile)
+	fmt.Fprintln(app.stdout, "\nYou can now use this token to make API requests.")
+}
 
-	return nil
+func closeListeners(listeners []net.Listener) {
+	for _, listener := range listeners {
+		listener.Close()
+	}
 }
 
 func shutdownServer(server *http.Server) {
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	httphandler "freee-oauth-app/interface/http"
+)
+
+// 認証プロキシのデフォルトの待ち受けアドレス
+const defaultProxyAddr = "127.0.0.1:8788"
+
+// proxyOptions は proxy コマンドのオプション
+type proxyOptions struct {
+	addr     string
+	socket   string
+	upstream string
+}
+
+// parseProxyFlags は proxy コマンドのフラグを解析する
+// 各フラグのデフォルトは環境変数から取得する
+func parseProxyFlags(args []string, defaultUpstream string, getenv func(string) string) (*proxyOptions, error) {
+	opts := &proxyOptions{}
+	fs := flag.NewFlagSet("proxy", flag.ContinueOnError)
+	fs.StringVar(&opts.addr, "listen", envOr(getenv, "FREEE_PROXY_ADDR", defaultProxyAddr), "loopback address to listen on (env: FREEE_PROXY_ADDR)")
+	fs.StringVar(&opts.socket, "socket", getenv("FREEE_PROXY_SOCKET"), "unix socket path; overrides --listen (env: FREEE_PROXY_SOCKET)")
+	fs.StringVar(&opts.upstream, "upstream", envOr(getenv, "FREEE_API_URL", defaultUpstream), "freee API base URL (env: FREEE_API_URL)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	return opts, nil
+}
+
+// runProxy はfreee APIへの認証プロキシを起動する
+//
+// ローカルのツールが認証なしで送ったリクエストにAuthorizationヘッダを付与して
+// freee APIに転送する。401が返った場合はトークンを強制的にリフレッシュして1回だけ再送する。
+func (app *App) runProxy(ctx context.Context, args []string) error {
+	opts, err := parseProxyFlags(args, app.endpoint.apiBaseURL, app.config.getenv)
+	if err != nil {
+		return err
+	}
+	upstream, err := url.Parse(opts.upstream)
+	if err != nil || upstream.Scheme == "" || upstream.Host == "" {
+		return fmt.Errorf("invalid upstream URL %q", opts.upstream)
+	}
+
+	// 起動時にトークンを確認し、未ログインなら早期に失敗する
+	if _, err := app.oauthUseCase.GetOrRefreshToken(ctx); err != nil {
+		return fmt.Errorf("no valid token (run 'login' first): %w", err)
+	}
+
+	var listener net.Listener
+	if opts.socket != "" {
+		listener, err = listenUnix(opts.socket)
+	} else if err = requireLoopback(opts.addr); err == nil {
+		listener, err = net.Listen("tcp", opts.addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.socket != "" {
+		fmt.Fprintf(app.stdout, "Proxying %s on unix socket %s\n", upstream, opts.socket)
+		fmt.Fprintf(app.stdout, "  curl --unix-socket %s http://localhost/api/1/users/me\n", opts.socket)
+	} else {
+		fmt.Fprintf(app.stdout, "Proxying %s on http://%s\n", upstream, listener.Addr())
+		fmt.Fprintf(app.stdout, "  curl http://%s/api/1/users/me\n", listener.Addr())
+	}
+
+	client := &http.Client{Timeout: app.config.HTTPTimeout}
+	handler := httphandler.NewProxyHandler(app.oauthUseCase, upstream, client)
+	if err := serveUntilSignal(ctx, listener, handler); err != nil {
+		return err
+	}
+	log.Println("Proxy stopped")
+	return nil
+}
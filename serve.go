@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	httphandler "freee-oauth-app/interface/http"
+)
+
+// トークンブローカーのデフォルト値
+const (
+	defaultServeAddr       = "127.0.0.1:8787"
+	defaultServeSecretFile = "serve.secret"
+)
+
+// serveOptions は serve コマンドのオプション
+type serveOptions struct {
+	addr       string
+	socket     string
+	secretFile string
+	// secret は環境変数 FREEE_SERVE_SECRET で指定されたBearerシークレット
+	secret string
+}
+
+// parseServeFlags は serve コマンドのフラグを解析する
+// 各フラグのデフォルトは環境変数から取得する
+func parseServeFlags(args []string, tokenFile string, getenv func(string) string) (*serveOptions, error) {
+	opts := &serveOptions{secret: getenv("FREEE_SERVE_SECRET")}
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.StringVar(&opts.addr, "listen", envOr(getenv, "FREEE_SERVE_ADDR", defaultServeAddr), "loopback address to listen on (env: FREEE_SERVE_ADDR)")
+	fs.StringVar(&opts.socket, "socket", getenv("FREEE_SERVE_SOCKET"), "unix socket path; overrides --listen (env: FREEE_SERVE_SOCKET)")
+	fs.StringVar(&opts.secretFile, "secret-file", envOr(getenv, "FREEE_SERVE_SECRET_FILE", filepath.Join(filepath.Dir(tokenFile), defaultServeSecretFile)), "bearer secret file for --listen (env: FREEE_SERVE_SECRET_FILE)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	return opts, nil
+}
+
+// runServe はアクセストークンを他のプロセスに配布するブローカーを起動する
+//
+// unixソケット（パーミッション0600）またはループバックアドレスで待ち受け、
+// GET /token に対して必要に応じてリフレッシュした有効なアクセストークンを返す。
+// ループバックで待ち受ける場合はBearerシークレットを要求する。
+func (app *App) runServe(ctx context.Context, args []string) error {
+	opts, err := parseServeFlags(args, app.config.TokenFile, app.config.getenv)
+	if err != nil {
+		return err
+	}
+
+	// 起動時にトークンを確認し、未ログインなら早期に失敗する
+	if _, err := app.oauthUseCase.GetOrRefreshToken(ctx); err != nil {
+		return fmt.Errorf("no valid token (run 'login' first): %w", err)
+	}
+
+	listener, secret, err := opts.listen()
+	if err != nil {
+		return err
+	}
+
+	if opts.socket != "" {
+		fmt.Fprintf(app.stdout, "Serving tokens on unix socket %s\n", opts.socket)
+		fmt.Fprintf(app.stdout, "  curl --unix-socket %s http://localhost/token\n", opts.socket)
+	} else {
+		fmt.Fprintf(app.stdout, "Serving tokens on http://%s/token\n", listener.Addr())
+		fmt.Fprintf(app.stdout, "  curl -H \"Authorization: Bearer $(cat %s)\" http://%s/token\n", opts.secretFile, listener.Addr())
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/token", httphandler.NewTokenHandler(app.oauthUseCase, secret))
+	if err := serveUntilSignal(ctx, listener, mux); err != nil {
+		return err
+	}
+	log.Println("Token broker stopped")
+	return nil
+}
+
+// serveUntilSignal はSIGINT/SIGTERMを受け取るまでHTTPサーバーを実行する
+func serveUntilSignal(ctx context.Context, listener net.Listener, handler http.Handler) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{
+		Handler: handler,
+		// ハンドラからのリフレッシュにもHTTPクライアントの設定を引き継ぐ
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownServer(server)
+	}()
+
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// listen はオプションに応じてunixソケットまたはループバックで待ち受ける
+// ループバックの場合はクライアントが提示するBearerシークレットも返す
+func (opts *serveOptions) listen() (net.Listener, string, error) {
+	if opts.socket != "" {
+		listener, err := listenUnix(opts.socket)
+		return listener, "", err
+	}
+
+	if err := requireLoopback(opts.addr); err != nil {
+		return nil, "", err
+	}
+	secret, err := loadOrCreateSecret(opts.secret, opts.secretFile)
+	if err != nil {
+		return nil, "", err
+	}
+	listener, err := net.Listen("tcp", opts.addr)
+	if err != nil {
+		return nil, "", err
+	}
+	return listener, secret, nil
+}
+
+// listenUnix は所有者のみがアクセスできるunixソケットで待ち受ける
+//
+// 他のプロセスが待ち受けているソケットは置き換えずにエラーを返し、
+// 前回の異常終了で残った（接続できない）ソケットファイルだけを削除する。
+// 作成直後から他のユーザーが接続できないよう、umaskを制限してソケットを作成する。
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	var listener net.Listener
+	err := withUmask(0177, func() (err error) {
+		listener, err = net.Listen("unix", path)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// umaskのない環境向けに、パーミッションを明示的にも設定する
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// requireLoopback は待ち受けアドレスがループバックであることを確認する
+func requireLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("refusing to listen on non-loopback address %q", addr)
+}
+
+// loadOrCreateSecret はBearerシークレットを読み込む
+// 指定されたシークレット（環境変数 FREEE_SERVE_SECRET）が優先され、ファイルがない場合は生成して0600で保存する
+func loadOrCreateSecret(secret, path string) (string, error) {
+	if secret != "" {
+		return secret, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if secret := strings.TrimSpace(string(data)); secret != "" {
+			return secret, nil
+		}
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	secret = base64.RawURLEncoding.EncodeToString(b)
+	if err := os.WriteFile(path, []byte(secret+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// envOr は環境変数の値を返し、未設定の場合はデフォルト値を返す
+func envOr(getenv func(string) string, name, fallback string) string {
+	if v := getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
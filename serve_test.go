@@ -0,0 +1,67 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListenUnix_OwnerOnlyPermissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "freee.sock")
+
+	listener, err := listenUnix(path)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("expected socket permissions 0600, got %o", perm)
+	}
+}
+
+func TestListenUnix_RefusesLiveSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "freee.sock")
+	running, err := listenUnix(path)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer running.Close()
+
+	_, err = listenUnix(path)
+
+	if err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("expected a live socket to be refused, got %v", err)
+	}
+	// 稼働中のブローカーのソケットは残っている
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("expected the running broker to stay reachable: %v", err)
+	}
+	conn.Close()
+}
+
+func TestListenUnix_ReplacesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "freee.sock")
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	// 異常終了を模して、ソケットファイルを残したまま閉じる
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := listenUnix(path)
+	if err != nil {
+		t.Fatalf("expected a stale socket to be replaced, got %v", err)
+	}
+	listener.Close()
+}
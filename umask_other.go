@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// withUmask はumaskのない環境では fn をそのまま実行する
+func withUmask(mask int, fn func() error) error {
+	return fn()
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// withUmask は umask を mask に変更して fn を実行し、元に戻す
+// unixソケットなど、作成時のパーミッションを指定できないファイルを作成するのに使う
+func withUmask(mask int, fn func() error) error {
+	old := syscall.Umask(mask)
+	defer syscall.Umask(old)
+	return fn()
+}
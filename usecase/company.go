@@ -0,0 +1,84 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+
+	"freee-oauth-app/domain"
+)
+
+// ErrNoDefaultCompany は既定の事業所が選択されていないことを表す
+var ErrNoDefaultCompany = errors.New("no default company selected")
+
+// CompanyUseCase は既定の事業所の選択のユースケースを提供する
+//
+// freeeのトークンはユーザーごとに発行されるが、APIの呼び出しには事業所のIDが必要になる。
+// ユーザーがアクセスできる事業所から既定の事業所を選び、トークンと共に保存する。
+type CompanyUseCase struct {
+	oauth     *OAuthUseCase
+	directory domain.CompanyDirectory
+}
+
+// NewCompanyUseCase は新しいCompanyUseCaseを生成する
+func NewCompanyUseCase(oauth *OAuthUseCase, directory domain.CompanyDirectory) *CompanyUseCase {
+	return &CompanyUseCase{
+		oauth:     oauth,
+		directory: directory,
+	}
+}
+
+// ListCompanies は有効なトークンのユーザーがアクセスできる事業所を返す
+// トークンの有効期限が近い場合はリフレッシュしてから取得する
+func (uc *CompanyUseCase) ListCompanies(ctx context.Context) ([]domain.Company, error) {
+	token, err := uc.oauth.GetOrRefreshToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return uc.directory.Companies(ctx, token)
+}
+
+// SelectDefault は companies のうち id の事業所を既定の事業所として保存する
+// companies にない事業所は domain.ErrCompanyNotFound を返す
+func (uc *CompanyUseCase) SelectDefault(ctx context.Context, companies []domain.Company, id int64) (*domain.Company, error) {
+	company, err := domain.FindCompany(companies, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := uc.oauth.SetDefaultCompany(ctx, company); err != nil {
+		return nil, err
+	}
+	return company, nil
+}
+
+// DefaultCompany は保存されている既定の事業所を返す（ネットワークアクセスなし）
+func (uc *CompanyUseCase) DefaultCompany(ctx context.Context) (*domain.Company, error) {
+	token, err := uc.oauth.LoadToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if token.DefaultCompany == nil {
+		return nil, ErrNoDefaultCompany
+	}
+	return token.DefaultCompany, nil
+}
+
+// PreferredCompany は利用者に尋ねずに既定にできる事業所を返す（決められない場合はnil）
+//
+// 保存済みの既定の事業所、認可画面で選択された事業所（company_id）、
+// アクセスできる唯一の事業所の順に、companies に含まれるものを選ぶ。
+func PreferredCompany(companies []domain.Company, token *domain.Token) *domain.Company {
+	if token.DefaultCompany != nil {
+		if company, err := domain.FindCompany(companies, token.DefaultCompany.ID); err == nil {
+			return company
+		}
+	}
+	if token.CompanyID != 0 {
+		if company, err := domain.FindCompany(companies, token.CompanyID); err == nil {
+			return company
+		}
+	}
+	if len(companies) == 1 {
+		return &companies[0]
+	}
+	return nil
+}
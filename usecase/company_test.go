@@ -0,0 +1,115 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"freee-oauth-app/domain"
+)
+
+// モックCompanyDirectory
+type mockCompanyDirectory struct {
+	companies []domain.Company
+	err       error
+	token     *domain.Token
+}
+
+func (m *mockCompanyDirectory) Companies(ctx context.Context, token *domain.Token) ([]domain.Company, error) {
+	m.token = token
+	return m.companies, m.err
+}
+
+var testCompanies = []domain.Company{
+	{ID: 1, DisplayName: "freee事務所", Role: "admin"},
+	{ID: 2, DisplayName: "freee商店", Role: "read_only"},
+}
+
+func TestCompanyUseCase_ListCompanies_RefreshesToken(t *testing.T) {
+	repo := &mockTokenRepository{token: domain.NewToken("old_access", "refresh", time.Now().Add(-time.Hour))}
+	provider := &mockOAuthProvider{token: domain.NewToken("new_access", "refresh", time.Now().Add(time.Hour))}
+	directory := &mockCompanyDirectory{companies: testCompanies}
+	uc := NewCompanyUseCase(NewOAuthUseCase(repo, provider, newMockStateStore()), directory)
+
+	companies, err := uc.ListCompanies(context.Background())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(companies) != 2 {
+		t.Errorf("expected 2 companies, got %d", len(companies))
+	}
+	if directory.token.AccessToken != "new_access" {
+		t.Errorf("expected companies to be listed with the refreshed token, got %s", directory.token.AccessToken)
+	}
+}
+
+func TestCompanyUseCase_SelectDefault(t *testing.T) {
+	repo := &mockTokenRepository{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	uc := NewCompanyUseCase(NewOAuthUseCase(repo, &mockOAuthProvider{}, newMockStateStore()), &mockCompanyDirectory{})
+
+	company, err := uc.SelectDefault(context.Background(), testCompanies, 2)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if company.DisplayName != "freee商店" {
+		t.Errorf("expected freee商店, got %s", company.DisplayName)
+	}
+	if repo.token.DefaultCompany == nil || repo.token.DefaultCompany.ID != 2 {
+		t.Errorf("expected the default company to be saved with the token, got %+v", repo.token.DefaultCompany)
+	}
+	if got, err := uc.DefaultCompany(context.Background()); err != nil || got.ID != 2 {
+		t.Errorf("expected default company 2, got %+v (%v)", got, err)
+	}
+}
+
+func TestCompanyUseCase_SelectDefault_WhenNotAccessible(t *testing.T) {
+	repo := &mockTokenRepository{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	uc := NewCompanyUseCase(NewOAuthUseCase(repo, &mockOAuthProvider{}, newMockStateStore()), &mockCompanyDirectory{})
+
+	_, err := uc.SelectDefault(context.Background(), testCompanies, 3)
+
+	if !errors.Is(err, domain.ErrCompanyNotFound) {
+		t.Errorf("expected ErrCompanyNotFound, got %v", err)
+	}
+	if repo.saveCalled {
+		t.Error("expected the token not to be saved")
+	}
+}
+
+func TestCompanyUseCase_DefaultCompany_WhenNotSelected(t *testing.T) {
+	repo := &mockTokenRepository{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	uc := NewCompanyUseCase(NewOAuthUseCase(repo, &mockOAuthProvider{}, newMockStateStore()), &mockCompanyDirectory{})
+
+	if _, err := uc.DefaultCompany(context.Background()); !errors.Is(err, ErrNoDefaultCompany) {
+		t.Errorf("expected ErrNoDefaultCompany, got %v", err)
+	}
+}
+
+func TestPreferredCompany(t *testing.T) {
+	tests := []struct {
+		name      string
+		companies []domain.Company
+		token     *domain.Token
+		want      int64
+	}{
+		{"saved default", testCompanies, &domain.Token{DefaultCompany: &domain.Company{ID: 2}, CompanyID: 1}, 2},
+		{"company chosen on consent", testCompanies, &domain.Token{CompanyID: 1}, 1},
+		{"inaccessible default", testCompanies, &domain.Token{DefaultCompany: &domain.Company{ID: 3}}, 0},
+		{"single company", testCompanies[:1], &domain.Token{}, 1},
+		{"ambiguous", testCompanies, &domain.Token{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got int64
+			if company := PreferredCompany(tt.companies, tt.token); company != nil {
+				got = company.ID
+			}
+			if got != tt.want {
+				t.Errorf("expected company %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
@@ -5,84 +5,409 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
 
 	"freee-oauth-app/domain"
 )
 
+// プロバイダーの失敗は ErrRefreshFailed・ErrExchangeFailed・ErrRevokeFailed に
+// 元のエラー（*domain.OAuthError）をラップして返す。
+// errors.Is(err, domain.ErrInvalidGrant) で再認可が必要か、
+// errors.Is(err, domain.ErrTransient) で再試行すべきかを判定できる。
 var (
 	ErrNoToken        = errors.New("no token available")
+	ErrNoRefreshToken = errors.New("no refresh token available")
 	ErrRefreshFailed  = errors.New("token refresh failed")
 	ErrStateMismatch  = errors.New("state mismatch")
+	ErrStateExpired   = errors.New("authorization request expired")
 	ErrExchangeFailed = errors.New("token exchange failed")
+	ErrRevokeFailed   = errors.New("token revocation failed")
+	// ErrInsufficientScope は保存されているトークンに必要なスコープが付与されていないことを表す
+	ErrInsufficientScope = errors.New("token does not have the required scopes")
 )
 
 // OAuthUseCase はOAuth認可フローのユースケースを提供する
 type OAuthUseCase struct {
 	tokenRepo     domain.TokenRepository
 	oauthProvider domain.OAuthProvider
-	currentState  string
+	// stateStore は開始済みの認可リクエストをstateごとに保持する
+	stateStore domain.StateStore
+	// refreshSem はプロセス内のトークンのリフレッシュ・更新を1つに制限するセマフォ
+	refreshSem chan struct{}
+	// expiry はトークンの有効期限の判定方法
+	expiry domain.ExpiryPolicy
+	// profile はトークンを保存するプロファイル名（認可リクエストに記録し、完了時に照合する）
+	profile string
+
+	subscribersMu sync.Mutex
+	subscribers   []*subscription
+}
+
+// EventHandler はトークンのライフサイクルイベントを受け取る関数
+//
+// イベントを発行したユースケースの呼び出しの中で同期的に呼ばれる。
+// トークンの取得やブローカーの応答を待たせないよう、ハンドラはブロックしてはならない
+// （時間のかかる処理は hook.Async のように別のゴルーチンで行う）。
+// ロックは解放済みのため、ハンドラからユースケースを呼び出してもよい。
+type EventHandler func(ctx context.Context, event domain.Event)
+
+type subscription struct {
+	handler EventHandler
+}
+
+// Option はOAuthUseCaseの設定を変更する
+type Option func(*OAuthUseCase)
+
+// WithClock は有効期限の判定とイベントの時刻に使う時計を設定する（既定: domain.SystemClock）
+func WithClock(clock domain.Clock) Option {
+	return func(uc *OAuthUseCase) {
+		uc.expiry.Clock = clock
+	}
+}
+
+// WithExpiryBuffer は有効期限のどれだけ前からトークンを無効とみなすかを設定する（既定: domain.DefaultExpiryBuffer）
+func WithExpiryBuffer(buffer time.Duration) Option {
+	return func(uc *OAuthUseCase) {
+		uc.expiry.Buffer = buffer
+	}
+}
+
+// WithProfile はトークンを保存するプロファイル名を設定する
+// 状態ファイルを複数のプロファイルで共有しても、他のプロファイルが開始した認可は完了できない
+func WithProfile(name string) Option {
+	return func(uc *OAuthUseCase) {
+		uc.profile = name
+	}
 }
 
 // NewOAuthUseCase は新しいOAuthUseCaseを生成する
-func NewOAuthUseCase(tokenRepo domain.TokenRepository, oauthProvider domain.OAuthProvider) *OAuthUseCase {
-	return &OAuthUseCase{
+func NewOAuthUseCase(tokenRepo domain.TokenRepository, oauthProvider domain.OAuthProvider, stateStore domain.StateStore, opts ...Option) *OAuthUseCase {
+	uc := &OAuthUseCase{
 		tokenRepo:     tokenRepo,
 		oauthProvider: oauthProvider,
+		stateStore:    stateStore,
+		refreshSem:    make(chan struct{}, 1),
+		expiry:        domain.DefaultExpiryPolicy,
+	}
+	for _, opt := range opts {
+		opt(uc)
+	}
+	return uc
+}
+
+// ExpiryPolicy はトークンの有効期限の判定方法を返す
+func (uc *OAuthUseCase) ExpiryPolicy() domain.ExpiryPolicy {
+	return uc.expiry
+}
+
+// Subscribe はライフサイクルイベントの購読者を登録し、登録を解除する関数を返す
+func (uc *OAuthUseCase) Subscribe(handler EventHandler) (unsubscribe func()) {
+	sub := &subscription{handler: handler}
+	uc.subscribersMu.Lock()
+	uc.subscribers = append(uc.subscribers, sub)
+	uc.subscribersMu.Unlock()
+
+	return func() {
+		uc.subscribersMu.Lock()
+		defer uc.subscribersMu.Unlock()
+		uc.subscribers = slices.DeleteFunc(uc.subscribers, func(s *subscription) bool { return s == sub })
+	}
+}
+
+// publish は登録順にすべての購読者にイベントを通知する
+func (uc *OAuthUseCase) publish(ctx context.Context, event domain.Event) {
+	if event.Time.IsZero() {
+		event.Time = uc.expiry.Clock.Now()
+	}
+	uc.subscribersMu.Lock()
+	subscribers := slices.Clone(uc.subscribers)
+	uc.subscribersMu.Unlock()
+
+	for _, sub := range subscribers {
+		sub.handler(ctx, event)
 	}
 }
 
 // GetOrRefreshToken は既存のトークンを取得し、必要に応じてリフレッシュする
+// 必要なスコープが付与されていないトークンは ErrInsufficientScope を返し、再認可を促す
 func (uc *OAuthUseCase) GetOrRefreshToken(ctx context.Context) (*domain.Token, error) {
 	token, err := uc.tokenRepo.Load(ctx)
 	if err != nil {
 		return nil, ErrNoToken
 	}
 
-	if token.IsValid() {
+	if !token.HasScopes(uc.oauthProvider.Scopes()) {
+		return nil, ErrInsufficientScope
+	}
+
+	if uc.expiry.IsValid(token) {
 		return token, nil
 	}
 
-	if token.NeedsRefresh() {
-		newToken, err := uc.oauthProvider.Refresh(ctx, token)
-		if err != nil {
-			return nil, ErrRefreshFailed
+	if uc.expiry.NeedsRefresh(token) {
+		return uc.refreshExclusive(ctx, func(current *domain.Token) bool {
+			return !uc.expiry.IsValid(current)
+		})
+	}
+
+	return nil, ErrNoToken
+}
+
+// LoadToken は保存されているトークンをネットワークにアクセスせずに取得する
+func (uc *OAuthUseCase) LoadToken(ctx context.Context) (*domain.Token, error) {
+	token, err := uc.tokenRepo.Load(ctx)
+	if err != nil {
+		return nil, ErrNoToken
+	}
+	return token, nil
+}
+
+// ForceRefresh はトークンの有効期限に関わらずリフレッシュを行い保存する
+func (uc *OAuthUseCase) ForceRefresh(ctx context.Context) (*domain.Token, error) {
+	token, err := uc.tokenRepo.Load(ctx)
+	if err != nil {
+		return nil, ErrNoToken
+	}
+	if !token.HasRefreshToken() {
+		return nil, ErrNoRefreshToken
+	}
+
+	// 読み込み後に他の呼び出し元がリフレッシュ済みであれば、その結果を返す
+	return uc.refreshExclusive(ctx, func(current *domain.Token) bool {
+		return current.AccessToken == token.AccessToken
+	})
+}
+
+// refreshExclusive はプロセス内・プロセス間で排他制御した上でトークンを読み込み直し、
+// needsRefresh が true の場合のみリフレッシュして保存する
+//
+// freeeはリフレッシュ時にリフレッシュトークンをローテーションするため、
+// 同じリフレッシュトークンで複数回リフレッシュすると後の呼び出しが失敗し、
+// 無効になったトークンで保存済みのトークンを上書きしてしまう。
+// ロック取得後に読み込み直すことで、リフレッシュが1回だけ行われ全員が新しいトークンを得る。
+// イベントはロックを解放した後に発行する。
+func (uc *OAuthUseCase) refreshExclusive(ctx context.Context, needsRefresh func(current *domain.Token) bool) (*domain.Token, error) {
+	var event *domain.Event
+	defer func() {
+		if event != nil {
+			uc.publish(ctx, *event)
 		}
-		if err := uc.tokenRepo.Save(ctx, newToken); err != nil {
-			return nil, err
+	}()
+
+	unlock, err := uc.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	token, err := uc.tokenRepo.Load(ctx)
+	if err != nil {
+		return nil, ErrNoToken
+	}
+	if !needsRefresh(token) {
+		return token, nil
+	}
+	if !token.HasRefreshToken() {
+		return nil, ErrNoRefreshToken
+	}
+
+	newToken, err := uc.oauthProvider.Refresh(ctx, token)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrRefreshFailed, err)
+		event = &domain.Event{Type: domain.EventRefreshFailed, Err: err}
+		return nil, err
+	}
+	// 既定の事業所は認可サーバーではなくこのアプリが保存しているため引き継ぐ
+	newToken.DefaultCompany = token.DefaultCompany
+	if err := uc.tokenRepo.Save(ctx, newToken); err != nil {
+		// ローテーション済みのリフレッシュトークンを失うため、失敗として通知する
+		event = &domain.Event{Type: domain.EventRefreshFailed, Err: err}
+		return nil, err
+	}
+	event = &domain.Event{
+		Type:                domain.EventTokenRefreshed,
+		Token:               newToken,
+		RefreshTokenRotated: newToken.RefreshToken != token.RefreshToken,
+	}
+	return newToken, nil
+}
+
+// SetDefaultCompany は保存されているトークンに既定の事業所を記録する
+// company がnilの場合は既定の事業所を解除する
+func (uc *OAuthUseCase) SetDefaultCompany(ctx context.Context, company *domain.Company) (*domain.Token, error) {
+	unlock, err := uc.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	token, err := uc.tokenRepo.Load(ctx)
+	if err != nil {
+		return nil, ErrNoToken
+	}
+	token.DefaultCompany = company
+	if err := uc.tokenRepo.Save(ctx, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// lock はトークンの読み込みから保存までをプロセス内・プロセス間で排他制御し、解放する関数を返す
+func (uc *OAuthUseCase) lock(ctx context.Context) (unlock func(), err error) {
+	select {
+	case uc.refreshSem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-uc.refreshSem }
+
+	locker, ok := uc.tokenRepo.(domain.TokenLocker)
+	if !ok {
+		return release, nil
+	}
+	unlockRepo, err := locker.Lock(ctx)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return func() {
+		unlockRepo()
+		release()
+	}, nil
+}
+
+// Logout はトークンを認可サーバー上で無効化し、保存されているトークンを削除する
+// 無効化に失敗した場合もローカルのトークンは削除し、ErrRevokeFailed を返す
+//
+// 実行中のリフレッシュが削除後にローテーション済みのトークンを保存してセッションが復活しないよう、
+// 読み込みから削除までリフレッシュと同じロックを取得する。イベントはロックを解放した後に発行する。
+func (uc *OAuthUseCase) Logout(ctx context.Context) error {
+	deleted := false
+	defer func() {
+		if deleted {
+			uc.publish(ctx, domain.Event{Type: domain.EventTokenDeleted})
 		}
-		return newToken, nil
+	}()
+
+	unlock, err := uc.lock(ctx)
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	return nil, ErrNoToken
+	token, err := uc.tokenRepo.Load(ctx)
+	if err != nil {
+		if !uc.tokenRepo.Exists(ctx) {
+			return ErrNoToken
+		}
+		// 読み込めないトークンは無効化できないため削除のみ行う
+		if err := uc.tokenRepo.Delete(ctx); err != nil {
+			return err
+		}
+		deleted = true
+		return nil
+	}
+
+	revokeErr := uc.oauthProvider.Revoke(ctx, token)
+
+	if err := uc.tokenRepo.Delete(ctx); err != nil {
+		return err
+	}
+	deleted = true
+	if revokeErr != nil {
+		return fmt.Errorf("%w: %w", ErrRevokeFailed, revokeErr)
+	}
+	return nil
+}
+
+// AuthorizationRequest は認可フローを開始する際のオプション
+type AuthorizationRequest struct {
+	// RedirectURL は認可URLに指定するリダイレクトURL（空の場合はプロバイダーの設定値）
+	// コールバックサーバーが実際に待ち受けたポートを反映するために使う
+	RedirectURL string
 }
 
 // StartAuthorization は認可フローを開始し、認可URLとstateを返す
-func (uc *OAuthUseCase) StartAuthorization() (authURL string, state string) {
-	uc.currentState = generateState()
-	authURL = uc.oauthProvider.AuthorizationURL(uc.currentState)
-	return authURL, uc.currentState
+// 認可試行ごとにstateとPKCEのコードベリファイアを生成してStateStoreに保存するため、
+// 複数の認可フローを同時に進められる
+func (uc *OAuthUseCase) StartAuthorization(ctx context.Context, req AuthorizationRequest) (authURL string, state string, err error) {
+	pending := &domain.PendingAuthorization{
+		State:        generateState(),
+		CodeVerifier: generateCodeVerifier(),
+		RedirectURL:  req.RedirectURL,
+		Profile:      uc.profile,
+		CreatedAt:    uc.expiry.Clock.Now(),
+	}
+	if err := uc.stateStore.Save(ctx, pending); err != nil {
+		return "", "", err
+	}
+
+	authURL = uc.oauthProvider.AuthorizationURL(pending.State, pending.CodeVerifier, pending.RedirectURL)
+	return authURL, pending.State, nil
 }
 
 // CompleteAuthorization は認可コードをトークンに交換して保存する
+// 保存済みのトークンがある場合は既定の事業所を引き継ぐ
+// stateに対応する認可リクエストは1回だけ使用でき、期限切れの場合は ErrStateExpired を返す
+// 他のプロファイルが開始した認可リクエストの場合は ErrStateMismatch を返す
 func (uc *OAuthUseCase) CompleteAuthorization(ctx context.Context, code, state string) (*domain.Token, error) {
-	if state != uc.currentState {
+	if state == "" {
+		return nil, ErrStateMismatch
+	}
+	pending, err := uc.stateStore.Consume(ctx, state)
+	switch {
+	case errors.Is(err, domain.ErrAuthorizationNotFound):
+		return nil, ErrStateMismatch
+	case errors.Is(err, domain.ErrAuthorizationExpired):
+		return nil, ErrStateExpired
+	case err != nil:
+		return nil, err
+	}
+	if pending.Profile != uc.profile {
 		return nil, ErrStateMismatch
 	}
 
-	token, err := uc.oauthProvider.Exchange(ctx, code)
+	token, err := uc.oauthProvider.Exchange(ctx, code, pending.CodeVerifier, pending.RedirectURL)
 	if err != nil {
-		return nil, ErrExchangeFailed
+		return nil, fmt.Errorf("%w: %w", ErrExchangeFailed, err)
 	}
-
-	if err := uc.tokenRepo.Save(ctx, token); err != nil {
+	if err := uc.saveAuthorizedToken(ctx, token); err != nil {
 		return nil, err
 	}
+	uc.publish(ctx, domain.Event{Type: domain.EventTokenObtained, Token: token})
 
 	return token, nil
 }
 
+// saveAuthorizedToken は認可で得たトークンを保存する
+// 再認可した場合は以前に選択した既定の事業所を引き継ぐ（アクセスできるかは呼び出し元が確認する）。
+// 読み込みから保存までの間に他の呼び出しが既定の事業所を変更しないよう、リフレッシュと同じロックを取得する。
+func (uc *OAuthUseCase) saveAuthorizedToken(ctx context.Context, token *domain.Token) error {
+	unlock, err := uc.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if previous, err := uc.tokenRepo.Load(ctx); err == nil && previous != nil {
+		token.DefaultCompany = previous.DefaultCompany
+	}
+	return uc.tokenRepo.Save(ctx, token)
+}
+
 func generateState() string {
 	b := make([]byte, 32)
 	rand.Read(b)
 	return base64.URLEncoding.EncodeToString(b)
 }
+
+// generateCodeVerifier はRFC 7636に準拠したPKCEのコードベリファイアを生成する
+// 32バイトの乱数をパディングなしのbase64urlでエンコードした43文字の文字列になる
+func generateCodeVerifier() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
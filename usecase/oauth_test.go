@@ -3,6 +3,8 @@ package usecase
 import (
 	"context"
 	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -11,13 +13,18 @@ import (
 
 // モックTokenRepository
 type mockTokenRepository struct {
-	token      *domain.Token
-	saveErr    error
-	loadErr    error
-	saveCalled bool
+	mu           sync.Mutex
+	token        *domain.Token
+	saveErr      error
+	loadErr      error
+	deleteErr    error
+	saveCalled   bool
+	deleteCalled bool
 }
 
 func (m *mockTokenRepository) Save(ctx context.Context, token *domain.Token) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.saveCalled = true
 	if m.saveErr != nil {
 		return m.saveErr
@@ -27,6 +34,8 @@ func (m *mockTokenRepository) Save(ctx context.Context, token *domain.Token) err
 }
 
 func (m *mockTokenRepository) Load(ctx context.Context) (*domain.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if m.loadErr != nil {
 		return nil, m.loadErr
 	}
@@ -37,19 +46,76 @@ func (m *mockTokenRepository) Exists(ctx context.Context) bool {
 	return m.token != nil
 }
 
+func (m *mockTokenRepository) Delete(ctx context.Context) error {
+	m.deleteCalled = true
+	if m.deleteErr != nil {
+		return m.deleteErr
+	}
+	m.token = nil
+	return nil
+}
+
 // モックOAuthProvider
+// モックStateStore
+type mockStateStore struct {
+	mu      sync.Mutex
+	pending map[string]*domain.PendingAuthorization
+	expired bool
+}
+
+func newMockStateStore() *mockStateStore {
+	return &mockStateStore{pending: map[string]*domain.PendingAuthorization{}}
+}
+
+func (m *mockStateStore) Save(ctx context.Context, auth *domain.PendingAuthorization) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pending[auth.State] = auth
+	return nil
+}
+
+func (m *mockStateStore) Consume(ctx context.Context, state string) (*domain.PendingAuthorization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	auth, ok := m.pending[state]
+	if !ok {
+		return nil, domain.ErrAuthorizationNotFound
+	}
+	delete(m.pending, state)
+	if m.expired {
+		return nil, domain.ErrAuthorizationExpired
+	}
+	return auth, nil
+}
+
 type mockOAuthProvider struct {
-	authURL     string
-	token       *domain.Token
-	exchangeErr error
-	refreshErr  error
+	scopes           []string
+	authURL          string
+	token            *domain.Token
+	exchangeErr      error
+	refreshErr       error
+	revokeErr        error
+	revoked          *domain.Token
+	refreshCalls     int32
+	authCodeVerifier string
+	exchangeVerifier string
+	authRedirectURL  string
+	exchangeRedirect string
 }
 
-func (m *mockOAuthProvider) AuthorizationURL(state string) string {
+func (m *mockOAuthProvider) Scopes() []string {
+	return m.scopes
+}
+
+func (m *mockOAuthProvider) AuthorizationURL(state, codeVerifier, redirectURL string) string {
+	m.authCodeVerifier = codeVerifier
+	m.authRedirectURL = redirectURL
 	return m.authURL + "?state=" + state
 }
 
-func (m *mockOAuthProvider) Exchange(ctx context.Context, code string) (*domain.Token, error) {
+func (m *mockOAuthProvider) Exchange(ctx context.Context, code, codeVerifier, redirectURL string) (*domain.Token, error) {
+	m.exchangeVerifier = codeVerifier
+	m.exchangeRedirect = redirectURL
 	if m.exchangeErr != nil {
 		return nil, m.exchangeErr
 	}
@@ -57,17 +123,23 @@ func (m *mockOAuthProvider) Exchange(ctx context.Context, code string) (*domain.
 }
 
 func (m *mockOAuthProvider) Refresh(ctx context.Context, token *domain.Token) (*domain.Token, error) {
+	atomic.AddInt32(&m.refreshCalls, 1)
 	if m.refreshErr != nil {
 		return nil, m.refreshErr
 	}
 	return m.token, nil
 }
 
+func (m *mockOAuthProvider) Revoke(ctx context.Context, token *domain.Token) error {
+	m.revoked = token
+	return m.revokeErr
+}
+
 func TestOAuthUseCase_GetOrRefreshToken_WhenValidTokenExists(t *testing.T) {
 	validToken := domain.NewToken("access", "refresh", time.Now().Add(time.Hour))
 	repo := &mockTokenRepository{token: validToken}
 	provider := &mockOAuthProvider{}
-	uc := NewOAuthUseCase(repo, provider)
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
 
 	token, err := uc.GetOrRefreshToken(context.Background())
 
@@ -82,7 +154,7 @@ func TestOAuthUseCase_GetOrRefreshToken_WhenValidTokenExists(t *testing.T) {
 func TestOAuthUseCase_GetOrRefreshToken_WhenNoTokenExists(t *testing.T) {
 	repo := &mockTokenRepository{loadErr: errors.New("not found")}
 	provider := &mockOAuthProvider{}
-	uc := NewOAuthUseCase(repo, provider)
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
 
 	token, err := uc.GetOrRefreshToken(context.Background())
 
@@ -99,7 +171,7 @@ func TestOAuthUseCase_GetOrRefreshToken_WhenTokenNeedsRefresh(t *testing.T) {
 	newToken := domain.NewToken("new_access", "refresh", time.Now().Add(time.Hour))
 	repo := &mockTokenRepository{token: expiredToken}
 	provider := &mockOAuthProvider{token: newToken}
-	uc := NewOAuthUseCase(repo, provider)
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
 
 	token, err := uc.GetOrRefreshToken(context.Background())
 
@@ -114,15 +186,128 @@ func TestOAuthUseCase_GetOrRefreshToken_WhenTokenNeedsRefresh(t *testing.T) {
 	}
 }
 
+func TestOAuthUseCase_GetOrRefreshToken_ConcurrentCallsRefreshOnce(t *testing.T) {
+	expiredToken := domain.NewToken("old_access", "refresh", time.Now().Add(-time.Hour))
+	newToken := domain.NewToken("new_access", "rotated_refresh", time.Now().Add(time.Hour))
+	repo := &mockTokenRepository{token: expiredToken}
+	provider := &mockOAuthProvider{token: newToken}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([]*domain.Token, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = uc.GetOrRefreshToken(context.Background())
+		}(i)
+	}
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&provider.refreshCalls); calls != 1 {
+		t.Errorf("expected exactly 1 refresh, got %d", calls)
+	}
+	for i := 0; i < callers; i++ {
+		if errs[i] != nil {
+			t.Errorf("caller %d: unexpected error: %v", i, errs[i])
+			continue
+		}
+		if results[i].AccessToken != "new_access" {
+			t.Errorf("caller %d: expected new_access, got %s", i, results[i].AccessToken)
+		}
+	}
+}
+
+// モックTokenLocker付きTokenRepository
+type lockingTokenRepository struct {
+	mockTokenRepository
+	lockCalls int
+}
+
+func (m *lockingTokenRepository) Lock(ctx context.Context) (func(), error) {
+	m.lockCalls++
+	return func() {}, nil
+}
+
+func TestOAuthUseCase_GetOrRefreshToken_KeepsDefaultCompany(t *testing.T) {
+	expiredToken := domain.NewToken("old_access", "refresh", time.Now().Add(-time.Hour))
+	expiredToken.DefaultCompany = &domain.Company{ID: 1, DisplayName: "freee事務所"}
+	repo := &mockTokenRepository{token: expiredToken}
+	provider := &mockOAuthProvider{token: domain.NewToken("new_access", "refresh", time.Now().Add(time.Hour))}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+
+	token, err := uc.GetOrRefreshToken(context.Background())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.DefaultCompany == nil || token.DefaultCompany.ID != 1 {
+		t.Errorf("expected the default company to be kept after refresh, got %+v", token.DefaultCompany)
+	}
+}
+
+func TestOAuthUseCase_GetOrRefreshToken_LocksTokenStore(t *testing.T) {
+	expiredToken := domain.NewToken("old_access", "refresh", time.Now().Add(-time.Hour))
+	newToken := domain.NewToken("new_access", "refresh", time.Now().Add(time.Hour))
+	repo := &lockingTokenRepository{mockTokenRepository: mockTokenRepository{token: expiredToken}}
+	provider := &mockOAuthProvider{token: newToken}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+
+	if _, err := uc.GetOrRefreshToken(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.lockCalls != 1 {
+		t.Errorf("expected token store to be locked once, got %d", repo.lockCalls)
+	}
+}
+
+func TestOAuthUseCase_GetOrRefreshToken_WhenRefreshedByAnotherProcess(t *testing.T) {
+	expiredToken := domain.NewToken("old_access", "refresh", time.Now().Add(-time.Hour))
+	refreshedToken := domain.NewToken("other_access", "other_refresh", time.Now().Add(time.Hour))
+	repo := &swappingTokenRepository{first: expiredToken, rest: refreshedToken}
+	provider := &mockOAuthProvider{}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+
+	token, err := uc.GetOrRefreshToken(context.Background())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token != refreshedToken {
+		t.Error("expected token refreshed by another process to be returned")
+	}
+	if provider.refreshCalls != 0 {
+		t.Errorf("expected no refresh, got %d", provider.refreshCalls)
+	}
+}
+
+// swappingTokenRepository は初回の読み込み後に別プロセスがトークンを更新した状況を再現する
+type swappingTokenRepository struct {
+	mockTokenRepository
+	first  *domain.Token
+	rest   *domain.Token
+	loaded bool
+}
+
+func (m *swappingTokenRepository) Load(ctx context.Context) (*domain.Token, error) {
+	if !m.loaded {
+		m.loaded = true
+		return m.first, nil
+	}
+	return m.rest, nil
+}
+
 func TestOAuthUseCase_GetOrRefreshToken_WhenRefreshFails(t *testing.T) {
 	expiredToken := domain.NewToken("old_access", "refresh", time.Now().Add(-time.Hour))
 	repo := &mockTokenRepository{token: expiredToken}
 	provider := &mockOAuthProvider{refreshErr: errors.New("refresh failed")}
-	uc := NewOAuthUseCase(repo, provider)
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
 
 	token, err := uc.GetOrRefreshToken(context.Background())
 
-	if err != ErrRefreshFailed {
+	if !errors.Is(err, ErrRefreshFailed) {
 		t.Errorf("expected ErrRefreshFailed, got %v", err)
 	}
 	if token != nil {
@@ -130,12 +315,240 @@ func TestOAuthUseCase_GetOrRefreshToken_WhenRefreshFails(t *testing.T) {
 	}
 }
 
+func TestOAuthUseCase_GetOrRefreshToken_WhenScopesInsufficient(t *testing.T) {
+	readOnlyToken := domain.NewToken("access", "refresh", time.Now().Add(time.Hour))
+	readOnlyToken.Scopes = []string{"read"}
+	repo := &mockTokenRepository{token: readOnlyToken}
+	provider := &mockOAuthProvider{scopes: []string{"read", "write"}}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+
+	token, err := uc.GetOrRefreshToken(context.Background())
+
+	if err != ErrInsufficientScope {
+		t.Errorf("expected ErrInsufficientScope, got %v", err)
+	}
+	if token != nil {
+		t.Error("expected nil token")
+	}
+}
+
+func TestOAuthUseCase_GetOrRefreshToken_WhenScopesSufficient(t *testing.T) {
+	validToken := domain.NewToken("access", "refresh", time.Now().Add(time.Hour))
+	validToken.Scopes = []string{"read", "write"}
+	repo := &mockTokenRepository{token: validToken}
+	provider := &mockOAuthProvider{scopes: []string{"read"}}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+
+	token, err := uc.GetOrRefreshToken(context.Background())
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if token != validToken {
+		t.Error("expected valid token to be returned")
+	}
+}
+
+func TestOAuthUseCase_GetOrRefreshToken_UsesClock(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	token := domain.NewToken("old_access", "refresh", now.Add(time.Hour))
+	repo := &mockTokenRepository{token: token}
+	provider := &mockOAuthProvider{token: domain.NewToken("new_access", "refresh", now.Add(2*time.Hour))}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore(), WithClock(domain.ClockFunc(func() time.Time { return now })))
+
+	if got, _ := uc.GetOrRefreshToken(context.Background()); got != token {
+		t.Fatal("expected the stored token to be valid at the injected time")
+	}
+
+	now = now.Add(58 * time.Minute)
+
+	got, err := uc.GetOrRefreshToken(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.AccessToken != "new_access" {
+		t.Errorf("expected the token to be refreshed within the expiry buffer, got %s", got.AccessToken)
+	}
+}
+
+func TestOAuthUseCase_GetOrRefreshToken_UsesExpiryBuffer(t *testing.T) {
+	token := domain.NewToken("old_access", "refresh", time.Now().Add(20*time.Minute))
+	repo := &mockTokenRepository{token: token}
+	provider := &mockOAuthProvider{token: domain.NewToken("new_access", "refresh", time.Now().Add(time.Hour))}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore(), WithExpiryBuffer(30*time.Minute))
+
+	got, err := uc.GetOrRefreshToken(context.Background())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.AccessToken != "new_access" {
+		t.Errorf("expected a token expiring within the buffer to be refreshed, got %s", got.AccessToken)
+	}
+	if uc.ExpiryPolicy().Buffer != 30*time.Minute {
+		t.Errorf("expected the configured buffer, got %s", uc.ExpiryPolicy().Buffer)
+	}
+}
+
+func TestOAuthUseCase_LoadToken_DoesNotRefresh(t *testing.T) {
+	expiredToken := domain.NewToken("old_access", "refresh", time.Now().Add(-time.Hour))
+	repo := &mockTokenRepository{token: expiredToken}
+	provider := &mockOAuthProvider{refreshErr: errors.New("should not be called")}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+
+	token, err := uc.LoadToken(context.Background())
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if token != expiredToken {
+		t.Error("expected stored token to be returned as is")
+	}
+}
+
+func TestOAuthUseCase_LoadToken_WhenNoTokenExists(t *testing.T) {
+	repo := &mockTokenRepository{loadErr: errors.New("not found")}
+	uc := NewOAuthUseCase(repo, &mockOAuthProvider{}, newMockStateStore())
+
+	_, err := uc.LoadToken(context.Background())
+
+	if err != ErrNoToken {
+		t.Errorf("expected ErrNoToken, got %v", err)
+	}
+}
+
+func TestOAuthUseCase_ForceRefresh_WhenTokenStillValid(t *testing.T) {
+	validToken := domain.NewToken("old_access", "refresh", time.Now().Add(time.Hour))
+	newToken := domain.NewToken("new_access", "refresh", time.Now().Add(2*time.Hour))
+	repo := &mockTokenRepository{token: validToken}
+	provider := &mockOAuthProvider{token: newToken}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+
+	token, err := uc.ForceRefresh(context.Background())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.AccessToken != "new_access" {
+		t.Errorf("expected new_access, got %s", token.AccessToken)
+	}
+	if !repo.saveCalled {
+		t.Error("expected token to be saved after refresh")
+	}
+}
+
+func TestOAuthUseCase_ForceRefresh_WhenNoRefreshToken(t *testing.T) {
+	repo := &mockTokenRepository{token: domain.NewToken("access", "", time.Now().Add(time.Hour))}
+	uc := NewOAuthUseCase(repo, &mockOAuthProvider{}, newMockStateStore())
+
+	_, err := uc.ForceRefresh(context.Background())
+
+	if err != ErrNoRefreshToken {
+		t.Errorf("expected ErrNoRefreshToken, got %v", err)
+	}
+}
+
+func TestOAuthUseCase_ForceRefresh_WhenRefreshFails(t *testing.T) {
+	repo := &mockTokenRepository{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	provider := &mockOAuthProvider{refreshErr: errors.New("refresh failed")}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+
+	_, err := uc.ForceRefresh(context.Background())
+
+	if !errors.Is(err, ErrRefreshFailed) {
+		t.Errorf("expected ErrRefreshFailed, got %v", err)
+	}
+	if repo.saveCalled {
+		t.Error("expected token not to be saved when refresh fails")
+	}
+}
+
+func TestOAuthUseCase_RefreshFailure_PreservesOAuthError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       *domain.OAuthError
+		revoked   bool
+		transient bool
+	}{
+		{"invalid_grant", &domain.OAuthError{Op: "refresh", Code: domain.ErrorCodeInvalidGrant, StatusCode: 400}, true, false},
+		{"temporarily_unavailable", &domain.OAuthError{Op: "refresh", Code: domain.ErrorCodeTemporarilyUnavailable, StatusCode: 503}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockTokenRepository{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+			uc := NewOAuthUseCase(repo, &mockOAuthProvider{refreshErr: tt.err}, newMockStateStore())
+
+			_, err := uc.ForceRefresh(context.Background())
+
+			if !errors.Is(err, ErrRefreshFailed) {
+				t.Errorf("expected ErrRefreshFailed, got %v", err)
+			}
+			if got := errors.Is(err, domain.ErrInvalidGrant); got != tt.revoked {
+				t.Errorf("errors.Is(ErrInvalidGrant) = %t, want %t", got, tt.revoked)
+			}
+			if got := errors.Is(err, domain.ErrTransient); got != tt.transient {
+				t.Errorf("errors.Is(ErrTransient) = %t, want %t", got, tt.transient)
+			}
+			var oauthErr *domain.OAuthError
+			if !errors.As(err, &oauthErr) || oauthErr.StatusCode != tt.err.StatusCode {
+				t.Errorf("expected OAuthError with status %d, got %v", tt.err.StatusCode, oauthErr)
+			}
+		})
+	}
+}
+
+func TestOAuthUseCase_Logout(t *testing.T) {
+	stored := domain.NewToken("access", "refresh", time.Now().Add(time.Hour))
+	repo := &mockTokenRepository{token: stored}
+	provider := &mockOAuthProvider{}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+
+	if err := uc.Logout(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if provider.revoked != stored {
+		t.Error("expected stored token to be revoked")
+	}
+	if !repo.deleteCalled {
+		t.Error("expected token to be deleted")
+	}
+}
+
+func TestOAuthUseCase_Logout_WhenRevokeFails(t *testing.T) {
+	repo := &mockTokenRepository{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	provider := &mockOAuthProvider{revokeErr: errors.New("server error")}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+
+	err := uc.Logout(context.Background())
+
+	if !errors.Is(err, ErrRevokeFailed) {
+		t.Errorf("expected ErrRevokeFailed, got %v", err)
+	}
+	if !repo.deleteCalled {
+		t.Error("expected token to be deleted even when revocation fails")
+	}
+}
+
+func TestOAuthUseCase_Logout_WhenNoTokenExists(t *testing.T) {
+	repo := &mockTokenRepository{loadErr: errors.New("not found")}
+	uc := NewOAuthUseCase(repo, &mockOAuthProvider{}, newMockStateStore())
+
+	err := uc.Logout(context.Background())
+
+	if err != ErrNoToken {
+		t.Errorf("expected ErrNoToken, got %v", err)
+	}
+	if repo.deleteCalled {
+		t.Error("expected Delete not to be called")
+	}
+}
+
 func TestOAuthUseCase_StartAuthorization(t *testing.T) {
 	repo := &mockTokenRepository{}
 	provider := &mockOAuthProvider{authURL: "https://example.com/auth"}
-	uc := NewOAuthUseCase(repo, provider)
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
 
-	url, state := uc.StartAuthorization()
+	url, state, _ := uc.StartAuthorization(context.Background(), AuthorizationRequest{})
 
 	if state == "" {
 		t.Error("expected non-empty state")
@@ -146,13 +559,28 @@ func TestOAuthUseCase_StartAuthorization(t *testing.T) {
 	}
 }
 
+func TestOAuthUseCase_StartAuthorization_UsesClock(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := newMockStateStore()
+	uc := NewOAuthUseCase(&mockTokenRepository{}, &mockOAuthProvider{}, store, WithClock(domain.ClockFunc(func() time.Time { return now })))
+
+	_, state, err := uc.StartAuthorization(context.Background(), AuthorizationRequest{})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := store.pending[state].CreatedAt; !got.Equal(now) {
+		t.Errorf("expected the authorization to be created at %v, got %v", now, got)
+	}
+}
+
 func TestOAuthUseCase_CompleteAuthorization_Success(t *testing.T) {
 	newToken := domain.NewToken("access", "refresh", time.Now().Add(time.Hour))
 	repo := &mockTokenRepository{}
 	provider := &mockOAuthProvider{token: newToken}
-	uc := NewOAuthUseCase(repo, provider)
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
 
-	_, state := uc.StartAuthorization()
+	_, state, _ := uc.StartAuthorization(context.Background(), AuthorizationRequest{})
 	token, err := uc.CompleteAuthorization(context.Background(), "auth_code", state)
 
 	if err != nil {
@@ -166,12 +594,166 @@ func TestOAuthUseCase_CompleteAuthorization_Success(t *testing.T) {
 	}
 }
 
+func TestOAuthUseCase_CompleteAuthorization_KeepsDefaultCompany(t *testing.T) {
+	previous := domain.NewToken("old_access", "old_refresh", time.Now().Add(-time.Hour))
+	previous.DefaultCompany = &domain.Company{ID: 1}
+	repo := &mockTokenRepository{token: previous}
+	provider := &mockOAuthProvider{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+
+	_, state, _ := uc.StartAuthorization(context.Background(), AuthorizationRequest{})
+	token, err := uc.CompleteAuthorization(context.Background(), "auth_code", state)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.DefaultCompany == nil || token.DefaultCompany.ID != 1 {
+		t.Errorf("expected the previous default company to be kept, got %+v", token.DefaultCompany)
+	}
+}
+
+// blockingRefreshProvider はリフレッシュの途中で release が閉じられるまで待機する
+type blockingRefreshProvider struct {
+	mockOAuthProvider
+	started chan struct{}
+	release chan struct{}
+}
+
+func (m *blockingRefreshProvider) Refresh(ctx context.Context, token *domain.Token) (*domain.Token, error) {
+	close(m.started)
+	<-m.release
+	return m.mockOAuthProvider.Refresh(ctx, token)
+}
+
+func TestOAuthUseCase_Logout_WaitsForRunningRefresh(t *testing.T) {
+	expiredToken := domain.NewToken("old_access", "refresh", time.Now().Add(-time.Hour))
+	repo := &mockTokenRepository{token: expiredToken}
+	provider := &blockingRefreshProvider{
+		mockOAuthProvider: mockOAuthProvider{token: domain.NewToken("new_access", "rotated_refresh", time.Now().Add(time.Hour))},
+		started:           make(chan struct{}),
+		release:           make(chan struct{}),
+	}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+
+	refreshDone := make(chan error, 1)
+	go func() {
+		_, err := uc.GetOrRefreshToken(context.Background())
+		refreshDone <- err
+	}()
+	<-provider.started
+
+	logoutDone := make(chan error, 1)
+	go func() { logoutDone <- uc.Logout(context.Background()) }()
+
+	// リフレッシュが終わるまでログアウトは待機する
+	select {
+	case err := <-logoutDone:
+		t.Fatalf("expected logout to wait for the running refresh, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(provider.release)
+
+	if err := <-refreshDone; err != nil {
+		t.Fatalf("unexpected refresh error: %v", err)
+	}
+	if err := <-logoutDone; err != nil {
+		t.Fatalf("unexpected logout error: %v", err)
+	}
+	// ローテーション済みのトークンを無効化して削除し、セッションは復活しない
+	if provider.revoked == nil || provider.revoked.AccessToken != "new_access" {
+		t.Errorf("expected the refreshed token to be revoked, got %+v", provider.revoked)
+	}
+	if token, _ := repo.Load(context.Background()); token != nil {
+		t.Errorf("expected no token after logout, got %+v", token)
+	}
+}
+
+func TestOAuthUseCase_Logout_LocksTokenStore(t *testing.T) {
+	repo := &lockingTokenRepository{mockTokenRepository: mockTokenRepository{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}}
+	uc := NewOAuthUseCase(repo, &mockOAuthProvider{}, newMockStateStore())
+
+	if err := uc.Logout(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.lockCalls != 1 {
+		t.Errorf("expected token store to be locked once, got %d", repo.lockCalls)
+	}
+}
+
+func TestOAuthUseCase_CompleteAuthorization_LocksTokenStore(t *testing.T) {
+	repo := &lockingTokenRepository{}
+	provider := &mockOAuthProvider{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+
+	_, state, _ := uc.StartAuthorization(context.Background(), AuthorizationRequest{})
+	if _, err := uc.CompleteAuthorization(context.Background(), "auth_code", state); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.lockCalls != 1 {
+		t.Errorf("expected token store to be locked once, got %d", repo.lockCalls)
+	}
+}
+
+func TestOAuthUseCase_CompleteAuthorization_PassesCodeVerifier(t *testing.T) {
+	newToken := domain.NewToken("access", "refresh", time.Now().Add(time.Hour))
+	repo := &mockTokenRepository{}
+	provider := &mockOAuthProvider{token: newToken}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+
+	_, state, _ := uc.StartAuthorization(context.Background(), AuthorizationRequest{})
+	if _, err := uc.CompleteAuthorization(context.Background(), "auth_code", state); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if provider.authCodeVerifier == "" {
+		t.Fatal("expected code verifier to be passed to AuthorizationURL")
+	}
+	if len(provider.authCodeVerifier) < 43 || len(provider.authCodeVerifier) > 128 {
+		t.Errorf("code verifier length must be 43-128, got %d", len(provider.authCodeVerifier))
+	}
+	if provider.exchangeVerifier != provider.authCodeVerifier {
+		t.Errorf("expected exchange verifier %s, got %s", provider.authCodeVerifier, provider.exchangeVerifier)
+	}
+}
+
+func TestOAuthUseCase_CompleteAuthorization_PassesRedirectURL(t *testing.T) {
+	repo := &mockTokenRepository{}
+	provider := &mockOAuthProvider{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+
+	_, state, _ := uc.StartAuthorization(context.Background(), AuthorizationRequest{RedirectURL: "http://127.0.0.1:8081/callback"})
+	if _, err := uc.CompleteAuthorization(context.Background(), "auth_code", state); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if provider.authRedirectURL != "http://127.0.0.1:8081/callback" {
+		t.Errorf("expected redirect URL to be passed to AuthorizationURL, got %q", provider.authRedirectURL)
+	}
+	if provider.exchangeRedirect != provider.authRedirectURL {
+		t.Errorf("expected exchange redirect URL %q, got %q", provider.authRedirectURL, provider.exchangeRedirect)
+	}
+}
+
+func TestOAuthUseCase_StartAuthorization_GeneratesNewCodeVerifier(t *testing.T) {
+	repo := &mockTokenRepository{}
+	provider := &mockOAuthProvider{}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+
+	uc.StartAuthorization(context.Background(), AuthorizationRequest{})
+	first := provider.authCodeVerifier
+	uc.StartAuthorization(context.Background(), AuthorizationRequest{})
+
+	if first == provider.authCodeVerifier {
+		t.Error("expected a new code verifier for each authorization attempt")
+	}
+}
+
 func TestOAuthUseCase_CompleteAuthorization_StateMismatch(t *testing.T) {
 	repo := &mockTokenRepository{}
 	provider := &mockOAuthProvider{}
-	uc := NewOAuthUseCase(repo, provider)
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
 
-	uc.StartAuthorization()
+	uc.StartAuthorization(context.Background(), AuthorizationRequest{})
 	_, err := uc.CompleteAuthorization(context.Background(), "auth_code", "wrong_state")
 
 	if err != ErrStateMismatch {
@@ -182,15 +764,215 @@ func TestOAuthUseCase_CompleteAuthorization_StateMismatch(t *testing.T) {
 func TestOAuthUseCase_CompleteAuthorization_ExchangeFails(t *testing.T) {
 	repo := &mockTokenRepository{}
 	provider := &mockOAuthProvider{exchangeErr: errors.New("exchange failed")}
-	uc := NewOAuthUseCase(repo, provider)
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
 
-	_, state := uc.StartAuthorization()
+	_, state, _ := uc.StartAuthorization(context.Background(), AuthorizationRequest{})
 	token, err := uc.CompleteAuthorization(context.Background(), "auth_code", state)
 
-	if err != ErrExchangeFailed {
+	if !errors.Is(err, ErrExchangeFailed) {
 		t.Errorf("expected ErrExchangeFailed, got %v", err)
 	}
 	if token != nil {
 		t.Error("expected nil token")
 	}
 }
+
+func TestOAuthUseCase_CompleteAuthorization_ConcurrentAuthorizations(t *testing.T) {
+	repo := &mockTokenRepository{}
+	provider := &mockOAuthProvider{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+	ctx := context.Background()
+
+	_, first, _ := uc.StartAuthorization(ctx, AuthorizationRequest{})
+	firstVerifier := provider.authCodeVerifier
+	_, second, _ := uc.StartAuthorization(ctx, AuthorizationRequest{})
+
+	// 2つ目の認可を開始しても1つ目の認可を完了できる
+	if _, err := uc.CompleteAuthorization(ctx, "code1", first); err != nil {
+		t.Fatalf("unexpected error for first authorization: %v", err)
+	}
+	if provider.exchangeVerifier != firstVerifier {
+		t.Error("expected the first authorization's code verifier to be used")
+	}
+	if _, err := uc.CompleteAuthorization(ctx, "code2", second); err != nil {
+		t.Fatalf("unexpected error for second authorization: %v", err)
+	}
+}
+
+func TestOAuthUseCase_CompleteAuthorization_StateReplay(t *testing.T) {
+	repo := &mockTokenRepository{}
+	provider := &mockOAuthProvider{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+	ctx := context.Background()
+
+	_, state, _ := uc.StartAuthorization(ctx, AuthorizationRequest{})
+	uc.CompleteAuthorization(ctx, "auth_code", state)
+	_, err := uc.CompleteAuthorization(ctx, "auth_code", state)
+
+	if err != ErrStateMismatch {
+		t.Errorf("expected ErrStateMismatch on replay, got %v", err)
+	}
+}
+
+func TestOAuthUseCase_CompleteAuthorization_RejectsOtherProfile(t *testing.T) {
+	provider := &mockOAuthProvider{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	store := newMockStateStore()
+	ctx := context.Background()
+
+	// 状態ファイルを共有する別のプロファイルが開始した認可は完了できない
+	other := NewOAuthUseCase(&mockTokenRepository{}, provider, store, WithProfile("other"))
+	_, state, _ := other.StartAuthorization(ctx, AuthorizationRequest{})
+
+	repo := &mockTokenRepository{}
+	uc := NewOAuthUseCase(repo, provider, store, WithProfile("default"))
+	_, err := uc.CompleteAuthorization(ctx, "auth_code", state)
+
+	if err != ErrStateMismatch {
+		t.Errorf("expected ErrStateMismatch, got %v", err)
+	}
+	if provider.exchangeVerifier != "" {
+		t.Error("expected no code exchange")
+	}
+	if repo.saveCalled {
+		t.Error("expected no token to be saved")
+	}
+}
+
+func TestOAuthUseCase_CompleteAuthorization_StateExpired(t *testing.T) {
+	repo := &mockTokenRepository{}
+	provider := &mockOAuthProvider{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	store := newMockStateStore()
+	store.expired = true
+	uc := NewOAuthUseCase(repo, provider, store)
+
+	_, state, _ := uc.StartAuthorization(context.Background(), AuthorizationRequest{})
+	_, err := uc.CompleteAuthorization(context.Background(), "auth_code", state)
+
+	if err != ErrStateExpired {
+		t.Errorf("expected ErrStateExpired, got %v", err)
+	}
+	if repo.saveCalled {
+		t.Error("expected no token to be saved")
+	}
+}
+
+// recordEvents はユースケースが発行したイベントを記録する
+func recordEvents(uc *OAuthUseCase) *[]domain.Event {
+	var events []domain.Event
+	uc.Subscribe(func(ctx context.Context, event domain.Event) {
+		events = append(events, event)
+	})
+	return &events
+}
+
+func TestOAuthUseCase_Events_Obtained(t *testing.T) {
+	repo := &mockTokenRepository{}
+	provider := &mockOAuthProvider{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+	events := recordEvents(uc)
+
+	_, state, _ := uc.StartAuthorization(context.Background(), AuthorizationRequest{})
+	if _, err := uc.CompleteAuthorization(context.Background(), "auth_code", state); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(*events) != 1 || (*events)[0].Type != domain.EventTokenObtained || (*events)[0].Token.AccessToken != "access" {
+		t.Fatalf("expected token.obtained event, got %+v", *events)
+	}
+	if (*events)[0].Time.IsZero() {
+		t.Error("expected event time to be set")
+	}
+}
+
+func TestOAuthUseCase_Events_Refreshed(t *testing.T) {
+	repo := &mockTokenRepository{token: domain.NewToken("old_access", "old_refresh", time.Now().Add(-time.Hour))}
+	provider := &mockOAuthProvider{token: domain.NewToken("new_access", "new_refresh", time.Now().Add(time.Hour))}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+	events := recordEvents(uc)
+
+	if _, err := uc.GetOrRefreshToken(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(*events) != 1 || (*events)[0].Type != domain.EventTokenRefreshed {
+		t.Fatalf("expected token.refreshed event, got %+v", *events)
+	}
+	if !(*events)[0].RefreshTokenRotated {
+		t.Error("expected refresh token rotation to be reported")
+	}
+}
+
+func TestOAuthUseCase_Events_RefreshFailed(t *testing.T) {
+	repo := &mockTokenRepository{token: domain.NewToken("access", "refresh", time.Now().Add(-time.Hour))}
+	provider := &mockOAuthProvider{refreshErr: &domain.OAuthError{Op: "refresh", Code: domain.ErrorCodeInvalidGrant, StatusCode: 400}}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+	events := recordEvents(uc)
+
+	_, err := uc.GetOrRefreshToken(context.Background())
+
+	if len(*events) != 1 || (*events)[0].Type != domain.EventRefreshFailed {
+		t.Fatalf("expected token.refresh_failed event, got %+v", *events)
+	}
+	if (*events)[0].Err != err || !errors.Is((*events)[0].Err, domain.ErrInvalidGrant) {
+		t.Errorf("expected event to carry the refresh error, got %v", (*events)[0].Err)
+	}
+}
+
+func TestOAuthUseCase_Events_Deleted(t *testing.T) {
+	repo := &mockTokenRepository{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	uc := NewOAuthUseCase(repo, &mockOAuthProvider{}, newMockStateStore())
+	events := recordEvents(uc)
+
+	if err := uc.Logout(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(*events) != 1 || (*events)[0].Type != domain.EventTokenDeleted {
+		t.Fatalf("expected token.deleted event, got %+v", *events)
+	}
+}
+
+func TestOAuthUseCase_Events_HandlerMayCallUseCase(t *testing.T) {
+	repo := &mockTokenRepository{token: domain.NewToken("old_access", "refresh", time.Now().Add(-time.Hour))}
+	provider := &mockOAuthProvider{token: domain.NewToken("new_access", "refresh", time.Now().Add(time.Hour))}
+	uc := NewOAuthUseCase(repo, provider, newMockStateStore())
+
+	var loaded *domain.Token
+	var handled bool
+	uc.Subscribe(func(ctx context.Context, event domain.Event) {
+		// イベントはロックの解放後に発行されるため、ハンドラからリフレッシュを呼んでもデッドロックしない
+		if !handled {
+			handled = true
+			loaded, _ = uc.ForceRefresh(ctx)
+		}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		uc.GetOrRefreshToken(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("event handler deadlocked")
+	}
+	if loaded == nil {
+		t.Error("expected handler to obtain a token")
+	}
+}
+
+func TestOAuthUseCase_Unsubscribe(t *testing.T) {
+	repo := &mockTokenRepository{token: domain.NewToken("access", "refresh", time.Now().Add(time.Hour))}
+	uc := NewOAuthUseCase(repo, &mockOAuthProvider{}, newMockStateStore())
+
+	called := 0
+	unsubscribe := uc.Subscribe(func(ctx context.Context, event domain.Event) { called++ })
+	unsubscribe()
+
+	uc.Logout(context.Background())
+
+	if called != 0 {
+		t.Errorf("expected no events after unsubscribe, got %d", called)
+	}
+}
@@ -0,0 +1,64 @@
+package usecase
+
+import (
+	"context"
+
+	"freee-oauth-app/domain"
+)
+
+// TokenRepositoryFactory はプロファイルごとのトークンリポジトリを生成する
+type TokenRepositoryFactory func(profile *domain.Profile) (domain.TokenRepository, error)
+
+// ProfileSummary はプロファイルと保存されているトークンの組
+// トークンが保存されていない場合 Token はnilになる
+type ProfileSummary struct {
+	Profile *domain.Profile
+	Token   *domain.Token
+}
+
+// ProfileUseCase はプロファイル管理のユースケースを提供する
+type ProfileUseCase struct {
+	profileRepo  domain.ProfileRepository
+	tokenRepoFor TokenRepositoryFactory
+}
+
+// NewProfileUseCase は新しいProfileUseCaseを生成する
+func NewProfileUseCase(profileRepo domain.ProfileRepository, tokenRepoFor TokenRepositoryFactory) *ProfileUseCase {
+	return &ProfileUseCase{
+		profileRepo:  profileRepo,
+		tokenRepoFor: tokenRepoFor,
+	}
+}
+
+// ListProfiles はすべてのプロファイルとその保存済みトークンを返す
+func (uc *ProfileUseCase) ListProfiles(ctx context.Context) ([]ProfileSummary, error) {
+	profiles, err := uc.profileRepo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]ProfileSummary, 0, len(profiles))
+	for _, profile := range profiles {
+		summary, err := uc.Describe(ctx, profile)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// Describe はプロファイルの保存済みトークンを読み込んでサマリーを返す
+// ネットワークにはアクセスしない
+func (uc *ProfileUseCase) Describe(ctx context.Context, profile *domain.Profile) (ProfileSummary, error) {
+	tokenRepo, err := uc.tokenRepoFor(profile)
+	if err != nil {
+		return ProfileSummary{}, err
+	}
+
+	summary := ProfileSummary{Profile: profile}
+	if token, err := tokenRepo.Load(ctx); err == nil {
+		summary.Token = token
+	}
+	return summary, nil
+}
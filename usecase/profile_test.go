@@ -0,0 +1,73 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"freee-oauth-app/domain"
+)
+
+// モックProfileRepository
+type mockProfileRepository struct {
+	profiles []*domain.Profile
+	listErr  error
+}
+
+func (m *mockProfileRepository) List(ctx context.Context) ([]*domain.Profile, error) {
+	if m.listErr != nil {
+		return nil, m.listErr
+	}
+	return m.profiles, nil
+}
+
+func (m *mockProfileRepository) Get(ctx context.Context, name string) (*domain.Profile, error) {
+	for _, p := range m.profiles {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, domain.ErrProfileNotFound
+}
+
+func TestProfileUseCase_ListProfiles(t *testing.T) {
+	token := domain.NewToken("access", "refresh", time.Now().Add(time.Hour))
+	profileRepo := &mockProfileRepository{profiles: []*domain.Profile{
+		{Name: "production", TokenFile: "prod.json"},
+		{Name: "sandbox", TokenFile: "sandbox.json"},
+	}}
+	tokenRepos := map[string]*mockTokenRepository{
+		"prod.json":    {token: token},
+		"sandbox.json": {loadErr: errors.New("not found")},
+	}
+	uc := NewProfileUseCase(profileRepo, func(profile *domain.Profile) (domain.TokenRepository, error) {
+		return tokenRepos[profile.TokenFile], nil
+	})
+
+	summaries, err := uc.ListProfiles(context.Background())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("expected 2 summaries, got %d", len(summaries))
+	}
+	if summaries[0].Token != token {
+		t.Error("expected stored token for production profile")
+	}
+	if summaries[1].Token != nil {
+		t.Error("expected no token for sandbox profile")
+	}
+}
+
+func TestProfileUseCase_ListProfiles_WhenListFails(t *testing.T) {
+	profileRepo := &mockProfileRepository{listErr: errors.New("broken file")}
+	uc := NewProfileUseCase(profileRepo, func(profile *domain.Profile) (domain.TokenRepository, error) {
+		return &mockTokenRepository{}, nil
+	})
+
+	if _, err := uc.ListProfiles(context.Background()); err == nil {
+		t.Error("expected error when profile list fails")
+	}
+}
@@ -0,0 +1,194 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"freee-oauth-app/domain"
+)
+
+const (
+	// defaultSchedulerPoll はトークンを読み込み直す間隔
+	// 他のプロセスによるリフレッシュやスリープからの復帰を検知するため、長時間眠らない
+	defaultSchedulerPoll = time.Minute
+	// minRefreshInterval は連続するリフレッシュの最小間隔
+	// Lead がトークンの有効期間より長い場合にリフレッシュを繰り返さないようにする
+	minRefreshInterval = time.Minute
+)
+
+// SchedulerOptions はプロアクティブなリフレッシュの設定
+type SchedulerOptions struct {
+	// Lead は有効期限のどれだけ前にリフレッシュするか
+	Lead time.Duration
+	// Jitter はリフレッシュを早める最大のランダムな幅
+	// 複数のプロセスが同時にリフレッシュしないようにする
+	Jitter time.Duration
+	// KeepAlive は有効期限に関わらずリフレッシュする間隔（0の場合は無効）
+	// 長期間使われないリフレッシュトークンが失効しないようにする
+	KeepAlive time.Duration
+	// RetryInterval は一時的な障害でリフレッシュに失敗した場合の再試行間隔
+	RetryInterval time.Duration
+	// OnRefresh はリフレッシュに成功した場合に呼ばれる
+	OnRefresh func(token *domain.Token)
+	// OnError はリフレッシュに失敗した場合に呼ばれる
+	// retryAt は次に再試行する時刻で、ゼロ値の場合はスケジューラーが終了する
+	OnError func(err error, retryAt time.Time)
+}
+
+// RefreshScheduler はトークンの有効期限が近づく前にリフレッシュを行う
+//
+// GetOrRefreshToken は呼び出されたときにしかリフレッシュしないため、トークンが
+// 長期間使われないとリフレッシュトークンが失効して再認可が必要になる。
+// RefreshScheduler は常駐して、有効期限の Lead 前と KeepAlive ごとにリフレッシュする。
+type RefreshScheduler struct {
+	useCase *OAuthUseCase
+	opts    SchedulerOptions
+	poll    time.Duration
+	now     func() time.Time
+	sleep   func(ctx context.Context, d time.Duration) error
+	jitter  func(d time.Duration) time.Duration
+}
+
+// NewRefreshScheduler は新しいRefreshSchedulerを生成する
+func NewRefreshScheduler(useCase *OAuthUseCase, opts SchedulerOptions) *RefreshScheduler {
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = time.Minute
+	}
+	return &RefreshScheduler{
+		useCase: useCase,
+		opts:    opts,
+		poll:    defaultSchedulerPoll,
+		now:     useCase.expiry.Clock.Now,
+		sleep:   sleepContext,
+		jitter:  randomJitter,
+	}
+}
+
+// Run はctxがキャンセルされるまでスケジュールに従ってトークンをリフレッシュする
+//
+// ctxのキャンセルによる終了では nil を返す。トークンがない場合や、
+// 再認可しなければ回復しない失敗（invalid_grant など）ではエラーを返して終了する。
+// 一時的な障害による失敗は RetryInterval ごとに再試行する。
+func (s *RefreshScheduler) Run(ctx context.Context) error {
+	var (
+		// keepAliveFrom は KeepAlive の起点（最後にトークンが更新された時刻）
+		keepAliveFrom = s.now()
+		refreshedAt   time.Time
+		plannedFor    string
+		due           time.Time
+	)
+	for {
+		token, err := s.useCase.LoadToken(ctx)
+		if err != nil {
+			s.reportError(err, time.Time{})
+			return err
+		}
+		if !token.HasRefreshToken() {
+			s.reportError(ErrNoRefreshToken, time.Time{})
+			return ErrNoRefreshToken
+		}
+
+		// トークンが変わった（他のプロセスがリフレッシュした）場合はスケジュールし直す
+		if token.AccessToken != plannedFor {
+			if plannedFor != "" {
+				keepAliveFrom = s.now()
+			}
+			plannedFor = token.AccessToken
+			due = s.nextRefresh(token, keepAliveFrom, refreshedAt)
+		}
+
+		now := s.now()
+		if now.Before(due) {
+			if err := s.sleep(ctx, min(due.Sub(now), s.poll)); err != nil {
+				return nil
+			}
+			continue
+		}
+
+		refreshed, err := s.useCase.refreshExclusive(ctx, func(current *domain.Token) bool {
+			return current.AccessToken == token.AccessToken
+		})
+		switch {
+		case err == nil:
+			refreshedAt, keepAliveFrom = s.now(), s.now()
+			plannedFor = ""
+			if s.opts.OnRefresh != nil {
+				s.opts.OnRefresh(refreshed)
+			}
+		case ctx.Err() != nil:
+			return nil
+		case isPermanentRefreshError(err):
+			s.reportError(err, time.Time{})
+			return err
+		default:
+			due = s.now().Add(s.opts.RetryInterval)
+			s.reportError(err, due)
+		}
+	}
+}
+
+// nextRefresh は次にリフレッシュする時刻を返す
+func (s *RefreshScheduler) nextRefresh(token *domain.Token, keepAliveFrom, refreshedAt time.Time) time.Time {
+	at := token.Expiry.Add(-s.opts.Lead)
+	if s.opts.KeepAlive > 0 {
+		at = minTime(at, keepAliveFrom.Add(s.opts.KeepAlive))
+	}
+	if s.opts.Jitter > 0 {
+		at = at.Add(-s.jitter(s.opts.Jitter))
+	}
+	if !refreshedAt.IsZero() {
+		at = maxTime(at, refreshedAt.Add(minRefreshInterval))
+	}
+	return at
+}
+
+func (s *RefreshScheduler) reportError(err error, retryAt time.Time) {
+	if s.opts.OnError != nil {
+		s.opts.OnError(err, retryAt)
+	}
+}
+
+// isPermanentRefreshError は再試行しても回復しないリフレッシュの失敗かを判定する
+// 認可サーバーが拒否した場合（invalid_grant など）は再認可が必要になる
+func isPermanentRefreshError(err error) bool {
+	switch {
+	case errors.Is(err, ErrNoToken), errors.Is(err, ErrNoRefreshToken):
+		return true
+	case errors.Is(err, ErrRefreshFailed):
+		return !errors.Is(err, domain.ErrTransient)
+	default:
+		return false
+	}
+}
+
+// randomJitter は0から d までの一様乱数を返す
+func randomJitter(d time.Duration) time.Duration {
+	return rand.N(d + 1)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
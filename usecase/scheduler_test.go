@@ -0,0 +1,230 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"freee-oauth-app/domain"
+)
+
+// fakeClock はスリープせずに時刻を進める時計
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.now = c.now.Add(d)
+	return nil
+}
+
+// sequenceProvider はリフレッシュごとに新しいトークンを発行し、リフレッシュした時刻を記録する
+type sequenceProvider struct {
+	mockOAuthProvider
+	clock     *fakeClock
+	lifetime  time.Duration
+	errs      []error
+	refreshed []time.Time
+}
+
+func (m *sequenceProvider) Refresh(ctx context.Context, token *domain.Token) (*domain.Token, error) {
+	if len(m.errs) > 0 {
+		err := m.errs[0]
+		m.errs = m.errs[1:]
+		return nil, err
+	}
+	m.refreshed = append(m.refreshed, m.clock.Now())
+	n := len(m.refreshed)
+	return domain.NewToken(fmt.Sprintf("access-%d", n), fmt.Sprintf("refresh-%d", n), m.clock.Now().Add(m.lifetime)), nil
+}
+
+func newTestScheduler(repo domain.TokenRepository, provider *sequenceProvider, opts SchedulerOptions) *RefreshScheduler {
+	s := NewRefreshScheduler(NewOAuthUseCase(repo, provider, newMockStateStore()), opts)
+	s.now = provider.clock.Now
+	s.sleep = provider.clock.Sleep
+	s.jitter = func(d time.Duration) time.Duration { return d }
+	return s
+}
+
+// stopAfter は n 回リフレッシュした時点でキャンセルする OnRefresh を返す
+func stopAfter(n int, cancel context.CancelFunc) func(*domain.Token) {
+	count := 0
+	return func(*domain.Token) {
+		if count++; count >= n {
+			cancel()
+		}
+	}
+}
+
+func TestRefreshScheduler_RefreshesAheadOfExpiry(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	start := clock.now
+	repo := &mockTokenRepository{token: domain.NewToken("access", "refresh", start.Add(time.Hour))}
+	provider := &sequenceProvider{clock: clock, lifetime: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newTestScheduler(repo, provider, SchedulerOptions{
+		Lead:      10 * time.Minute,
+		Jitter:    2 * time.Minute,
+		OnRefresh: stopAfter(2, cancel),
+	})
+
+	if err := s.Run(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []time.Time{start.Add(48 * time.Minute), start.Add(96 * time.Minute)}
+	if len(provider.refreshed) != 2 || !provider.refreshed[0].Equal(want[0]) || !provider.refreshed[1].Equal(want[1]) {
+		t.Errorf("expected refreshes at %v, got %v", want, provider.refreshed)
+	}
+	if repo.token.AccessToken != "access-2" {
+		t.Errorf("expected refreshed token to be saved, got %s", repo.token.AccessToken)
+	}
+}
+
+func TestRefreshScheduler_KeepsRefreshTokenAlive(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	start := clock.now
+	repo := &mockTokenRepository{token: domain.NewToken("access", "refresh", start.Add(30*24*time.Hour))}
+	provider := &sequenceProvider{clock: clock, lifetime: 30 * 24 * time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newTestScheduler(repo, provider, SchedulerOptions{
+		Lead:      10 * time.Minute,
+		KeepAlive: 24 * time.Hour,
+		OnRefresh: stopAfter(1, cancel),
+	})
+	s.poll = time.Hour
+
+	if err := s.Run(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(provider.refreshed) != 1 || !provider.refreshed[0].Equal(start.Add(24*time.Hour)) {
+		t.Errorf("expected keep-alive refresh after 24h, got %v", provider.refreshed)
+	}
+}
+
+func TestRefreshScheduler_RetriesTransientFailures(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	start := clock.now
+	repo := &mockTokenRepository{token: domain.NewToken("access", "refresh", start.Add(5*time.Minute))}
+	provider := &sequenceProvider{
+		clock:    clock,
+		lifetime: time.Hour,
+		errs:     []error{&domain.OAuthError{Op: "refresh", StatusCode: http.StatusServiceUnavailable}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var retryAts []time.Time
+	s := newTestScheduler(repo, provider, SchedulerOptions{
+		Lead:          10 * time.Minute,
+		RetryInterval: 30 * time.Second,
+		OnRefresh:     stopAfter(1, cancel),
+		OnError: func(err error, retryAt time.Time) {
+			if !errors.Is(err, domain.ErrTransient) {
+				t.Errorf("expected transient error, got %v", err)
+			}
+			retryAts = append(retryAts, retryAt)
+		},
+	})
+
+	if err := s.Run(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(retryAts) != 1 || !retryAts[0].Equal(start.Add(30*time.Second)) {
+		t.Errorf("expected one retry after 30s, got %v", retryAts)
+	}
+	if len(provider.refreshed) != 1 || !provider.refreshed[0].Equal(start.Add(30*time.Second)) {
+		t.Errorf("expected refresh at retry time, got %v", provider.refreshed)
+	}
+}
+
+func TestRefreshScheduler_StopsOnPermanentFailure(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	repo := &mockTokenRepository{token: domain.NewToken("access", "refresh", clock.now.Add(time.Minute))}
+	provider := &sequenceProvider{
+		clock:    clock,
+		lifetime: time.Hour,
+		errs:     []error{&domain.OAuthError{Op: "refresh", Code: domain.ErrorCodeInvalidGrant, StatusCode: http.StatusBadRequest}},
+	}
+
+	var reported error
+	var reportedRetry time.Time
+	s := newTestScheduler(repo, provider, SchedulerOptions{
+		Lead: 10 * time.Minute,
+		OnError: func(err error, retryAt time.Time) {
+			reported, reportedRetry = err, retryAt
+		},
+	})
+
+	err := s.Run(context.Background())
+
+	if !errors.Is(err, domain.ErrInvalidGrant) || !errors.Is(err, ErrRefreshFailed) {
+		t.Errorf("expected invalid_grant refresh failure, got %v", err)
+	}
+	if reported != err || !reportedRetry.IsZero() {
+		t.Errorf("expected failure to be reported without retry, got %v at %v", reported, reportedRetry)
+	}
+}
+
+func TestRefreshScheduler_ReschedulesWhenRefreshedElsewhere(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	start := clock.now
+	repo := &mockTokenRepository{token: domain.NewToken("access", "refresh", start.Add(time.Hour))}
+	provider := &sequenceProvider{clock: clock, lifetime: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newTestScheduler(repo, provider, SchedulerOptions{
+		Lead:      10 * time.Minute,
+		OnRefresh: stopAfter(1, cancel),
+	})
+	// 30分後に他のプロセスがリフレッシュしたトークンを保存する
+	sleep := s.sleep
+	s.sleep = func(ctx context.Context, d time.Duration) error {
+		if clock.Now().Equal(start.Add(30 * time.Minute)) {
+			repo.Save(ctx, domain.NewToken("external", "external-refresh", clock.Now().Add(time.Hour)))
+		}
+		return sleep(ctx, d)
+	}
+
+	if err := s.Run(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(provider.refreshed) != 1 || !provider.refreshed[0].Equal(start.Add(80*time.Minute)) {
+		t.Errorf("expected refresh scheduled from the external token, got %v", provider.refreshed)
+	}
+}
+
+func TestRefreshScheduler_NoToken(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	repo := &mockTokenRepository{loadErr: errors.New("not found")}
+	s := newTestScheduler(repo, &sequenceProvider{clock: clock}, SchedulerOptions{})
+
+	if err := s.Run(context.Background()); !errors.Is(err, ErrNoToken) {
+		t.Errorf("expected ErrNoToken, got %v", err)
+	}
+}
+
+func TestRefreshScheduler_StopsWhenContextIsCanceled(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	repo := &mockTokenRepository{token: domain.NewToken("access", "refresh", clock.now.Add(time.Hour))}
+	s := newTestScheduler(repo, &sequenceProvider{clock: clock}, SchedulerOptions{Lead: 10 * time.Minute})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := s.Run(ctx); err != nil {
+		t.Errorf("expected nil on cancellation, got %v", err)
+	}
+}